@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	aliasPatternRandom     = "random"
+	aliasPatternWordDigits = "word+digits"
+	aliasPatternCustom     = "custom"
+)
+
+// defaultAliasCharset and defaultAliasLength are used by the random pattern.
+const (
+	defaultAliasCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	defaultAliasLength  = 10
+)
+
+// minAliasEntropyBits is the least randomness an alias pattern may have.
+// At 40 bits the chance of a repeat across 10k aliases is below 1 in 20,000.
+const minAliasEntropyBits = 40
+
+var aliasAdjectives = []string{
+	"amber", "ancient", "autumn", "azure", "bold", "brave", "breezy", "bright",
+	"brisk", "calm", "clever", "cobalt", "cosmic", "crimson", "crisp", "curly",
+	"daring", "dawn", "dusty", "eager", "early", "electric", "emerald", "fancy",
+	"fearless", "fierce", "flying", "frosty", "gentle", "giant", "gilded", "glad",
+	"golden", "grand", "happy", "hidden", "hollow", "humble", "icy", "jolly",
+	"keen", "lazy", "little", "lively", "lucky", "lunar", "mellow", "merry",
+	"midnight", "mighty", "misty", "modern", "noble", "northern", "odd", "olive",
+	"orange", "pale", "plain", "polar", "proud", "purple", "quick", "quiet",
+	"rapid", "rocky", "rosy", "royal", "rusty", "sandy", "scarlet", "secret",
+	"shady", "sharp", "shiny", "silent", "silver", "sleepy", "slim", "smooth",
+	"snowy", "solar", "sparkly", "speedy", "spicy", "steady", "stormy", "sunny",
+	"swift", "tall", "tidy", "tiny", "velvet", "vivid", "wandering", "warm",
+	"wild", "windy", "wise", "witty", "young", "zesty",
+}
+
+var aliasNouns = []string{
+	"badger", "bear", "beacon", "bison", "blossom", "breeze", "brook", "canyon",
+	"cedar", "cliff", "cloud", "comet", "coral", "cougar", "coyote", "crane",
+	"creek", "crow", "dolphin", "dragon", "eagle", "ember", "falcon", "fern",
+	"finch", "forest", "fox", "glacier", "grove", "harbor", "hawk", "heron",
+	"hill", "island", "jaguar", "koala", "lake", "lantern", "leopard", "lion",
+	"lynx", "maple", "meadow", "mesa", "moon", "moose", "mountain", "oak",
+	"ocean", "orca", "otter", "owl", "panda", "panther", "parrot", "pebble",
+	"pelican", "pine", "planet", "pony", "prairie", "puffin", "quail", "rabbit",
+	"raven", "reef", "ridge", "river", "robin", "rocket", "sparrow", "spruce",
+	"star", "stone", "storm", "summit", "swan", "thunder", "tiger", "trail",
+	"tulip", "valley", "viper", "walrus", "wave", "whale", "willow", "wolf",
+	"wren", "yak", "zebra",
+}
+
+// generateAlias returns a new alias local part using AliasPattern.
+func generateAlias() (string, error) {
+	switch config.AliasPattern {
+	case aliasPatternWordDigits:
+		return generateWordDigitsAlias()
+	case aliasPatternCustom:
+		return generateAliasFromCharset(config.AliasCharset, config.AliasLength)
+	default:
+		if config.AliasLength == 0 {
+			return generateRandomAlias(defaultAliasLength)
+		}
+		return generateRandomAlias(config.AliasLength)
+	}
+}
+
+// aliasEntropyBits returns how many bits of randomness AliasPattern produces.
+func aliasEntropyBits() float64 {
+	switch config.AliasPattern {
+	case aliasPatternWordDigits:
+		return wordEntropyBits() + float64(wordAliasDigits())*math.Log2(10)
+	case aliasPatternCustom:
+		return float64(config.AliasLength) * math.Log2(float64(len(config.AliasCharset)))
+	default:
+		return float64(config.AliasLength) * math.Log2(float64(len(defaultAliasCharset)))
+	}
+}
+
+func wordEntropyBits() float64 {
+	return math.Log2(float64(len(aliasAdjectives))) + math.Log2(float64(len(aliasNouns)))
+}
+
+// wordAliasDigits returns how many digits the word+digits pattern appends to
+// reach minAliasEntropyBits.
+func wordAliasDigits() int {
+	return int(math.Ceil((minAliasEntropyBits - wordEntropyBits()) / math.Log2(10)))
+}
+
+func generateRandomAlias(length int) (string, error) {
+	return generateAliasFromCharset(defaultAliasCharset, length)
+}
+
+// generateWordDigitsAlias returns an alias like bluefalcon473021586.
+func generateWordDigitsAlias() (string, error) {
+	adjective, err := randomIndex(len(aliasAdjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomIndex(len(aliasNouns))
+	if err != nil {
+		return "", err
+	}
+	digits, err := generateAliasFromCharset("0123456789", wordAliasDigits())
+	if err != nil {
+		return "", err
+	}
+	return aliasAdjectives[adjective] + aliasNouns[noun] + digits, nil
+}
+
+func generateAliasFromCharset(charset string, length int) (string, error) {
+	alias := make([]byte, length)
+	for i := range alias {
+		n, err := randomIndex(len(charset))
+		if err != nil {
+			return "", err
+		}
+		alias[i] = charset[n]
+	}
+	return string(alias), nil
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(random, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// checkAliasPattern fills in the alias defaults and returns a description of
+// every problem with the alias settings.
+func checkAliasPattern() []string {
+	var errs []string
+
+	if config.AliasPattern == "" {
+		config.AliasPattern = aliasPatternRandom
+	}
+	if config.AliasLength == 0 && config.AliasPattern == aliasPatternRandom {
+		config.AliasLength = defaultAliasLength // Set a default value if not specified
+	}
+
+	switch config.AliasPattern {
+	case aliasPatternRandom, aliasPatternWordDigits:
+	case aliasPatternCustom:
+		if config.AliasCharset == "" || config.AliasLength <= 0 {
+			errs = append(errs, "Alias charset and length are required when alias_pattern is custom")
+			return errs
+		}
+		if strings.Trim(config.AliasCharset, "abcdefghijklmnopqrstuvwxyz0123456789._-") != "" {
+			errs = append(errs, fmt.Sprintf("Alias charset %q may only contain lowercase letters, digits, '.', '_' and '-'", config.AliasCharset))
+		}
+		if hasDuplicateBytes(config.AliasCharset) {
+			errs = append(errs, fmt.Sprintf("Alias charset %q contains repeated characters", config.AliasCharset))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("Unsupported alias pattern %q (expected random, word+digits or custom)", config.AliasPattern))
+		return errs
+	}
+
+	if bits := aliasEntropyBits(); bits < minAliasEntropyBits {
+		errs = append(errs, fmt.Sprintf("Alias pattern has %.1f bits of entropy, at least %d are required; use a longer alias or a larger charset", bits, minAliasEntropyBits))
+	}
+	return errs
+}
+
+func hasDuplicateBytes(s string) bool {
+	seen := make(map[byte]bool)
+	for i := 0; i < len(s); i++ {
+		if seen[s[i]] {
+			return true
+		}
+		seen[s[i]] = true
+	}
+	return false
+}
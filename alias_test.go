@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRandomAlias(t *testing.T) {
+	alias, err := generateRandomAlias(10)
+	if err != nil {
+		t.Fatalf("generateRandomAlias returned an error: %v", err)
+	}
+	if len(alias) != 10 {
+		t.Errorf("Expected alias length to be 10, got %d", len(alias))
+	}
+}
+
+func TestGenerateAliasPatterns(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	tests := []struct {
+		pattern string
+		charset string
+		length  int
+		want    *regexp.Regexp
+	}{
+		{aliasPatternRandom, "", 0, regexp.MustCompile(`^[a-z0-9]{10}$`)},
+		{aliasPatternWordDigits, "", 0, regexp.MustCompile(fmt.Sprintf(`^[a-z]+[0-9]{%d}$`, wordAliasDigits()))},
+		{aliasPatternCustom, "abcdef0123456789", 12, regexp.MustCompile(`^[a-f0-9]{12}$`)},
+	}
+	for _, tt := range tests {
+		config.AliasPattern = tt.pattern
+		config.AliasCharset = tt.charset
+		config.AliasLength = tt.length
+		if errs := checkAliasPattern(); len(errs) > 0 {
+			t.Fatalf("checkAliasPattern for %s returned errors: %v", tt.pattern, errs)
+		}
+
+		seen := make(map[string]bool)
+		for i := 0; i < 10000; i++ {
+			alias, err := generateAlias()
+			if err != nil {
+				t.Fatalf("generateAlias for %s returned an error: %v", tt.pattern, err)
+			}
+			if !tt.want.MatchString(alias) {
+				t.Fatalf("Alias %q for %s does not match %s", alias, tt.pattern, tt.want)
+			}
+			if seen[alias] {
+				t.Fatalf("Alias %q for %s was generated twice in %d tries", alias, tt.pattern, i+1)
+			}
+			seen[alias] = true
+		}
+	}
+}
+
+func TestCheckAliasPatternRejectsLowEntropy(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config.AliasPattern = aliasPatternCustom
+	config.AliasCharset = "abc"
+	config.AliasLength = 8
+	errs := checkAliasPattern()
+	if len(errs) != 1 || !strings.Contains(errs[0], "bits of entropy") {
+		t.Errorf("Expected a low entropy error, got %v", errs)
+	}
+
+	config.AliasCharset = "ABC!"
+	config.AliasLength = 30
+	if errs := checkAliasPattern(); len(errs) != 1 || !strings.Contains(errs[0], "may only contain") {
+		t.Errorf("Expected an invalid charset error, got %v", errs)
+	}
+}
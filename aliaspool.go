@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// aliases is the pre-created alias pool used by automatic mode, or nil when
+// each entry creates its own alias.
+var aliases *aliasPool
+
+var (
+	aliasRulesMu sync.Mutex
+	aliasRules   = make(map[string]string)
+)
+
+// preCreateAliases creates n aliases with emailProvider up front and returns
+// their addresses. The IDs are kept so takeAliasRuleID can hand them back for
+// cleanup. On error the aliases created so far are still returned.
+func preCreateAliases(ctx context.Context, n int) ([]string, error) {
+	emails := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		email, ruleID, err := emailProvider.CreateAlias(ctx)
+		if err != nil {
+			return emails, err
+		}
+
+		aliasRulesMu.Lock()
+		aliasRules[email] = ruleID
+		aliasRulesMu.Unlock()
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// takeAliasRuleID returns and forgets the rule ID recorded for email by
+// preCreateAliases.
+func takeAliasRuleID(email string) string {
+	aliasRulesMu.Lock()
+	defer aliasRulesMu.Unlock()
+	ruleID := aliasRules[email]
+	delete(aliasRules, email)
+	return ruleID
+}
+
+// aliasPool hands out pre-created aliases and tops itself up in the
+// background once it drops below half of its size.
+type aliasPool struct {
+	mu        sync.Mutex
+	ctx       context.Context
+	size      int
+	emails    []string
+	refilling bool
+	wg        sync.WaitGroup
+}
+
+// newAliasPool returns an empty pool of the given size. Refills stop when ctx
+// is cancelled.
+func newAliasPool(ctx context.Context, size int) *aliasPool {
+	return &aliasPool{ctx: ctx, size: size}
+}
+
+// Len returns the number of aliases ready to be handed out.
+func (p *aliasPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.emails)
+}
+
+// Take returns a pre-created alias and its rule ID. When the pool is empty it
+// creates one directly with ctx instead of waiting for the refill.
+func (p *aliasPool) Take(ctx context.Context) (string, string, error) {
+	p.mu.Lock()
+	var email string
+	if len(p.emails) > 0 {
+		email = p.emails[0]
+		p.emails = p.emails[1:]
+	}
+	if len(p.emails) < p.size/2 && !p.refilling && p.ctx.Err() == nil {
+		p.refilling = true
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.refill(); err != nil && p.ctx.Err() == nil {
+				errorf("Error refilling email alias pool: %v\n", err)
+			}
+		}()
+	}
+	p.mu.Unlock()
+
+	if email == "" {
+		debugPrint("Email alias pool is empty, creating an alias directly")
+		return emailProvider.CreateAlias(ctx)
+	}
+	return email, takeAliasRuleID(email), nil
+}
+
+// refill creates aliases until the pool is back to its full size.
+func (p *aliasPool) refill() error {
+	p.mu.Lock()
+	missing := p.size - len(p.emails)
+	p.mu.Unlock()
+
+	debugPrint(fmt.Sprintf("Pre-creating %d email aliases...", missing))
+	emails, err := preCreateAliases(p.ctx, missing)
+
+	p.mu.Lock()
+	p.emails = append(p.emails, emails...)
+	p.refilling = false
+	p.mu.Unlock()
+
+	return err
+}
+
+// Close waits for a refill in progress and returns the aliases that were
+// never handed out.
+func (p *aliasPool) Close() []string {
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	emails := p.emails
+	p.emails = nil
+	return emails
+}
+
+// closeAliasPool empties the alias pool and, when CleanupAliases is set,
+// deletes the aliases that were never used.
+func closeAliasPool(ctx context.Context) {
+	if aliases == nil {
+		return
+	}
+	unused := aliases.Close()
+	aliases = nil
+
+	deleted := 0
+	for _, email := range unused {
+		ruleID := takeAliasRuleID(email)
+		if !config.CleanupAliases || ruleID == "" {
+			continue
+		}
+		if err := emailProvider.Cleanup(ctx, ruleID); err != nil {
+			errorf("Error deleting email alias %s: %v\n", email, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		infof("Deleted %d unused email aliases\n", deleted)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newCloudflareRuleServer returns a mock Cloudflare API with no existing rules
+// that hands out sequential rule IDs and counts the rules created.
+func newCloudflareRuleServer(t *testing.T, created *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []interface{}{}})
+			return
+		}
+		n := atomic.AddInt32(created, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"id": fmt.Sprintf("rule_%d", n)},
+		})
+	}))
+
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	t.Cleanup(func() {
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		knownAliases = nil
+		server.Close()
+	})
+
+	config.EmailDomain = "test.com"
+	return server
+}
+
+func TestPreCreateAliases(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	emails, err := preCreateAliases(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("preCreateAliases returned an error: %v", err)
+	}
+	if len(emails) != 3 || created != 3 {
+		t.Fatalf("Expected 3 aliases and 3 rules, got %d aliases and %d rules", len(emails), created)
+	}
+
+	seen := make(map[string]bool)
+	for _, email := range emails {
+		ruleID := takeAliasRuleID(email)
+		if ruleID == "" || seen[ruleID] {
+			t.Errorf("Expected a unique rule ID for %s, got %q", email, ruleID)
+		}
+		seen[ruleID] = true
+	}
+	if ruleID := takeAliasRuleID(emails[0]); ruleID != "" {
+		t.Errorf("Expected the rule ID to be forgotten once taken, got %q", ruleID)
+	}
+}
+
+func TestAliasPoolRefills(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	pool := newAliasPool(context.Background(), 4)
+	if err := pool.refill(); err != nil {
+		t.Fatalf("refill returned an error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		email, ruleID, err := pool.Take(context.Background())
+		if err != nil {
+			t.Fatalf("Take returned an error: %v", err)
+		}
+		if email == "" || ruleID == "" {
+			t.Errorf("Expected an alias and rule ID, got %q and %q", email, ruleID)
+		}
+	}
+
+	unused := pool.Close()
+	if len(unused) != 4 {
+		t.Errorf("Expected the pool to be refilled to 4 aliases, got %d", len(unused))
+	}
+	if created != 7 {
+		t.Errorf("Expected 7 rules to be created, got %d", created)
+	}
+	for _, email := range unused {
+		takeAliasRuleID(email)
+	}
+}
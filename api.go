@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// apiServer runs submissions on request instead of from the CLI prompt.
+type apiServer struct {
+	ctx   context.Context
+	token string
+	stats submissionStats
+	// slots limits how many submissions run at once to Concurrency
+	slots chan struct{}
+}
+
+func newAPIServer(ctx context.Context, token string, concurrency int) *apiServer {
+	return &apiServer{
+		ctx:   ctx,
+		token: token,
+		slots: make(chan struct{}, concurrency),
+	}
+}
+
+// Handler returns the routes, all of which require the bearer token.
+func (a *apiServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit", a.handleSubmit)
+	mux.HandleFunc("/stats", a.handleStats)
+	return a.requireToken(mux)
+}
+
+func (a *apiServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSubmit runs one submitEntry and responds with its result. The entry
+// is not cancelled if the client disconnects, so its alias is still cleaned up.
+func (a *apiServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if a.ctx.Err() != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	if promoEnded.Load() {
+		writeJSONError(w, http.StatusGone, "the promotion has ended")
+		return
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	case <-r.Context().Done():
+		return
+	}
+	if err := waitSubmissionLimit(r.Context()); err != nil {
+		return
+	}
+
+	result, err := submitEntry(context.WithoutCancel(a.ctx), nextTarget())
+	a.stats.record(err == nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (a *apiServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	successCount, totalCount := a.stats.summary()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"success": successCount,
+		"failed":  totalCount - successCount,
+		"total":   totalCount,
+	})
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// apiMode serves the REST API on APIAddr until ctx is cancelled, then waits
+// for submissions in progress to finish.
+func apiMode(ctx context.Context) {
+	listener, err := net.Listen("tcp", config.APIAddr)
+	if err != nil {
+		errorf("Error listening on %s: %v\n", config.APIAddr, err)
+		return
+	}
+
+	api := newAPIServer(ctx, config.APIToken, config.Concurrency)
+	server := &http.Server{Handler: api.Handler()}
+	shutdownDone := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+		close(shutdownDone)
+	}()
+
+	infof("Serving the API on http://%s, press Ctrl-C to stop.\n", listener.Addr())
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		errorf("API server error: %v\n", err)
+		return
+	}
+	// Serve returns as soon as Shutdown starts; wait for the open requests
+	<-shutdownDone
+
+	infof("\nExiting API mode.\n")
+	printRunSummary(&api.stats)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIServerRequiresToken(t *testing.T) {
+	server := httptest.NewServer(newAPIServer(context.Background(), "secret", 1).Handler())
+	defer server.Close()
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req, _ := http.NewRequest("GET", server.URL+"/stats", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error sending request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for Authorization %q, got %d", auth, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIServerSubmit(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no promo request in dry-run mode")
+	}))
+	defer promo.Close()
+
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+	}()
+	config.UseCloudflareEmail = true
+	config.EmailDomain = "test.com"
+	config.MonsterSubmitURL = promo.URL
+	config.DryRun = true
+	config.DryRunFakeCaptcha = true
+	captchaSolver = stubCaptchaSolver{}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	server := httptest.NewServer(newAPIServer(context.Background(), "secret", 1).Handler())
+	defer server.Close()
+
+	do := func(method, path string, v interface{}) int {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error sending request: %v", err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("Error decoding %s response: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	if status := do("GET", "/submit", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET /submit, got %d", status)
+	}
+
+	var result SubmissionResult
+	if status := do("POST", "/submit", &result); status != http.StatusOK {
+		t.Fatalf("Expected 200 from POST /submit, got %d", status)
+	}
+	if !result.Success || result.Email == "" || result.RuleID != "rule_1" {
+		t.Errorf("Expected a successful result with the generated alias, got %+v", result)
+	}
+
+	var stats map[string]int
+	do("GET", "/stats", &stats)
+	if stats["success"] != 1 || stats["total"] != 1 {
+		t.Errorf("Expected one successful submission in the stats, got %v", stats)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, in the order the captcha_breaker_state gauge
+// reports them.
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+type breakerState int
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// errCaptchaCircuitOpen is returned in place of a solve while the captcha
+// breaker is open.
+var errCaptchaCircuitOpen = errors.New("captcha provider circuit is open after repeated failures")
+
+// captchaBreaker guards captchaSolver. Nil means solves are never refused.
+var captchaBreaker *circuitBreaker
+
+// circuitBreaker stops calling a provider that keeps failing. After
+// threshold failures in a row it opens and refuses calls for cooldown, then
+// half-opens to let a single trial call through: a success closes it again,
+// a failure reopens it for another cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	state     breakerState
+	streak    int
+	openedAt  time.Time
+	// trial is set while the one half-open call is in flight
+	trial bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, now func() time.Time) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: now}
+}
+
+// allow returns errCaptchaCircuitOpen when the call must fail fast, and
+// whether the call is the half-open trial. Every allowed call must be
+// followed by record or abandon with that trial flag.
+func (b *circuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.setState(breakerHalfOpen)
+		infof("Captcha circuit half-open, trying one solve\n")
+	}
+	switch b.state {
+	case breakerOpen:
+		return false, errCaptchaCircuitOpen
+	case breakerHalfOpen:
+		if b.trial {
+			return false, errCaptchaCircuitOpen
+		}
+		b.trial = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record adds the outcome of an allowed call.
+func (b *circuitBreaker) record(trial, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trial = false
+	}
+	if success {
+		b.streak = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+			infof("Captcha provider recovered, circuit closed\n")
+		}
+		return
+	}
+
+	b.streak++
+	// Calls that were in flight when the circuit opened do not restart the
+	// cooldown
+	if b.state == breakerOpen || (b.state == breakerHalfOpen && !trial) {
+		return
+	}
+	if trial || b.streak >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+		errorf("WARNING: captcha provider failed %d times in a row, failing solves fast for %s\n", b.streak, b.cooldown)
+	}
+}
+
+// abandon ends an allowed call without an outcome, such as one cancelled on
+// shutdown, so that another call may be the half-open trial.
+func (b *circuitBreaker) abandon(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+}
+
+// State returns the current state, as of the last allow or record call.
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	observeBreakerState(state)
+}
+
+// checkCaptchaBreaker fills in the breaker defaults and returns a description
+// of every problem with its settings.
+func checkCaptchaBreaker() []string {
+	if config.BreakerThreshold == 0 {
+		config.BreakerThreshold = 5 // Set a default value if not specified
+	}
+	if config.BreakerCooldown == 0 {
+		config.BreakerCooldown = 60 // Set a default value if not specified
+	}
+	if config.BreakerThreshold < 0 || config.BreakerCooldown < 0 {
+		return []string{fmt.Sprintf("Captcha breaker threshold %d and cooldown %v must be greater than 0", config.BreakerThreshold, config.BreakerCooldown)}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	oldOutput := logOutput
+	logOutput = io.Discard
+	defer func() { logOutput = oldOutput }()
+
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(3, time.Minute, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		trial, err := b.allow()
+		if err != nil || trial {
+			t.Fatalf("Call %d: expected a closed circuit, got %v (trial %v)", i+1, err, trial)
+		}
+		b.record(trial, false)
+	}
+	if b.State() != breakerOpen {
+		t.Fatalf("Expected the circuit to open after 3 failures, got %s", b.State())
+	}
+	if _, err := b.allow(); err != errCaptchaCircuitOpen {
+		t.Fatalf("Expected an open circuit to fail fast, got %v", err)
+	}
+
+	// After the cooldown exactly one trial call is let through
+	now = now.Add(time.Minute)
+	trial, err := b.allow()
+	if err != nil || !trial || b.State() != breakerHalfOpen {
+		t.Fatalf("Expected a half-open trial, got %v (trial %v, %s)", err, trial, b.State())
+	}
+	if _, err := b.allow(); err != errCaptchaCircuitOpen {
+		t.Fatalf("Expected a second call to fail fast during the trial, got %v", err)
+	}
+	b.record(trial, false)
+	if b.State() != breakerOpen {
+		t.Fatalf("Expected a failed trial to reopen the circuit, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	trial, _ = b.allow()
+	b.abandon(trial)
+	trial, err = b.allow()
+	if err != nil || !trial {
+		t.Fatalf("Expected an abandoned trial to free the next call, got %v (trial %v)", err, trial)
+	}
+	b.record(trial, true)
+	if b.State() != breakerClosed {
+		t.Errorf("Expected a successful trial to close the circuit, got %s", b.State())
+	}
+}
+
+func TestSolveCaptchaFailsFastWhenCircuitOpen(t *testing.T) {
+	oldSolver, oldBreaker, oldSlots, oldOutput := captchaSolver, captchaBreaker, captchaSlots, logOutput
+	defer func() {
+		captchaSolver, captchaBreaker, captchaSlots, logOutput = oldSolver, oldBreaker, oldSlots, oldOutput
+	}()
+	logOutput = io.Discard
+	captchaSlots = nil
+
+	solver := &failingCaptchaSolver{err: errors.New("provider down")}
+	captchaSolver = solver
+	captchaBreaker = newCircuitBreaker(2, time.Hour, time.Now)
+
+	for i := 0; i < 4; i++ {
+		solveCaptcha(context.Background(), Target{})
+	}
+	if solver.calls != 2 {
+		t.Errorf("Expected the provider to be called twice before the circuit opened, got %d", solver.calls)
+	}
+	if _, _, err := solveCaptcha(context.Background(), Target{}); err != errCaptchaCircuitOpen {
+		t.Errorf("Expected errCaptchaCircuitOpen, got %v", err)
+	}
+}
+
+// failingCaptchaSolver fails every solve with err and counts the calls.
+type failingCaptchaSolver struct {
+	calls int
+	err   error
+}
+
+func (s *failingCaptchaSolver) Name() string { return "failing" }
+
+func (s *failingCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	s.calls++
+	return "", s.err
+}
+
+func (s *failingCaptchaSolver) Balance() (float64, error) { return 0, nil }
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CaptchaSolver is implemented by each captcha solving provider.
+type CaptchaSolver interface {
+	// Name identifies the provider in logs and results.
+	Name() string
+	// Solve returns a token for the configured captcha type on pageURL.
+	Solve(ctx context.Context, siteKey, pageURL string) (string, error)
+	// Balance returns the remaining account balance in USD.
+	Balance() (float64, error)
+}
+
+// captchaSolver is the provider chosen at startup by newCaptchaSolver.
+var captchaSolver CaptchaSolver
+
+// newCaptchaSolver returns the provider selected in the config file, or one
+// that fails over between the captcha_providers in order.
+// 2Captcha is skipped for Turnstile, which it does not support here.
+func newCaptchaSolver() CaptchaSolver {
+	if len(config.CaptchaProviders) > 0 {
+		return newFailoverSolver(config.CaptchaProviders)
+	}
+	if config.UseAntiCaptcha {
+		return antiCaptchaSolver{}
+	}
+	if config.UseCapMonster {
+		return capMonsterSolver{}
+	}
+	if config.UseTwoCaptcha && config.CaptchaType != captchaTypeTurnstile {
+		return twoCaptchaSolver{}
+	}
+	return ezCaptchaSolver{}
+}
+
+// captchaSiteKey returns the site key for the configured captcha type.
+func captchaSiteKey() string {
+	switch config.CaptchaType {
+	case captchaTypeTurnstile:
+		return config.TurnstileSiteKey
+	case captchaTypeHCaptcha:
+		return config.HCaptchaSiteKey
+	default:
+		return config.RecaptchaSiteKey
+	}
+}
+
+// useRecaptchaV3 reports whether reCAPTCHA tasks should be solved as v3.
+func useRecaptchaV3() bool {
+	return config.CaptchaType == captchaTypeRecaptchaV2 && config.RecaptchaVersion == recaptchaVersionV3
+}
+
+// useRecaptchaEnterprise reports whether reCAPTCHA v2 tasks should be solved
+// as Enterprise, sending EnterprisePayload along.
+func useRecaptchaEnterprise() bool {
+	return config.CaptchaType == captchaTypeRecaptchaV2 && config.RecaptchaEnterprise && !useRecaptchaV3()
+}
+
+// balanceCache holds the last balance read from captchaSolver. Failed reads
+// are never cached, so a retry always goes back to the provider.
+var balanceCache struct {
+	mu       sync.Mutex
+	provider string
+	balance  float64
+	fetched  time.Time
+}
+
+// checkCaptchaBalance returns the balance of captchaSolver, reusing the last
+// one read within BalanceCacheTTL seconds.
+func checkCaptchaBalance() (float64, error) {
+	ttl := time.Duration(config.BalanceCacheTTL * float64(time.Second))
+	balanceCache.mu.Lock()
+	if age := time.Since(balanceCache.fetched); ttl > 0 && balanceCache.provider == captchaSolver.Name() && age < ttl {
+		balance := balanceCache.balance
+		balanceCache.mu.Unlock()
+		debugPrint(fmt.Sprintf("Using the captcha balance read %s ago", age.Round(time.Second)))
+		return balance, nil
+	}
+	balanceCache.mu.Unlock()
+	return forceBalanceRefresh()
+}
+
+// forceBalanceRefresh reads the balance from captchaSolver regardless of the
+// cache and caches it for later checkCaptchaBalance calls.
+func forceBalanceRefresh() (float64, error) {
+	balance, err := captchaSolver.Balance()
+	if err != nil {
+		return 0, err
+	}
+	balanceCache.mu.Lock()
+	balanceCache.provider = captchaSolver.Name()
+	balanceCache.balance = balance
+	balanceCache.fetched = time.Now()
+	balanceCache.mu.Unlock()
+	return balance, nil
+}
+
+// captchaPollMinDelay and captchaPollMaxDelay are the defaults for
+// CaptchaInitialDelay and CaptchaPollInterval.
+const (
+	captchaPollMinDelay = 3 * time.Second
+	captchaPollMaxDelay = 15 * time.Second
+)
+
+type eZCaptchaTask struct {
+	ClientKey string `json:"clientKey"`
+	Task      struct {
+		Type              string            `json:"type"`
+		WebsiteURL        string            `json:"websiteURL"`
+		WebsiteKey        string            `json:"websiteKey"`
+		SParams           string            `json:"sParams,omitempty"`
+		MinScore          float64           `json:"minScore,omitempty"`
+		PageAction        string            `json:"pageAction,omitempty"`
+		EnterprisePayload map[string]string `json:"enterprisePayload,omitempty"`
+	} `json:"task"`
+}
+
+// captchaErrorFields are included in every EZCaptcha, 2Captcha and AntiCaptcha API
+// response; a non-zero ErrorID means the request was rejected.
+type captchaErrorFields struct {
+	ErrorID          int    `json:"errorId"`
+	ErrorCode        string `json:"errorCode"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+func (f captchaErrorFields) check() error {
+	if f.ErrorID == 0 {
+		return nil
+	}
+	return &captchaAPIError{ID: f.ErrorID, Code: f.ErrorCode, Description: f.ErrorDescription}
+}
+
+// captchaAPIError is a failure reported by the captcha provider itself, such
+// as ERROR_ZERO_BALANCE or ERROR_WRONG_GOOGLEKEY. Retrying will not help.
+type captchaAPIError struct {
+	ID          int
+	Code        string
+	Description string
+}
+
+func (e *captchaAPIError) Error() string {
+	return fmt.Sprintf("captcha provider error %s (errorId %d): %s", e.Code, e.ID, e.Description)
+}
+
+// errNoTaskID is returned when createTask reports success without a task ID.
+var errNoTaskID = errors.New("createTask succeeded but returned no task ID")
+
+type eZCaptchaResult struct {
+	captchaErrorFields
+	Status   string `json:"status"`
+	Solution struct {
+		GRecaptchaResponse string `json:"gRecaptchaResponse"`
+		Token              string `json:"token"`
+	} `json:"solution"`
+}
+
+type twoCaptchaTask struct {
+	ClientKey string `json:"clientKey"`
+	Task      struct {
+		Type              string            `json:"type"`
+		WebsiteURL        string            `json:"websiteURL"`
+		WebsiteKey        string            `json:"websiteKey"`
+		MinScore          float64           `json:"minScore,omitempty"`
+		PageAction        string            `json:"pageAction,omitempty"`
+		EnterprisePayload map[string]string `json:"enterprisePayload,omitempty"`
+	} `json:"task"`
+}
+
+type twoCaptchaResult struct {
+	captchaErrorFields
+	Status   string `json:"status"`
+	Solution struct {
+		GRecaptchaResponse string `json:"gRecaptchaResponse"`
+	} `json:"solution"`
+}
+
+// ezCaptchaSolver solves captchas through api.ez-captcha.com.
+type ezCaptchaSolver struct{}
+
+func (ezCaptchaSolver) Name() string {
+	return "ezcaptcha"
+}
+
+func (ezCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	task := eZCaptchaTask{
+		ClientKey: config.EZCaptchaAPIKey,
+	}
+	task.Task.WebsiteURL = pageURL
+	task.Task.WebsiteKey = siteKey
+
+	switch config.CaptchaType {
+	case captchaTypeTurnstile:
+		task.Task.Type = "AntiTurnstileTaskProxyless"
+	case captchaTypeHCaptcha:
+		task.Task.Type = "HCaptchaTaskProxyless"
+	default:
+		if useRecaptchaV3() {
+			task.Task.Type = "ReCaptchaV3TaskProxyless"
+			task.Task.MinScore = config.RecaptchaMinScore
+			task.Task.PageAction = config.RecaptchaAction
+		} else if useRecaptchaEnterprise() {
+			task.Task.Type = "ReCaptchaV2EnterpriseTaskProxyless"
+			task.Task.EnterprisePayload = config.EnterprisePayload
+		} else {
+			task.Task.Type = "ReCaptchaV2TaskProxyless"
+			task.Task.SParams = `{"id":"0","version":"V2","sitekey":"` + siteKey + `","function":"captchaSubmit","callback":"___grecaptcha_cfg.clients['0']['V']['V']['callback']","pageurl":"` + pageURL + `"}`
+		}
+	}
+
+	taskID, err := createEZCaptchaTask(ctx, task)
+	if err != nil {
+		return "", err
+	}
+
+	return pollCaptchaResult(ctx, captchaProviderEZCaptcha, taskID, func(ctx context.Context) (bool, string, error) {
+		result, err := getEZCaptchaTaskResult(ctx, taskID)
+		if err != nil {
+			return false, "", err
+		}
+		if config.CaptchaType == captchaTypeTurnstile {
+			return result.Status == "ready", result.Solution.Token, nil
+		}
+		return result.Status == "ready", result.Solution.GRecaptchaResponse, nil
+	})
+}
+
+func (ezCaptchaSolver) Balance() (float64, error) {
+	return getClientKeyBalance(config.EZCaptchaBaseURL, config.EZCaptchaAPIKey)
+}
+
+func createEZCaptchaTask(ctx context.Context, task eZCaptchaTask) (string, error) {
+	var createTaskResult struct {
+		captchaErrorFields
+		TaskID string `json:"taskId"`
+	}
+	err := postJSON(ctx, config.EZCaptchaBaseURL+"/createTask", task, &createTaskResult)
+	if err != nil {
+		return "", err
+	}
+	if err := createTaskResult.check(); err != nil {
+		return "", err
+	}
+	// Polling an empty task ID would only run into the captcha timeout
+	if createTaskResult.TaskID == "" {
+		return "", errNoTaskID
+	}
+
+	return createTaskResult.TaskID, nil
+}
+
+func getEZCaptchaTaskResult(ctx context.Context, taskID string) (*eZCaptchaResult, error) {
+	data := map[string]string{
+		"clientKey": config.EZCaptchaAPIKey,
+		"taskId":    taskID,
+	}
+
+	var result eZCaptchaResult
+	err := postJSON(ctx, config.EZCaptchaBaseURL+"/getTaskResult", data, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.check(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// twoCaptchaSolver solves captchas through api.2captcha.com.
+type twoCaptchaSolver struct{}
+
+func (twoCaptchaSolver) Name() string {
+	return "2captcha"
+}
+
+func (twoCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	task := twoCaptchaTask{
+		ClientKey: config.TwoCaptchaAPIKey,
+	}
+	task.Task.WebsiteURL = pageURL
+	task.Task.WebsiteKey = siteKey
+
+	switch config.CaptchaType {
+	case captchaTypeHCaptcha:
+		task.Task.Type = "HCaptchaTaskProxyless"
+	case captchaTypeTurnstile:
+		return "", fmt.Errorf("turnstile is not supported by 2captcha")
+	default:
+		task.Task.Type = "ReCaptchaV2TaskProxyless"
+		if useRecaptchaV3() {
+			task.Task.Type = "RecaptchaV3TaskProxyless"
+			task.Task.MinScore = config.RecaptchaMinScore
+			task.Task.PageAction = config.RecaptchaAction
+		} else if useRecaptchaEnterprise() {
+			task.Task.Type = "RecaptchaV2EnterpriseTaskProxyless"
+			task.Task.EnterprisePayload = config.EnterprisePayload
+		}
+	}
+
+	taskID, err := create2CaptchaTask(ctx, task)
+	if err != nil {
+		return "", err
+	}
+
+	return pollCaptchaResult(ctx, captchaProviderTwoCaptcha, strconv.Itoa(taskID), func(ctx context.Context) (bool, string, error) {
+		result, err := get2CaptchaTaskResult(ctx, taskID)
+		if err != nil {
+			return false, "", err
+		}
+		return result.Status == "ready", result.Solution.GRecaptchaResponse, nil
+	})
+}
+
+// Balance uses the res.php endpoint, which replies with
+// {"status":1,"request":"12.34"} or {"status":0,"request":"ERROR_..."}.
+func (twoCaptchaSolver) Balance() (float64, error) {
+	url := fmt.Sprintf("%s/res.php?key=%s&action=getbalance&json=1", config.TwoCaptchaBaseURL, config.TwoCaptchaAPIKey)
+	resp, err := httpClient().Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status  int    `json:"status"`
+		Request string `json:"request"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error decoding balance response: %v", err)
+	}
+	if result.Status != 1 {
+		return 0, fmt.Errorf("captcha provider error %s", result.Request)
+	}
+
+	balance, err := strconv.ParseFloat(result.Request, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing balance %q: %v", result.Request, err)
+	}
+
+	return balance, nil
+}
+
+func create2CaptchaTask(ctx context.Context, task twoCaptchaTask) (int, error) {
+	var createTaskResult struct {
+		captchaErrorFields
+		TaskID int `json:"taskId"`
+	}
+	err := postJSON(ctx, config.TwoCaptchaBaseURL+"/createTask", task, &createTaskResult)
+	if err != nil {
+		return 0, err
+	}
+	if err := createTaskResult.check(); err != nil {
+		return 0, err
+	}
+	if createTaskResult.TaskID == 0 {
+		return 0, errNoTaskID
+	}
+
+	return createTaskResult.TaskID, nil
+}
+
+func get2CaptchaTaskResult(ctx context.Context, taskID int) (*twoCaptchaResult, error) {
+	data := map[string]interface{}{
+		"clientKey": config.TwoCaptchaAPIKey,
+		"taskId":    taskID,
+	}
+
+	var result twoCaptchaResult
+	err := postJSON(ctx, config.TwoCaptchaBaseURL+"/getTaskResult", data, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.check(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type antiCaptchaTask struct {
+	ClientKey string `json:"clientKey"`
+	Task      struct {
+		Type              string            `json:"type"`
+		WebsiteURL        string            `json:"websiteURL"`
+		WebsiteKey        string            `json:"websiteKey"`
+		MinScore          float64           `json:"minScore,omitempty"`
+		PageAction        string            `json:"pageAction,omitempty"`
+		EnterprisePayload map[string]string `json:"enterprisePayload,omitempty"`
+	} `json:"task"`
+}
+
+type antiCaptchaResult struct {
+	captchaErrorFields
+	Status   string `json:"status"`
+	Solution struct {
+		GRecaptchaResponse string `json:"gRecaptchaResponse"`
+		Token              string `json:"token"`
+	} `json:"solution"`
+}
+
+// antiCaptchaSolver solves captchas through api.anti-captcha.com.
+type antiCaptchaSolver struct{}
+
+func (antiCaptchaSolver) Name() string {
+	return "anticaptcha"
+}
+
+func (antiCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	return solveClientKeyTask(ctx, captchaProviderAntiCaptcha, config.AntiCaptchaBaseURL, config.AntiCaptchaAPIKey, siteKey, pageURL)
+}
+
+func (antiCaptchaSolver) Balance() (float64, error) {
+	return getClientKeyBalance(config.AntiCaptchaBaseURL, config.AntiCaptchaAPIKey)
+}
+
+// capMonsterSolver solves captchas through api.capmonster.cloud, which
+// implements the AntiCaptcha API.
+type capMonsterSolver struct{}
+
+func (capMonsterSolver) Name() string {
+	return "capmonster"
+}
+
+func (capMonsterSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	return solveClientKeyTask(ctx, captchaProviderCapMonster, config.CapMonsterBaseURL, config.CapMonsterAPIKey, siteKey, pageURL)
+}
+
+func (capMonsterSolver) Balance() (float64, error) {
+	return getClientKeyBalance(config.CapMonsterBaseURL, config.CapMonsterAPIKey)
+}
+
+// solveClientKeyTask solves a captcha through the AntiCaptcha-compatible API
+// of provider at baseURL.
+func solveClientKeyTask(ctx context.Context, provider, baseURL, clientKey, siteKey, pageURL string) (string, error) {
+	task := antiCaptchaTask{
+		ClientKey: clientKey,
+	}
+	task.Task.WebsiteURL = pageURL
+	task.Task.WebsiteKey = siteKey
+
+	switch config.CaptchaType {
+	case captchaTypeTurnstile:
+		task.Task.Type = "TurnstileTaskProxyless"
+	case captchaTypeHCaptcha:
+		task.Task.Type = "HCaptchaTaskProxyless"
+	default:
+		task.Task.Type = "RecaptchaV2TaskProxyless"
+		if useRecaptchaV3() {
+			task.Task.Type = "RecaptchaV3TaskProxyless"
+			task.Task.MinScore = config.RecaptchaMinScore
+			task.Task.PageAction = config.RecaptchaAction
+		} else if useRecaptchaEnterprise() {
+			task.Task.Type = "RecaptchaV2EnterpriseTaskProxyless"
+			task.Task.EnterprisePayload = config.EnterprisePayload
+		}
+	}
+
+	taskID, err := createAntiCaptchaTask(ctx, baseURL, task)
+	if err != nil {
+		return "", err
+	}
+
+	return pollCaptchaResult(ctx, provider, strconv.Itoa(taskID), func(ctx context.Context) (bool, string, error) {
+		result, err := getAntiCaptchaTaskResult(ctx, baseURL, clientKey, taskID)
+		if err != nil {
+			return false, "", err
+		}
+		if config.CaptchaType == captchaTypeTurnstile {
+			return result.Status == "ready", result.Solution.Token, nil
+		}
+		return result.Status == "ready", result.Solution.GRecaptchaResponse, nil
+	})
+}
+
+func createAntiCaptchaTask(ctx context.Context, baseURL string, task antiCaptchaTask) (int, error) {
+	var createTaskResult struct {
+		captchaErrorFields
+		TaskID int `json:"taskId"`
+	}
+	err := postJSON(ctx, baseURL+"/createTask", task, &createTaskResult)
+	if err != nil {
+		return 0, err
+	}
+	if err := createTaskResult.check(); err != nil {
+		return 0, err
+	}
+	if createTaskResult.TaskID == 0 {
+		return 0, errNoTaskID
+	}
+
+	return createTaskResult.TaskID, nil
+}
+
+func getAntiCaptchaTaskResult(ctx context.Context, baseURL, clientKey string, taskID int) (*antiCaptchaResult, error) {
+	data := map[string]interface{}{
+		"clientKey": clientKey,
+		"taskId":    taskID,
+	}
+
+	var result antiCaptchaResult
+	err := postJSON(ctx, baseURL+"/getTaskResult", data, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.check(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// getClientKeyBalance calls the getBalance method shared by the EZCaptcha,
+// AntiCaptcha and CapMonster APIs, which replies with {"errorId":0,"balance":12.34}.
+func getClientKeyBalance(baseURL, clientKey string) (float64, error) {
+	data := map[string]string{
+		"clientKey": clientKey,
+	}
+
+	var result struct {
+		captchaErrorFields
+		Balance float64 `json:"balance"`
+	}
+	err := postJSON(context.Background(), baseURL+"/getBalance", data, &result)
+	if err != nil {
+		return 0, err
+	}
+	if err := result.check(); err != nil {
+		return 0, err
+	}
+
+	return result.Balance, nil
+}
+
+// postJSON marshals payload, POSTs it to url and decodes the JSON response
+// into result.
+func postJSON(ctx context.Context, url string, payload, result interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// captchaSlots bounds how many captcha tasks are created and polled at once
+// to MaxConcurrentCaptchas, however many submissions are running. Nil means
+// no limit.
+var captchaSlots chan struct{}
+
+// acquireCaptchaSlot blocks until a captcha task may be started and returns
+// the func that frees the slot again.
+func acquireCaptchaSlot(ctx context.Context) (func(), error) {
+	if captchaSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case captchaSlots <- struct{}{}:
+		return func() { <-captchaSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// captchaSolveStats accumulates solved captchas for cost reporting.
+type captchaSolveStats struct {
+	mu        sync.Mutex
+	solves    int
+	solveTime time.Duration
+}
+
+var captchaStats captchaSolveStats
+
+func (s *captchaSolveStats) record(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.solves++
+	s.solveTime += d
+}
+
+// summary returns the number of solves and the average time between
+// createTask and the ready status.
+func (s *captchaSolveStats) summary() (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.solves == 0 {
+		return 0, 0
+	}
+	return s.solves, s.solveTime / time.Duration(s.solves)
+}
+
+func printCaptchaSummary() {
+	solves, avgSolveTime := captchaStats.summary()
+	cost := float64(solves) * config.CostPerThousand / 1000
+	outputf("Captcha solves: %d, average solve time: %.1fs, estimated cost: $%.4f\n", solves, avgSolveTime.Seconds(), cost)
+}
+
+// captchaPollDelay returns how long to wait before poll attempt n (0-based):
+// CaptchaInitialDelay before the first poll, then doubling up to
+// CaptchaPollInterval, plus up to 10% random jitter so concurrent workers
+// don't poll in lockstep.
+func captchaPollDelay(attempt int) time.Duration {
+	initial, interval := captchaPollMinDelay, captchaPollMaxDelay
+	if config.CaptchaInitialDelay > 0 {
+		initial = time.Duration(config.CaptchaInitialDelay * float64(time.Second))
+	}
+	if config.CaptchaPollInterval > 0 {
+		interval = time.Duration(config.CaptchaPollInterval * float64(time.Second))
+	}
+
+	delay := initial
+	if attempt > 0 {
+		delay = interval
+		if attempt < 8 {
+			if d := initial << attempt; d < interval {
+				delay = d
+			}
+		}
+	}
+	return delay + time.Duration(random.Int63n(int64(delay/10)+1))
+}
+
+// pollCaptchaResult calls getResult with exponential backoff until it reports
+// the task as ready, giving up after MaxCaptchaRetries polls or CaptchaTimeout
+// seconds. None of the providers can cancel a task, so one given up on is
+// abandoned and its ID logged and returned in the error, to dispute a charge
+// for it.
+func pollCaptchaResult(ctx context.Context, provider, taskID string, getResult func(context.Context) (bool, string, error)) (string, error) {
+	debugPrint(fmt.Sprintf("Waiting for CAPTCHA solution of %s task %s...", provider, taskID))
+	startTime := time.Now()
+	deadline := startTime.Add(time.Duration(config.CaptchaTimeout * float64(time.Second)))
+	// A poll still in flight at the deadline is cut short too
+	pollCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	abandon := func(reason string) error {
+		errorf("Abandoned %s captcha task %s without a solution, it may still be billed\n", provider, taskID)
+		return fmt.Errorf("%w%s (%s task %s)", errCaptchaTimeout, reason, provider, taskID)
+	}
+	timeout := fmt.Sprintf(" after %.2f seconds", config.CaptchaTimeout)
+
+	for i := 0; i < config.MaxCaptchaRetries; i++ {
+		wait := captchaPollDelay(i)
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return "", abandon(timeout)
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+
+		debugPrint(fmt.Sprintf("Attempt %d/%d: Checking CAPTCHA solution in %.1fs...", i+1, config.MaxCaptchaRetries, wait.Seconds()))
+		if err := sleepContext(pollCtx, wait); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", abandon(timeout)
+		}
+
+		ready, token, err := getResult(pollCtx)
+		if err != nil {
+			var apiErr *captchaAPIError
+			if errors.As(err, &apiErr) {
+				return "", err
+			}
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			if pollCtx.Err() != nil {
+				return "", abandon(timeout)
+			}
+			debugPrint(fmt.Sprintf("Error getting task result: %v", err))
+			continue
+		}
+
+		if ready {
+			captchaStats.record(time.Since(startTime))
+			return token, nil
+		}
+
+		if time.Since(startTime).Seconds() > config.CaptchaTimeout {
+			return "", abandon(timeout)
+		}
+	}
+
+	return "", abandon(fmt.Sprintf(", no solution after %d attempts", config.MaxCaptchaRetries))
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCaptchaBalance(t *testing.T) {
+	// Mock servers returning each provider's real balance payload
+	var ezCaptchaResponse, twoCaptchaResponse string
+	ezServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/getBalance" {
+			t.Errorf("Expected POST /getBalance, got %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(ezCaptchaResponse))
+	}))
+	defer ezServer.Close()
+	twoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/res.php" || r.URL.Query().Get("action") != "getbalance" {
+			t.Errorf("Expected /res.php?action=getbalance, got %s", r.URL)
+		}
+		w.Write([]byte(twoCaptchaResponse))
+	}))
+	defer twoServer.Close()
+
+	// Temporarily override the API URLs
+	oldEZCaptchaBaseURL := config.EZCaptchaBaseURL
+	oldTwoCaptchaBaseURL := config.TwoCaptchaBaseURL
+	config.EZCaptchaBaseURL = ezServer.URL
+	config.TwoCaptchaBaseURL = twoServer.URL
+	defer func() {
+		config.EZCaptchaBaseURL = oldEZCaptchaBaseURL
+		config.TwoCaptchaBaseURL = oldTwoCaptchaBaseURL
+	}()
+
+	oldCaptchaSolver := captchaSolver
+	defer func() {
+		captchaSolver = oldCaptchaSolver
+	}()
+
+	// Test EZ Captcha
+	captchaSolver = ezCaptchaSolver{}
+	ezCaptchaResponse = `{"errorId":0,"balance":12.34}`
+	balance, err := checkCaptchaBalance()
+	if err != nil {
+		t.Fatalf("checkCaptchaBalance returned an error: %v", err)
+	}
+	if balance != 12.34 {
+		t.Errorf("Expected balance to be 12.34, got %f", balance)
+	}
+
+	ezCaptchaResponse = `{"errorId":1,"errorCode":"ERROR_KEY_DOES_NOT_EXIST","errorDescription":"Account authorization key not found"}`
+	if _, err := checkCaptchaBalance(); err == nil || !strings.Contains(err.Error(), "ERROR_KEY_DOES_NOT_EXIST") {
+		t.Errorf("Expected an ERROR_KEY_DOES_NOT_EXIST error, got %v", err)
+	}
+
+	// Test 2Captcha
+	captchaSolver = twoCaptchaSolver{}
+	twoCaptchaResponse = `{"status":1,"request":"10.5"}`
+	balance, err = checkCaptchaBalance()
+	if err != nil {
+		t.Fatalf("checkCaptchaBalance returned an error: %v", err)
+	}
+	if balance != 10.5 {
+		t.Errorf("Expected balance to be 10.5, got %f", balance)
+	}
+
+	twoCaptchaResponse = `{"status":0,"request":"ERROR_WRONG_USER_KEY"}`
+	if _, err := checkCaptchaBalance(); err == nil || !strings.Contains(err.Error(), "ERROR_WRONG_USER_KEY") {
+		t.Errorf("Expected an ERROR_WRONG_USER_KEY error, got %v", err)
+	}
+}
+
+// balanceCountingSolver counts its balance reads.
+type balanceCountingSolver struct {
+	stubCaptchaSolver
+	reads *int
+}
+
+func (s balanceCountingSolver) Balance() (float64, error) {
+	*s.reads++
+	return s.stubCaptchaSolver.Balance()
+}
+
+func TestCheckCaptchaBalanceCache(t *testing.T) {
+	oldConfig, oldCaptchaSolver := config, captchaSolver
+	defer func() {
+		config, captchaSolver = oldConfig, oldCaptchaSolver
+		balanceCache.fetched = time.Time{}
+	}()
+	config.BalanceCacheTTL = 60
+
+	var reads int
+	captchaSolver = balanceCountingSolver{stubCaptchaSolver{err: io.ErrUnexpectedEOF}, &reads}
+	checkCaptchaBalance()
+	checkCaptchaBalance()
+	if reads != 2 {
+		t.Errorf("Expected failed reads not to be cached, got %d reads", reads)
+	}
+
+	reads = 0
+	captchaSolver = balanceCountingSolver{stubCaptchaSolver{balance: 5}, &reads}
+	for i := 0; i < 3; i++ {
+		if balance, err := checkCaptchaBalance(); err != nil || balance != 5 {
+			t.Fatalf("Expected balance 5, got %v and %v", balance, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("Expected one read within the TTL, got %d", reads)
+	}
+
+	if _, err := forceBalanceRefresh(); err != nil || reads != 2 {
+		t.Errorf("Expected forceBalanceRefresh to read again, got %d reads and %v", reads, err)
+	}
+
+	balanceCache.fetched = time.Now().Add(-time.Minute)
+	checkCaptchaBalance()
+	if reads != 3 {
+		t.Errorf("Expected an expired balance to be read again, got %d reads", reads)
+	}
+}
+
+func TestAntiCaptchaSolverBalance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/getBalance" {
+			t.Errorf("Expected request to /getBalance, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"errorId":0,"balance":3.25}`))
+	}))
+	defer server.Close()
+
+	oldAntiCaptchaBaseURL := config.AntiCaptchaBaseURL
+	config.AntiCaptchaBaseURL = server.URL
+	defer func() {
+		config.AntiCaptchaBaseURL = oldAntiCaptchaBaseURL
+	}()
+
+	balance, err := antiCaptchaSolver{}.Balance()
+	if err != nil {
+		t.Fatalf("Balance returned an error: %v", err)
+	}
+	if balance != 3.25 {
+		t.Errorf("Expected balance to be 3.25, got %f", balance)
+	}
+}
+
+func TestNewCaptchaSolver(t *testing.T) {
+	oldConfig := config
+	defer func() {
+		config = oldConfig
+	}()
+
+	tests := []struct {
+		useTwoCaptcha  bool
+		useAntiCaptcha bool
+		captchaType    string
+		want           string
+	}{
+		{false, false, captchaTypeRecaptchaV2, "ezcaptcha"},
+		{true, false, captchaTypeRecaptchaV2, "2captcha"},
+		{true, false, captchaTypeHCaptcha, "2captcha"},
+		{true, false, captchaTypeTurnstile, "ezcaptcha"},
+		{false, true, captchaTypeTurnstile, "anticaptcha"},
+	}
+	for _, tt := range tests {
+		config.UseTwoCaptcha = tt.useTwoCaptcha
+		config.UseAntiCaptcha = tt.useAntiCaptcha
+		config.CaptchaType = tt.captchaType
+		if got := newCaptchaSolver().Name(); got != tt.want {
+			t.Errorf("newCaptchaSolver() with UseTwoCaptcha=%v, UseAntiCaptcha=%v, CaptchaType=%s = %s, want %s", tt.useTwoCaptcha, tt.useAntiCaptcha, tt.captchaType, got, tt.want)
+		}
+	}
+
+	config.UseTwoCaptcha, config.UseAntiCaptcha, config.UseCapMonster = false, false, true
+	if got := newCaptchaSolver().Name(); got != "capmonster" {
+		t.Errorf("newCaptchaSolver() with UseCapMonster = %s, want capmonster", got)
+	}
+}
+
+func TestCapMonsterSolver(t *testing.T) {
+	var task map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["clientKey"] != "capmonster_key" {
+			t.Errorf("Expected the CapMonster key, got %v", body["clientKey"])
+		}
+		switch r.URL.Path {
+		case "/createTask":
+			task, _ = body["task"].(map[string]interface{})
+			w.Write([]byte(`{"errorId":0,"taskId":7}`))
+		case "/getTaskResult":
+			w.Write([]byte(`{"errorId":0,"status":"ready","solution":{"gRecaptchaResponse":"capmonster_token"}}`))
+		case "/getBalance":
+			w.Write([]byte(`{"errorId":0,"balance":1.5}`))
+		}
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CapMonsterBaseURL = server.URL
+	config.CapMonsterAPIKey = "capmonster_key"
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.CaptchaInitialDelay = 0.001
+	config.CaptchaTimeout = 5
+	config.MaxCaptchaRetries = 3
+
+	token, err := capMonsterSolver{}.Solve(context.Background(), "site_key", "https://test.com/promo")
+	if err != nil || token != "capmonster_token" {
+		t.Fatalf("Expected capmonster_token, got %q: %v", token, err)
+	}
+	if task["type"] != "RecaptchaV2TaskProxyless" || task["websiteKey"] != "site_key" {
+		t.Errorf("Unexpected task %v", task)
+	}
+
+	balance, err := capMonsterSolver{}.Balance()
+	if err != nil || balance != 1.5 {
+		t.Errorf("Expected a balance of 1.5, got %v: %v", balance, err)
+	}
+}
+
+func TestGetEZCaptchaTaskResultAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errorId":1,"errorCode":"ERROR_ZERO_BALANCE","errorDescription":"Account has zero balance"}`))
+	}))
+	defer server.Close()
+
+	oldEZCaptchaBaseURL := config.EZCaptchaBaseURL
+	config.EZCaptchaBaseURL = server.URL
+	defer func() {
+		config.EZCaptchaBaseURL = oldEZCaptchaBaseURL
+	}()
+
+	_, err := getEZCaptchaTaskResult(context.Background(), "123")
+	apiErr, ok := err.(*captchaAPIError)
+	if !ok {
+		t.Fatalf("Expected a *captchaAPIError, got %v", err)
+	}
+	if apiErr.Code != "ERROR_ZERO_BALANCE" {
+		t.Errorf("Expected error code ERROR_ZERO_BALANCE, got %s", apiErr.Code)
+	}
+	if !strings.Contains(err.Error(), "zero balance") {
+		t.Errorf("Expected error to include the description, got %s", err)
+	}
+}
+
+func TestCaptchaSolveStatsSummary(t *testing.T) {
+	var s captchaSolveStats
+	if solves, avg := s.summary(); solves != 0 || avg != 0 {
+		t.Errorf("Expected empty summary, got %d solves averaging %v", solves, avg)
+	}
+
+	s.record(2 * time.Second)
+	s.record(4 * time.Second)
+	solves, avg := s.summary()
+	if solves != 2 || avg != 3*time.Second {
+		t.Errorf("Expected 2 solves averaging 3s, got %d averaging %v", solves, avg)
+	}
+}
+
+func TestCaptchaPollDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{0, 3 * time.Second},
+		{1, 6 * time.Second},
+		{2, 12 * time.Second},
+		{3, 15 * time.Second},
+		{20, 15 * time.Second},
+	}
+	for _, tt := range tests {
+		got := captchaPollDelay(tt.attempt)
+		if got < tt.base || got > tt.base+tt.base/10 {
+			t.Errorf("captchaPollDelay(%d) = %v, want within 10%% above %v", tt.attempt, got, tt.base)
+		}
+	}
+}
+
+func TestCaptchaPollDelayConfigured(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaInitialDelay = 0.5
+	config.CaptchaPollInterval = 1.5
+
+	for attempt, base := range []time.Duration{500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 1500 * time.Millisecond} {
+		got := captchaPollDelay(attempt)
+		if got < base || got > base+base/10 {
+			t.Errorf("captchaPollDelay(%d) = %v, want within 10%% above %v", attempt, got, base)
+		}
+	}
+}
+
+func TestPollCaptchaResultUsesConfiguredDelays(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaInitialDelay = 0.001
+	config.CaptchaPollInterval = 0.002
+	config.CaptchaTimeout = 5
+	config.MaxCaptchaRetries = 5
+
+	polls := 0
+	start := time.Now()
+	token, err := pollCaptchaResult(context.Background(), "test", "task_1", func(context.Context) (bool, string, error) {
+		polls++
+		return polls == 3, "token", nil
+	})
+	if err != nil || token != "token" || polls != 3 {
+		t.Fatalf("Expected the token on the third poll, got %q after %d polls: %v", token, polls, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected polling with millisecond delays to finish quickly, took %v", elapsed)
+	}
+}
+
+func TestRecaptchaV3Task(t *testing.T) {
+	var task map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Task map[string]interface{} `json:"task"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Error decoding createTask body: %v", err)
+		}
+		task = body.Task
+		// Reject the task so Solve returns without polling
+		w.Write([]byte(`{"errorId":1,"errorCode":"ERROR_ZERO_BALANCE","errorDescription":"Account has zero balance"}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	config.TwoCaptchaBaseURL = server.URL
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaVersion = recaptchaVersionV3
+	config.RecaptchaAction = "submit"
+	config.RecaptchaMinScore = 0.9
+	defer func() { config = oldConfig }()
+
+	if _, err := (twoCaptchaSolver{}).Solve(context.Background(), "site_key", "https://example.com/"); err == nil {
+		t.Fatal("Expected the rejected task to return an error")
+	}
+	if task["type"] != "RecaptchaV3TaskProxyless" {
+		t.Errorf("Expected a RecaptchaV3TaskProxyless task, got %v", task["type"])
+	}
+	if task["pageAction"] != "submit" || task["minScore"] != 0.9 {
+		t.Errorf("Expected pageAction submit and minScore 0.9, got %v and %v", task["pageAction"], task["minScore"])
+	}
+}
+
+func TestRecaptchaEnterpriseTask(t *testing.T) {
+	var task map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Task map[string]interface{} `json:"task"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		task = body.Task
+		w.Write([]byte(`{"errorId":1,"errorCode":"ERROR_ZERO_BALANCE","errorDescription":"Account has zero balance"}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EZCaptchaBaseURL, config.TwoCaptchaBaseURL, config.AntiCaptchaBaseURL = server.URL, server.URL, server.URL
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaVersion = recaptchaVersionV2
+	config.RecaptchaEnterprise = true
+	config.EnterprisePayload = map[string]string{"s": "s_token"}
+
+	for solver, taskType := range map[CaptchaSolver]string{
+		ezCaptchaSolver{}:   "ReCaptchaV2EnterpriseTaskProxyless",
+		twoCaptchaSolver{}:  "RecaptchaV2EnterpriseTaskProxyless",
+		antiCaptchaSolver{}: "RecaptchaV2EnterpriseTaskProxyless",
+	} {
+		task = nil
+		solver.Solve(context.Background(), "site_key", "https://example.com/")
+		if task["type"] != taskType {
+			t.Errorf("%s: expected a %s task, got %v", solver.Name(), taskType, task["type"])
+		}
+		payload, _ := task["enterprisePayload"].(map[string]interface{})
+		if payload["s"] != "s_token" {
+			t.Errorf("%s: expected the enterprise payload, got %v", solver.Name(), task["enterprisePayload"])
+		}
+	}
+}
+
+func TestSolveFailsFastWithoutTaskID(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/getTaskResult" {
+			polls++
+		}
+		w.Write([]byte(`{"errorId":0}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EZCaptchaBaseURL, config.TwoCaptchaBaseURL = server.URL, server.URL
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.CaptchaTimeout = 60
+	config.MaxCaptchaRetries = 5
+
+	for _, solver := range []CaptchaSolver{ezCaptchaSolver{}, twoCaptchaSolver{}} {
+		start := time.Now()
+		_, err := solver.Solve(context.Background(), "site_key", "https://test.com/promo")
+		if err != errNoTaskID {
+			t.Errorf("%s: expected errNoTaskID, got %v", solver.Name(), err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: expected to fail fast, took %v", solver.Name(), elapsed)
+		}
+	}
+	if polls != 0 {
+		t.Errorf("Expected no getTaskResult polls, got %d", polls)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// testCaptcha solves one captcha for the first promo target and writes the
+// token, the solve time and the cost to w, for -test-captcha. The cost is the
+// change in balance when the provider reports one, otherwise the estimate
+// from CostPerThousand.
+func testCaptcha(ctx context.Context, w io.Writer) error {
+	target := promoTargets()[0]
+	fmt.Fprintf(w, "Solving one %s captcha for site key %s on %s with %s...\n", config.CaptchaType, target.siteKey(), target.PromoURL, captchaSolver.Name())
+
+	before, balanceErr := forceBalanceRefresh()
+	start := time.Now()
+	token, provider, err := solveCaptcha(ctx, target)
+	elapsed := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("no token after %.1fs: %w", elapsed.Seconds(), err)
+	}
+
+	fmt.Fprintf(w, "Token:      %s\n", truncateToken(token))
+	fmt.Fprintf(w, "Solved by:  %s in %.1fs\n", provider, elapsed.Seconds())
+	var after float64
+	if balanceErr == nil {
+		after, balanceErr = forceBalanceRefresh()
+	}
+	switch {
+	case balanceErr == nil:
+		// Other clients of the same account may have spent some of it too
+		fmt.Fprintf(w, "Cost:       $%.4f (balance $%.4f -> $%.4f)\n", before-after, before, after)
+	case config.CostPerThousand > 0:
+		fmt.Fprintf(w, "Cost:       $%.4f (estimated from cost_per_thousand)\n", config.CostPerThousand/1000)
+	default:
+		fmt.Fprintf(w, "Cost:       unknown, the balance could not be read: %v\n", balanceErr)
+	}
+	return nil
+}
+
+// truncateToken shortens a captcha token for printing, keeping its length.
+func truncateToken(token string) string {
+	const keep = 24
+	if len(token) <= keep {
+		return token
+	}
+	return fmt.Sprintf("%s... (%d characters)", token[:keep], len(token))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// spendingCaptchaSolver charges for every solve out of its balance.
+type spendingCaptchaSolver struct {
+	balance float64
+}
+
+func (s *spendingCaptchaSolver) Name() string { return "spending" }
+
+func (s *spendingCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	s.balance -= 0.003
+	return strings.Repeat("t", 500), nil
+}
+
+func (s *spendingCaptchaSolver) Balance() (float64, error) { return s.balance, nil }
+
+func TestTestCaptcha(t *testing.T) {
+	oldConfig, oldCaptchaSolver := config, captchaSolver
+	defer func() { config, captchaSolver = oldConfig, oldCaptchaSolver }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaSiteKey = "site_key"
+	config.MonsterPromoURL = "https://example.com/promo"
+	captchaSolver = &spendingCaptchaSolver{balance: 1}
+
+	var out strings.Builder
+	if err := testCaptcha(context.Background(), &out); err != nil {
+		t.Fatalf("testCaptcha returned an error: %v", err)
+	}
+	for _, want := range []string{"site_key", "(500 characters)", "Solved by:  spending", "Cost:       $0.0030"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), strings.Repeat("t", 100)) {
+		t.Errorf("Expected the token to be truncated, got:\n%s", out.String())
+	}
+}
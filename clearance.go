@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultClearanceLifetime is assumed for cf_clearance cookies that arrive
+// without an explicit expiry.
+const defaultClearanceLifetime = 30 * time.Minute
+
+// clearanceJar is an http.CookieJar that keeps the cf_clearance cookie per
+// host until it expires, so later entries can reuse it instead of starting
+// cold. All other cookies are ignored.
+type clearanceJar struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	cookies map[string]*http.Cookie
+}
+
+func newClearanceJar(now func() time.Time) *clearanceJar {
+	return &clearanceJar{
+		now:     now,
+		cookies: make(map[string]*http.Cookie),
+	}
+}
+
+// SetCookies implements http.CookieJar.
+func (j *clearanceJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, cookie := range cookies {
+		if cookie.Name != "cf_clearance" {
+			continue
+		}
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(j.cookies, u.Hostname())
+			continue
+		}
+
+		expires := j.now().Add(defaultClearanceLifetime)
+		if cookie.MaxAge > 0 {
+			expires = j.now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		} else if !cookie.Expires.IsZero() {
+			expires = cookie.Expires
+		}
+		j.cookies[u.Hostname()] = &http.Cookie{Name: cookie.Name, Value: cookie.Value, Expires: expires}
+	}
+}
+
+// Cookies implements http.CookieJar.
+func (j *clearanceJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cookie, ok := j.cookies[u.Hostname()]
+	if !ok {
+		return nil
+	}
+	if !j.now().Before(cookie.Expires) {
+		delete(j.cookies, u.Hostname())
+		return nil
+	}
+	return []*http.Cookie{{Name: cookie.Name, Value: cookie.Value}}
+}
+
+// clearance returns the unexpired cf_clearance value for u, if any.
+func (j *clearanceJar) clearance(u *url.URL) string {
+	for _, cookie := range j.Cookies(u) {
+		return cookie.Value
+	}
+	return ""
+}
+
+var (
+	clearanceJarsMu sync.Mutex
+	clearanceJars   = make(map[string]*clearanceJar)
+)
+
+// clearanceJarFor returns the jar shared by every entry sent through
+// proxyAddr. Cloudflare ties cf_clearance to the client IP, so each exit
+// proxy gets its own jar.
+func clearanceJarFor(proxyAddr string) *clearanceJar {
+	clearanceJarsMu.Lock()
+	defer clearanceJarsMu.Unlock()
+
+	jar, ok := clearanceJars[proxyAddr]
+	if !ok {
+		jar = newClearanceJar(time.Now)
+		clearanceJars[proxyAddr] = jar
+	}
+	return jar
+}
+
+// sessionJar is the http.CookieJar of one entry. It keeps every cookie the
+// promo site sets, such as session IDs and CSRF tokens, and hands
+// cf_clearance to the clearance jar shared by every entry on the same proxy.
+type sessionJar struct {
+	shared  *clearanceJar
+	cookies *cookiejar.Jar
+}
+
+func newSessionJar(shared *clearanceJar) *sessionJar {
+	// cookiejar.New only fails on invalid options
+	cookies, _ := cookiejar.New(nil)
+	return &sessionJar{shared: shared, cookies: cookies}
+}
+
+// SetCookies implements http.CookieJar.
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	var own []*http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name != "cf_clearance" {
+			own = append(own, cookie)
+		}
+	}
+	j.shared.SetCookies(u, cookies)
+	j.cookies.SetCookies(u, own)
+}
+
+// Cookies implements http.CookieJar.
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	return append(j.cookies.Cookies(u), j.shared.Cookies(u)...)
+}
+
+// clearance returns the unexpired cf_clearance value for u, if any.
+func (j *sessionJar) clearance(u *url.URL) string {
+	return j.shared.clearance(u)
+}
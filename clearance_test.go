@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestClearanceJarExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	jar := newClearanceJar(func() time.Time { return now })
+	u, _ := url.Parse("https://promo.test.com/submit")
+
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "ignored"},
+		{Name: "cf_clearance", Value: "first", MaxAge: 600},
+	})
+	if got := jar.clearance(u); got != "first" {
+		t.Fatalf("Expected clearance 'first', got %q", got)
+	}
+	if cookies := jar.Cookies(u); len(cookies) != 1 {
+		t.Errorf("Expected only the clearance cookie, got %v", cookies)
+	}
+
+	now = now.Add(9 * time.Minute)
+	if got := jar.clearance(u); got != "first" {
+		t.Errorf("Expected clearance to still be valid after 9 minutes, got %q", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := jar.clearance(u); got != "" {
+		t.Errorf("Expected clearance to expire after 10 minutes, got %q", got)
+	}
+
+	// Without MaxAge or Expires the default lifetime applies
+	jar.SetCookies(u, []*http.Cookie{{Name: "cf_clearance", Value: "second"}})
+	now = now.Add(defaultClearanceLifetime - time.Second)
+	if got := jar.clearance(u); got != "second" {
+		t.Errorf("Expected clearance 'second' within the default lifetime, got %q", got)
+	}
+	now = now.Add(time.Second)
+	if got := jar.clearance(u); got != "" {
+		t.Errorf("Expected clearance to expire after the default lifetime, got %q", got)
+	}
+}
+
+func TestClearanceJarForIsPerProxy(t *testing.T) {
+	if clearanceJarFor("a:1") != clearanceJarFor("a:1") {
+		t.Error("Expected the same jar for the same proxy")
+	}
+	if clearanceJarFor("a:1") == clearanceJarFor("b:2") {
+		t.Error("Expected different jars for different proxies")
+	}
+}
+
+func TestSessionJarSharesOnlyClearance(t *testing.T) {
+	shared := newClearanceJar(time.Now)
+	first, second := newSessionJar(shared), newSessionJar(shared)
+	u, _ := url.Parse("https://promo.test.com/submit")
+
+	first.SetCookies(u, []*http.Cookie{
+		{Name: "session_id", Value: "first_session"},
+		{Name: "cf_clearance", Value: "clearance"},
+	})
+	if cookies := first.Cookies(u); len(cookies) != 2 {
+		t.Errorf("Expected the session and clearance cookies, got %v", cookies)
+	}
+	cookies := second.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "cf_clearance" || second.clearance(u) != "clearance" {
+		t.Errorf("Expected another entry to share only the clearance cookie, got %v", cookies)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// cloudflareRulesPerPage is the largest page the email routing API returns.
+const cloudflareRulesPerPage = 50
+
+// maxAliasAttempts is how many aliases are generated before giving up on
+// finding one that is not already taken.
+const maxAliasAttempts = 5
+
+// cloudflareRateLimitRetries is how many times a rule creation that
+// Cloudflare rate limits is retried.
+const cloudflareRateLimitRetries = 5
+
+// ruleNamePrefix starts the name of every rule created by
+// createCloudflareEmailAlias and is followed by the run ID, ruleCreatedAt and
+// an RFC 3339 timestamp.
+const (
+	ruleNamePrefix = "Promogen run "
+	ruleCreatedAt  = " created at "
+)
+
+// legacyRuleNamePrefix started the names of rules created before they
+// carried a run ID, and is followed directly by the timestamp.
+const legacyRuleNamePrefix = "Rule created at "
+
+var (
+	knownAliasesMu sync.Mutex
+	// knownAliases holds every address with a forwarding rule. It is nil until
+	// loaded from Cloudflare by the first reserveAlias call.
+	knownAliases map[string]bool
+)
+
+// forwardCount is how many aliases have been given a forward-to address.
+var forwardCount atomic.Uint64
+
+// forwardAddresses returns the forward-to addresses from the comma-separated
+// ForwardToEmail followed by those in ForwardToEmails.
+func forwardAddresses() []string {
+	var addresses []string
+	for _, address := range append(strings.Split(config.ForwardToEmail, ","), config.ForwardToEmails...) {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Action types Cloudflare email routing rules accept.
+const (
+	aliasActionForward = "forward"
+	aliasActionWorker  = "worker"
+	aliasActionDrop    = "drop"
+)
+
+// AliasAction is one action of the forwarding rule created for each alias,
+// e.g. forwarding to an inbox or handing the mail to an Email Worker.
+type AliasAction struct {
+	Type string `json:"type"`
+	// Value holds the forward-to addresses of a forward action, or the
+	// script name of a worker action. A forward action without any uses the
+	// next of forwardAddresses
+	Value []string `json:"value,omitempty"`
+}
+
+// aliasRuleActions returns the actions of a new alias rule: AliasActions
+// when set, otherwise a single forward to the next forward-to address.
+func aliasRuleActions() []AliasAction {
+	if len(config.AliasActions) == 0 {
+		return []AliasAction{{Type: aliasActionForward, Value: []string{nextForwardAddress()}}}
+	}
+	actions := make([]AliasAction, len(config.AliasActions))
+	for i, action := range config.AliasActions {
+		if action.Type == aliasActionForward && len(action.Value) == 0 {
+			action.Value = []string{nextForwardAddress()}
+		}
+		actions[i] = action
+	}
+	return actions
+}
+
+// aliasActionsNeedForwardAddress reports whether any alias rule forwards to
+// the forward_to_email addresses.
+func aliasActionsNeedForwardAddress() bool {
+	if len(config.AliasActions) == 0 {
+		return true
+	}
+	for _, action := range config.AliasActions {
+		if action.Type == aliasActionForward && len(action.Value) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAliasActions returns a description of every problem with
+// AliasActions.
+func checkAliasActions() []string {
+	var errs []string
+	for i, action := range config.AliasActions {
+		switch action.Type {
+		case aliasActionForward:
+			for _, address := range action.Value {
+				if !emailAddressRegex.MatchString(address) {
+					errs = append(errs, fmt.Sprintf("Alias action %d forward address %q is not a valid email address", i+1, address))
+				}
+			}
+		case aliasActionWorker:
+			if len(action.Value) != 1 || action.Value[0] == "" {
+				errs = append(errs, fmt.Sprintf("Alias action %d needs the name of exactly one worker", i+1))
+			}
+		case aliasActionDrop:
+			if len(config.AliasActions) > 1 {
+				errs = append(errs, fmt.Sprintf("Alias action %d drops the mail and cannot be combined with other actions", i+1))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("Unsupported alias action %d type %q (expected forward, worker or drop)", i+1, action.Type))
+		}
+	}
+	return errs
+}
+
+// nextForwardAddress picks the forward-to address for a new alias, cycling
+// through forwardAddresses so each inbox gets an equal share.
+func nextForwardAddress() string {
+	addresses := forwardAddresses()
+	if len(addresses) == 0 {
+		return ""
+	}
+	n := forwardCount.Add(1) - 1
+	return addresses[n%uint64(len(addresses))]
+}
+
+// cloudflareRetryDelay returns how long to wait before retry attempt n
+// (0-based) of a rate limited request. Retry-After takes precedence over the
+// reset time in the t= parameter of the RateLimit header, and either over the
+// default exponential backoff.
+func cloudflareRetryDelay(header http.Header, attempt int) time.Duration {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		return retryDelay(retryAfter, attempt)
+	}
+	for _, param := range strings.Split(header.Get("Ratelimit"), ";") {
+		if reset, ok := strings.CutPrefix(strings.TrimSpace(param), "t="); ok {
+			return retryDelay(reset, attempt)
+		}
+	}
+	return retryDelay("", attempt)
+}
+
+// cloudflareErrorMessage returns the errors[].message values of a Cloudflare
+// API error body, or the body itself when it has none.
+func cloudflareErrorMessage(body []byte) string {
+	var errorResponse struct {
+		Errors []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err != nil || len(errorResponse.Errors) == 0 {
+		return string(body)
+	}
+	messages := make([]string, len(errorResponse.Errors))
+	for i, e := range errorResponse.Errors {
+		messages[i] = fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// cloudflareListedRule is a forwarding rule as returned by the list endpoint.
+type cloudflareListedRule struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag"`
+	cloudflareEmailRule
+}
+
+// ruleID returns the ID used to delete the rule.
+func (r cloudflareListedRule) ruleID() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Tag
+}
+
+// address returns the address the rule matches, or "" for rules that do not
+// match a single address, such as the catch-all rule.
+func (r cloudflareListedRule) address() string {
+	for _, m := range r.Matchers {
+		if m.Field == "to" && m.Type == "literal" {
+			return strings.ToLower(m.Value)
+		}
+	}
+	return ""
+}
+
+// ruleName returns the name of a rule created at t by the run with the given
+// ID.
+func ruleName(runID string, t time.Time) string {
+	return ruleNamePrefix + runID + ruleCreatedAt + t.Format(time.RFC3339)
+}
+
+// parseRuleName returns the run ID and creation time in a rule name. It
+// returns false for rules that were not created by this tool. Rules named
+// before run IDs were added have an empty run ID.
+func parseRuleName(name string) (string, time.Time, bool) {
+	var runID, stamp string
+	if rest, ok := strings.CutPrefix(name, ruleNamePrefix); ok {
+		if runID, stamp, ok = strings.Cut(rest, ruleCreatedAt); !ok || runID == "" {
+			return "", time.Time{}, false
+		}
+	} else if stamp, ok = strings.CutPrefix(name, legacyRuleNamePrefix); !ok {
+		return "", time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return runID, t, true
+}
+
+// listEmailRules returns every forwarding rule in the zone, following the
+// pages of GET /email/routing/rules.
+func listEmailRules(ctx context.Context) ([]cloudflareListedRule, error) {
+	var rules []cloudflareListedRule
+	client := httpClient()
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/zones/%s/email/routing/rules?page=%d&per_page=%d", config.CloudflareAPIBaseURL, config.CloudflareZoneID, page, cloudflareRulesPerPage)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+config.CloudflareAPIToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error sending request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("error listing email rules, status code: %d, response: %s", resp.StatusCode, cloudflareErrorMessage(body))
+		}
+
+		var listResponse struct {
+			Result     []cloudflareListedRule `json:"result"`
+			ResultInfo struct {
+				TotalCount int `json:"total_count"`
+			} `json:"result_info"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&listResponse)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding response: %v", err)
+		}
+
+		rules = append(rules, listResponse.Result...)
+		if len(listResponse.Result) == 0 || page*cloudflareRulesPerPage >= listResponse.ResultInfo.TotalCount {
+			return rules, nil
+		}
+	}
+}
+
+// reserveAlias returns a new address on EmailDomain that no existing rule
+// forwards yet, regenerating the alias on a collision. The address is
+// remembered so later calls do not hand it out again.
+func reserveAlias(ctx context.Context) (string, error) {
+	knownAliasesMu.Lock()
+	defer knownAliasesMu.Unlock()
+
+	if knownAliases == nil {
+		rules, err := listEmailRules(ctx)
+		if err != nil {
+			return "", err
+		}
+		knownAliases = make(map[string]bool, len(rules))
+		for _, rule := range rules {
+			if address := rule.address(); address != "" {
+				knownAliases[address] = true
+			}
+		}
+	}
+
+	for attempt := 0; attempt < maxAliasAttempts; attempt++ {
+		alias, err := generateAlias()
+		if err != nil {
+			return "", fmt.Errorf("error generating random alias: %v", err)
+		}
+		email := fmt.Sprintf("%s@%s", alias, config.EmailDomain)
+		if knownAliases[strings.ToLower(email)] {
+			debugPrint(fmt.Sprintf("Alias %s already exists, generating another", email))
+			continue
+		}
+		knownAliases[strings.ToLower(email)] = true
+		return email, nil
+	}
+	return "", fmt.Errorf("no free alias found after %d attempts", maxAliasAttempts)
+}
+
+// ownAliasRule is a forwarding rule created by this tool, with the run ID
+// and creation time from its name.
+type ownAliasRule struct {
+	cloudflareListedRule
+	RunID     string
+	CreatedAt time.Time
+}
+
+// listOwnAliasRules returns the rules created by this tool more than
+// olderThan ago whose run ID starts with runPrefix, oldest first. Rules with
+// any other name are left out.
+func listOwnAliasRules(ctx context.Context, olderThan time.Duration, runPrefix string) ([]ownAliasRule, error) {
+	rules, err := listEmailRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var own []ownAliasRule
+	for _, rule := range rules {
+		runID, createdAt, ok := parseRuleName(rule.Name)
+		if !ok || !createdAt.Before(cutoff) || !strings.HasPrefix(runID, runPrefix) {
+			continue
+		}
+		own = append(own, ownAliasRule{cloudflareListedRule: rule, RunID: runID, CreatedAt: createdAt})
+	}
+	sort.SliceStable(own, func(i, j int) bool { return own[i].CreatedAt.Before(own[j].CreatedAt) })
+	return own, nil
+}
+
+// printAliasRules writes rules to w as a table.
+func printAliasRules(w io.Writer, rules []ownAliasRule) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE ID\tALIAS\tRUN ID\tCREATED")
+	for _, rule := range rules {
+		runID := rule.RunID
+		if runID == "" {
+			runID = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rule.ruleID(), rule.address(), runID, rule.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// deleteAliasRules deletes rules and returns how many were deleted, stopping
+// at the first failure.
+func deleteAliasRules(ctx context.Context, rules []ownAliasRule) (int, error) {
+	deleted := 0
+	for _, rule := range rules {
+		if err := deleteCloudflareEmailAlias(ctx, rule.ruleID()); err != nil {
+			return deleted, fmt.Errorf("error deleting rule %s: %v", rule.ruleID(), err)
+		}
+		debugPrint(fmt.Sprintf("Deleted rule %s for %s", rule.ruleID(), rule.address()))
+		deleted++
+
+		knownAliasesMu.Lock()
+		if knownAliases != nil {
+			delete(knownAliases, rule.address())
+		}
+		knownAliasesMu.Unlock()
+	}
+	return deleted, nil
+}
+
+// pruneExpiredAliases deletes the rules created by this tool more than
+// olderThan ago and returns how many were deleted. When runID is not empty
+// only the rules of that run are deleted. Rules with any other name are left
+// alone.
+func pruneExpiredAliases(ctx context.Context, olderThan time.Duration, runID string) (int, error) {
+	rules, err := listOwnAliasRules(ctx, olderThan, runID)
+	if err != nil {
+		return 0, err
+	}
+	// The prefix also matches longer run IDs
+	var expired []ownAliasRule
+	for _, rule := range rules {
+		if runID == "" || rule.RunID == runID {
+			expired = append(expired, rule)
+		}
+	}
+	return deleteAliasRules(ctx, expired)
+}
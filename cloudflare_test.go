@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCloudflareListServer returns a mock Cloudflare API that lists rules one
+// page at a time and records the IDs of deleted rules.
+func newCloudflareListServer(t *testing.T, rules []map[string]interface{}, deleted *[]string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			start := (page - 1) * perPage
+			end := start + perPage
+			if start > len(rules) {
+				start = len(rules)
+			}
+			if end > len(rules) {
+				end = len(rules)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":     true,
+				"result":      rules[start:end],
+				"result_info": map[string]int{"page": page, "per_page": perPage, "count": end - start, "total_count": len(rules)},
+			})
+		case "DELETE":
+			*deleted = append(*deleted, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": map[string]string{"id": "new_rule"}})
+		}
+	}))
+
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	t.Cleanup(func() {
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		knownAliases = nil
+		server.Close()
+	})
+}
+
+func testRule(id, address string, createdAt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       id,
+		"name":     "Rule created at " + createdAt.Format(time.RFC3339),
+		"enabled":  true,
+		"matchers": []map[string]string{{"field": "to", "type": "literal", "value": address}},
+		"actions":  []map[string]interface{}{{"type": "forward", "value": []string{"forward@example.com"}}},
+	}
+}
+
+func TestListEmailRulesPaginates(t *testing.T) {
+	var rules []map[string]interface{}
+	for i := 0; i < 120; i++ {
+		rules = append(rules, testRule(fmt.Sprintf("rule_%d", i), fmt.Sprintf("alias%d@test.com", i), time.Now()))
+	}
+	newCloudflareListServer(t, rules, nil)
+
+	listed, err := listEmailRules(context.Background())
+	if err != nil {
+		t.Fatalf("listEmailRules returned an error: %v", err)
+	}
+	if len(listed) != 120 {
+		t.Fatalf("Expected 120 rules across 3 pages, got %d", len(listed))
+	}
+	if listed[119].ruleID() != "rule_119" || listed[119].address() != "alias119@test.com" {
+		t.Errorf("Unexpected last rule %s for %s", listed[119].ruleID(), listed[119].address())
+	}
+}
+
+func TestReserveAliasRegeneratesOnCollision(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EmailDomain = "test.com"
+	config.AliasPattern = aliasPatternCustom
+	config.AliasCharset = "ab"
+	config.AliasLength = 1
+
+	newCloudflareListServer(t, []map[string]interface{}{testRule("rule_a", "a@test.com", time.Now())}, nil)
+
+	reserved := 0
+	for i := 0; i < 10; i++ {
+		email, err := reserveAlias(context.Background())
+		if err != nil {
+			// Every attempt drew the taken alias, which happens 1 time in 32
+			continue
+		}
+		if email != "b@test.com" {
+			t.Fatalf("Expected the only free alias b@test.com, got %s", email)
+		}
+		reserved++
+		// Free b again so the next call may have to skip past a
+		delete(knownAliases, email)
+	}
+	if reserved == 0 {
+		t.Fatal("Expected reserveAlias to find the free alias")
+	}
+
+	knownAliases["b@test.com"] = true
+	if _, err := reserveAlias(context.Background()); err == nil {
+		t.Error("Expected an error once every alias is taken")
+	}
+}
+
+func TestPruneExpiredAliases(t *testing.T) {
+	var deleted []string
+	now := time.Now()
+	rules := []map[string]interface{}{
+		testRule("old", "old@test.com", now.Add(-72*time.Hour)),
+		testRule("new", "new@test.com", now.Add(-time.Hour)),
+		{"id": "manual", "name": "My inbox", "matchers": []map[string]string{{"field": "to", "type": "literal", "value": "me@test.com"}}},
+	}
+	newCloudflareListServer(t, rules, &deleted)
+
+	n, err := pruneExpiredAliases(context.Background(), 24*time.Hour, "")
+	if err != nil {
+		t.Fatalf("pruneExpiredAliases returned an error: %v", err)
+	}
+	if n != 1 || len(deleted) != 1 || deleted[0] != "old" {
+		t.Errorf("Expected only the old rule to be deleted, got %d deleted: %v", n, deleted)
+	}
+}
+
+func TestPruneExpiredAliasesOfRun(t *testing.T) {
+	var deleted []string
+	now := time.Now()
+	runRule := func(id, runID string) map[string]interface{} {
+		rule := testRule(id, id+"@test.com", now)
+		rule["name"] = ruleName(runID, now.Add(-time.Minute))
+		return rule
+	}
+	rules := []map[string]interface{}{
+		runRule("mine", "run-a"),
+		runRule("other", "run-b"),
+		testRule("legacy", "legacy@test.com", now.Add(-72*time.Hour)),
+	}
+	newCloudflareListServer(t, rules, &deleted)
+
+	n, err := pruneExpiredAliases(context.Background(), 0, "run-a")
+	if err != nil {
+		t.Fatalf("pruneExpiredAliases returned an error: %v", err)
+	}
+	if n != 1 || len(deleted) != 1 || deleted[0] != "mine" {
+		t.Errorf("Expected only the rule of run-a to be deleted, got %d deleted: %v", n, deleted)
+	}
+}
+
+func TestListOwnAliasRules(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	runRule := func(id, runID string, created time.Time) map[string]interface{} {
+		rule := testRule(id, id+"@test.com", created)
+		rule["name"] = ruleName(runID, created)
+		return rule
+	}
+	rules := []map[string]interface{}{
+		runRule("newer", "batch-2", now.Add(-time.Hour)),
+		runRule("older", "batch-1", now.Add(-48*time.Hour)),
+		runRule("recent", "batch-3", now.Add(-time.Minute)),
+		runRule("other", "nightly", now.Add(-72*time.Hour)),
+		{"id": "manual", "name": "My inbox", "matchers": []map[string]string{{"field": "to", "type": "literal", "value": "me@test.com"}}},
+	}
+	newCloudflareListServer(t, rules, nil)
+
+	own, err := listOwnAliasRules(context.Background(), 30*time.Minute, "batch-")
+	if err != nil {
+		t.Fatalf("listOwnAliasRules returned an error: %v", err)
+	}
+	if len(own) != 2 || own[0].ruleID() != "older" || own[1].ruleID() != "newer" {
+		t.Fatalf("Expected the batch rules older than 30m, oldest first, got %+v", own)
+	}
+
+	var out strings.Builder
+	if err := printAliasRules(&out, own); err != nil {
+		t.Fatalf("printAliasRules returned an error: %v", err)
+	}
+	if !strings.Contains(out.String(), "older@test.com") || !strings.Contains(out.String(), "batch-2") {
+		t.Errorf("Expected each rule's alias and run ID in the table, got:\n%s", out.String())
+	}
+}
+
+func TestParseRuleName(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	runID, createdAt, ok := parseRuleName(ruleName("abc-123", created))
+	if !ok || runID != "abc-123" || !createdAt.Equal(created) {
+		t.Errorf("Expected run abc-123 at %s, got %q, %s, %v", created, runID, createdAt, ok)
+	}
+	runID, createdAt, ok = parseRuleName("Rule created at " + created.Format(time.RFC3339))
+	if !ok || runID != "" || !createdAt.Equal(created) {
+		t.Errorf("Expected a legacy rule at %s, got %q, %s, %v", created, runID, createdAt, ok)
+	}
+	for _, name := range []string{"My inbox", "Promogen run  created at 2024-06-01T12:00:00Z", "Promogen run abc created at yesterday"} {
+		if _, _, ok := parseRuleName(name); ok {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestNextForwardAddressRoundRobin(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ForwardToEmail = "a@example.com, b@example.com"
+	config.ForwardToEmails = []string{"c@example.com"}
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[nextForwardAddress()]++
+	}
+	for _, address := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if counts[address] != 10 {
+			t.Errorf("Expected %s to be used 10 times, got %d", address, counts[address])
+		}
+	}
+}
+
+func TestCreateCloudflareEmailAliasForwardsRoundRobin(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = ""
+	config.ForwardToEmails = []string{"a@example.com", "b@example.com"}
+
+	var forwards []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []interface{}{}})
+			return
+		}
+		var rule cloudflareEmailRule
+		json.NewDecoder(r.Body).Decode(&rule)
+		forwards = append(forwards, rule.Actions[0].Value...)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": map[string]string{"id": "rule"}})
+	}))
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	defer func() {
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		knownAliases = nil
+		server.Close()
+	}()
+
+	for i := 0; i < 4; i++ {
+		if _, _, err := createCloudflareEmailAlias(context.Background()); err != nil {
+			t.Fatalf("createCloudflareEmailAlias returned an error: %v", err)
+		}
+	}
+	if len(forwards) != 4 || forwards[0] == forwards[1] || forwards[0] != forwards[2] || forwards[1] != forwards[3] {
+		t.Errorf("Expected forwards to alternate between both addresses, got %v", forwards)
+	}
+}
+
+// newCloudflareCreateServer returns a mock Cloudflare API that answers every
+// rule creation with handle and counts the attempts.
+func newCloudflareCreateServer(t *testing.T, attempts *int, handle func(w http.ResponseWriter, attempt int)) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []interface{}{}})
+			return
+		}
+		*attempts++
+		handle(w, *attempts)
+	}))
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	t.Cleanup(func() {
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		knownAliases = nil
+		server.Close()
+	})
+}
+
+func TestCreateCloudflareEmailAliasRetriesRateLimit(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = "me@example.com"
+
+	attempts := 0
+	newCloudflareCreateServer(t, &attempts, func(w http.ResponseWriter, attempt int) {
+		if attempt < 3 {
+			w.Header().Set("Ratelimit", `"default";r=0;t=0`)
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"success":false,"errors":[{"code":971,"message":"Please wait and consider throttling your request speed"}]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": map[string]string{"id": "rule"}})
+	})
+
+	if _, ruleID, err := createCloudflareEmailAlias(context.Background()); err != nil || ruleID != "rule" {
+		t.Fatalf("Expected the alias to be created after the rate limit, got %q: %v", ruleID, err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestCreateCloudflareEmailAliasReportsErrorMessages(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = "me@example.com"
+
+	attempts := 0
+	newCloudflareCreateServer(t, &attempts, func(w http.ResponseWriter, attempt int) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success":false,"errors":[{"code":2020,"message":"Invalid rule operation"},{"code":2021,"message":"Destination address not verified"}]}`))
+	})
+
+	_, _, err := createCloudflareEmailAlias(context.Background())
+	if err == nil || !strings.HasSuffix(err.Error(), "Invalid rule operation (code 2020); Destination address not verified (code 2021)") {
+		t.Errorf("Expected the Cloudflare error messages in the error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a 400 not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestCloudflareRetryDelay(t *testing.T) {
+	header := http.Header{}
+	header.Set("Ratelimit", `"default";r=0;t=30`)
+	if got := cloudflareRetryDelay(header, 0); got != 30*time.Second {
+		t.Errorf("Expected the RateLimit reset to be honored, got %v", got)
+	}
+	header.Set("Retry-After", "5")
+	if got := cloudflareRetryDelay(header, 0); got != 5*time.Second {
+		t.Errorf("Expected Retry-After to take precedence, got %v", got)
+	}
+	if got := cloudflareRetryDelay(http.Header{}, 0); got <= 0 {
+		t.Errorf("Expected a backoff without headers, got %v", got)
+	}
+}
+
+func TestCreateCloudflareEmailAliasWithActions(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = "inbox@example.com"
+	config.ForwardToEmails = nil
+	config.AliasActions = []AliasAction{
+		{Type: aliasActionForward},
+		{Type: aliasActionWorker, Value: []string{"code-parser"}},
+	}
+
+	var rule cloudflareEmailRule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []interface{}{}})
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&rule)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": map[string]string{"id": "rule"}})
+	}))
+	defer server.Close()
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	defer func() { knownAliases = nil }()
+
+	if _, _, err := createCloudflareEmailAlias(context.Background()); err != nil {
+		t.Fatalf("createCloudflareEmailAlias returned an error: %v", err)
+	}
+	want := []AliasAction{
+		{Type: aliasActionForward, Value: []string{"inbox@example.com"}},
+		{Type: aliasActionWorker, Value: []string{"code-parser"}},
+	}
+	if !reflect.DeepEqual(rule.Actions, want) {
+		t.Errorf("Expected actions %+v, got %+v", want, rule.Actions)
+	}
+}
+
+func TestCheckAliasActions(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	tests := []struct {
+		actions  []AliasAction
+		wantErrs int
+	}{
+		{actions: nil},
+		{actions: []AliasAction{{Type: aliasActionForward, Value: []string{"a@example.com"}}, {Type: aliasActionWorker, Value: []string{"parser"}}}},
+		{actions: []AliasAction{{Type: aliasActionForward, Value: []string{"not-an-email"}}}, wantErrs: 1},
+		{actions: []AliasAction{{Type: aliasActionWorker}}, wantErrs: 1},
+		{actions: []AliasAction{{Type: aliasActionDrop}, {Type: aliasActionWorker, Value: []string{"parser"}}}, wantErrs: 1},
+		{actions: []AliasAction{{Type: "webhook"}}, wantErrs: 1},
+	}
+	for i, tt := range tests {
+		config.AliasActions = tt.actions
+		if errs := checkAliasActions(); len(errs) != tt.wantErrs {
+			t.Errorf("case %d: expected %d errors, got %q", i+1, tt.wantErrs, errs)
+		}
+	}
+
+	config.AliasActions = []AliasAction{{Type: aliasActionWorker, Value: []string{"parser"}}}
+	if aliasActionsNeedForwardAddress() {
+		t.Error("Expected a worker-only rule not to need forward_to_email")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var codesFileMu sync.Mutex
+
+// saveCode appends code to CodesFile, one per line, unless the file already
+// lists it. It reports whether the code was added.
+func saveCode(code string) (bool, error) {
+	codesFileMu.Lock()
+	defer codesFileMu.Unlock()
+
+	file, err := os.OpenFile(config.CodesFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, fmt.Errorf("error opening codes file: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return false, fmt.Errorf("error reading codes file: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == code {
+			return false, nil
+		}
+	}
+
+	// The read left the offset at the end of the file; finish a last line
+	// that was written without a newline first
+	line := code + "\n"
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		line = "\n" + line
+	}
+	if _, err := file.WriteString(line); err != nil {
+		return false, fmt.Errorf("error writing codes file: %v", err)
+	}
+	return true, nil
+}
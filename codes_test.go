@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSaveCodeDedupes(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CodesFile = t.TempDir() + "/codes.txt"
+	// A file left by an earlier run, without a trailing newline
+	if err := os.WriteFile(config.CodesFile, []byte("AAAA-BBBB-CCCC"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		code  string
+		added bool
+	}{
+		{"AAAA-BBBB-CCCC", false},
+		{"DDDD-EEEE-FFFF", true},
+		{"DDDD-EEEE-FFFF", false},
+		{"GGGG-HHHH-IIII", true},
+	} {
+		added, err := saveCode(tt.code)
+		if err != nil {
+			t.Fatalf("saveCode(%s) returned an error: %v", tt.code, err)
+		}
+		if added != tt.added {
+			t.Errorf("saveCode(%s) = %v, want %v", tt.code, added, tt.added)
+		}
+	}
+
+	data, err := os.ReadFile(config.CodesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "AAAA-BBBB-CCCC\nDDDD-EEEE-FFFF\nGGGG-HHHH-IIII\n"; string(data) != want {
+		t.Errorf("Expected codes file %q, got %q", want, string(data))
+	}
+}
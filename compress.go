@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// browserAcceptEncoding is sent with promo requests the way a browser would.
+// Setting it turns off the transparent gzip decoding of net/http, so the
+// bodies are read with readResponseBody.
+const browserAcceptEncoding = "gzip, deflate"
+
+// readResponseBody reads the whole body of resp, decompressing it according
+// to its Content-Encoding. A body the server sent uncompressed is returned as
+// is.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	var body io.Reader = resp.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip body: %v", err)
+		}
+		defer gz.Close()
+		body = gz
+	case "deflate":
+		// Deflate is meant to be zlib wrapped, but some servers send it raw
+		buffered := bufio.NewReader(resp.Body)
+		header, err := buffered.Peek(2)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing deflate body: %v", err)
+		}
+		if (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			zr, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing deflate body: %v", err)
+			}
+			defer zr.Close()
+			body = zr
+		} else {
+			fr := flate.NewReader(buffered)
+			defer fr.Close()
+			body = fr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	return io.ReadAll(body)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadResponseBody(t *testing.T) {
+	const text = `{"success":true}`
+	compress := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		w.Write([]byte(text))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"", []byte(text)},
+		{"gzip", compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{"deflate", compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		{"deflate", compress(func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw })},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(tt.body))}
+		if tt.encoding != "" {
+			resp.Header.Set("Content-Encoding", tt.encoding)
+		}
+		got, err := readResponseBody(resp)
+		if err != nil || string(got) != text {
+			t.Errorf("Content-Encoding %q: got %q and %v", tt.encoding, got, err)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": {"br"}}, Body: io.NopCloser(bytes.NewReader(nil))}
+	if _, err := readResponseBody(resp); err == nil {
+		t.Error("Expected an error for an unsupported encoding")
+	}
+}
+
+func TestSubmitPromoEntryDecodesGzip(t *testing.T) {
+	var gotAcceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"success":true}`))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+
+	submitted, err := submitPromoEntry(context.Background(), &promoSession{target: Target{SubmitURL: server.URL}, userAgent: "test-agent"}, "a@test.com", "token")
+	if err != nil {
+		t.Fatalf("submitPromoEntry returned an error: %v", err)
+	}
+	if gotAcceptEncoding != browserAcceptEncoding {
+		t.Errorf("Expected Accept-Encoding %q, got %q", browserAcceptEncoding, gotAcceptEncoding)
+	}
+	if submitted.Body != `{"success":true}` {
+		t.Errorf("Expected the decompressed body, got %q", submitted.Body)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// currentConfigVersion is the config_version of the layout this build
+// reads. Files without config_version predate it and count as version 0.
+const currentConfigVersion = 1
+
+// migrateConfig upgrades c from the layout of config_version from to the
+// current one and returns a description of every change made. A version
+// newer than this build knows is left alone with a warning, since its fields
+// may mean something else.
+func migrateConfig(c *Config, from int) []string {
+	if from > currentConfigVersion {
+		errorf("WARNING: %s has config_version %d, but this build only knows up to %d. Fields it does not recognize are ignored.\n", configFileName, from, currentConfigVersion)
+		return nil
+	}
+
+	var changes []string
+	if from < 1 {
+		changes = append(changes, migrateConfigV1(c)...)
+	}
+	c.ConfigVersion = currentConfigVersion
+	return changes
+}
+
+// migrateConfigV1 splits the single proxy string into the proxy_* fields,
+// moves comma-separated forward_to_email addresses to forward_to_emails and
+// replaces debug_mode with log_level.
+func migrateConfigV1(c *Config) []string {
+	var changes []string
+
+	if c.Proxy != "" {
+		if c.ProxyDNS != "" {
+			changes = append(changes, fmt.Sprintf("Dropped proxy %q, proxy_dns is already set", c.Proxy))
+		} else if err := splitLegacyProxy(c); err != nil {
+			changes = append(changes, fmt.Sprintf("Dropped proxy %q: %v", c.Proxy, err))
+		} else {
+			changes = append(changes, "Split proxy into proxy_scheme, proxy_dns, proxy_port, proxy_username and proxy_password")
+		}
+		c.Proxy = ""
+	}
+
+	if strings.Contains(c.ForwardToEmail, ",") {
+		// Kept ahead of forward_to_emails so aliases cycle in the same order
+		var addresses []string
+		for _, address := range strings.Split(c.ForwardToEmail, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+		c.ForwardToEmail = ""
+		c.ForwardToEmails = append(addresses, c.ForwardToEmails...)
+		changes = append(changes, "Moved the comma-separated forward_to_email addresses to forward_to_emails")
+	}
+
+	if c.DebugMode {
+		c.DebugMode = false
+		c.LogLevel = logLevelDebug
+		changes = append(changes, "Replaced debug_mode with log_level debug")
+	}
+	return changes
+}
+
+// splitLegacyProxy fills the proxy_* fields from the proxy string of
+// config_version 0 files, written as [scheme://][user:pass@]host:port.
+func splitLegacyProxy(c *Config) error {
+	raw := c.Proxy
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("expected host:port")
+	}
+
+	if strings.Contains(c.Proxy, "://") {
+		c.ProxyScheme = u.Scheme
+	}
+	c.ProxyDNS = u.Hostname()
+	c.ProxyPort = u.Port()
+	if u.User != nil {
+		c.ProxyUsername = u.User.Username()
+		c.ProxyPassword, _ = u.User.Password()
+	}
+	return nil
+}
+
+// writeMigratedConfig upgrades the config file at name to the current
+// config_version in place. It reads the file again rather than saving the
+// loaded config, so environment overrides never end up on disk.
+func writeMigratedConfig(name string) ([]string, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := readConfigFile(name, &c); err != nil {
+		return nil, err
+	}
+	if c.ConfigVersion > currentConfigVersion {
+		return nil, fmt.Errorf("config_version %d is newer than this build supports (%d)", c.ConfigVersion, currentConfigVersion)
+	}
+
+	changes := migrateConfig(&c, c.ConfigVersion)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling config: %v", err)
+	}
+	if err := os.WriteFile(name, append(data, '\n'), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
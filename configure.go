@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// configureInput and configureSecretInput read one answer for -configure.
+// Tests replace them.
+var (
+	configureInput       = getUserInput
+	configureSecretInput = getSecretInput
+)
+
+// configureSkipped are the fields -configure never asks about, since they
+// are set by -migrate or only read from old files.
+var configureSkipped = map[string]bool{
+	"config_version": true,
+	"proxy":          true,
+	"debug_mode":     true,
+}
+
+// getSecretInput is getUserInput without echoing the answer, when stdin is
+// a terminal.
+func getSecretInput(prompt string) string {
+	if !isTerminal(os.Stdin) {
+		return getUserInput(prompt)
+	}
+	outputf("%s", prompt)
+	input, err := term.ReadPassword(int(os.Stdin.Fd()))
+	outputf("\n")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(input))
+}
+
+// configureConfig walks through the fields of the config file at name,
+// asking for each value with the current one as the default, and writes the
+// result back. Like -migrate it starts from the file rather than the loaded
+// config, so environment overrides never end up on disk. A missing file is
+// created.
+func configureConfig(name string) error {
+	perm := os.FileMode(0600)
+	var c Config
+	info, err := os.Stat(name)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+		if err := readConfigFile(name, &c); err != nil {
+			return err
+		}
+		migrateConfig(&c, c.ConfigVersion)
+	case errors.Is(err, os.ErrNotExist):
+		c.ConfigVersion = currentConfigVersion
+		outputf("%s does not exist yet, it will be created\n", name)
+	default:
+		return err
+	}
+
+	outputf("Press Enter to keep the value in brackets, or enter - to clear a text field.\n")
+	skipped := promptConfigFields(&c)
+	if len(skipped) > 0 {
+		outputf("These fields are lists or maps, edit them in %s directly: %s\n", name, strings.Join(skipped, ", "))
+	}
+
+	if errs := checkConfigCopy(c); len(errs) > 0 {
+		errorf("The config has problems:\n  - %s\n", strings.Join(errs, "\n  - "))
+		if strings.ToLower(configureInput("Save it anyway? (y/n): ")) != "y" {
+			return fmt.Errorf("not saved")
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling config: %v", err)
+	}
+	return os.WriteFile(name, append(data, '\n'), perm)
+}
+
+// promptConfigFields asks for every string, bool and number field of c in
+// declaration order, asking again until the answer parses. It returns the
+// json names of the fields it cannot prompt for.
+func promptConfigFields(c *Config) []string {
+	var skipped []string
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if configureSkipped[name] {
+			continue
+		}
+		field := v.Field(i)
+		secret := isSecretField(t.Field(i))
+
+		switch field.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		default:
+			skipped = append(skipped, name)
+			continue
+		}
+
+		for {
+			current := fmt.Sprint(field.Interface())
+			if secret && current != "" {
+				current = "****"
+			}
+			prompt := fmt.Sprintf("%s [%s]: ", name, current)
+			var answer string
+			if secret {
+				answer = configureSecretInput(prompt)
+			} else {
+				answer = configureInput(prompt)
+			}
+			if answer == "" {
+				break
+			}
+			err := setConfigField(field, answer)
+			if err == nil {
+				break
+			}
+			errorf("Invalid value for %s: %v\n", name, err)
+		}
+	}
+	return skipped
+}
+
+// setConfigField parses answer into field, where - clears a string.
+func setConfigField(field reflect.Value, answer string) error {
+	switch field.Kind() {
+	case reflect.String:
+		if answer == "-" {
+			answer = ""
+		}
+		field.SetString(answer)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(answer)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(answer, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected a whole number")
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(answer, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		field.SetFloat(f)
+	}
+	return nil
+}
+
+// checkConfigCopy runs checkConfig against c without keeping the defaults
+// it fills in, so they are not written to the file, or the regexes it
+// compiles from c.
+func checkConfigCopy(c Config) []string {
+	oldConfig, oldPromoCodeRegex, oldCSRFTokenRegex := config, promoCodeRegex, csrfTokenRegex
+	defer func() {
+		config, promoCodeRegex, csrfTokenRegex = oldConfig, oldPromoCodeRegex, oldCSRFTokenRegex
+	}()
+	config = c
+	return checkConfig()
+}
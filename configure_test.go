@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(`{"config_version": 1, "monster_promo_url": "https://promo.test", "ez_captcha_api_key": "old-key", "cloudflare_zone_id": "zone_1", "max_submit_retries": 3, "forward_to_emails": ["a@test.com"]}`), 0640); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROMOGEN_EZCAPTCHA_API_KEY", "env-key")
+
+	var out strings.Builder
+	oldOutput := logOutput
+	logOutput = &out
+	defer func() { logOutput = oldOutput }()
+
+	answers := map[string][]string{
+		"monster_promo_url":  {"-"},
+		"use_proxy":          {"maybe", "true"},
+		"max_submit_retries": {"5"},
+		"ez_captcha_api_key": {"new-key"},
+	}
+	var prompts, secretPrompts []string
+	answer := func(prompt string) string {
+		if strings.HasPrefix(prompt, "Save it anyway") {
+			return "y"
+		}
+		field := strings.SplitN(prompt, " ", 2)[0]
+		if len(answers[field]) == 0 {
+			return ""
+		}
+		next := answers[field][0]
+		answers[field] = answers[field][1:]
+		return next
+	}
+	oldInput, oldSecretInput := configureInput, configureSecretInput
+	configureInput = func(prompt string) string {
+		prompts = append(prompts, prompt)
+		return answer(prompt)
+	}
+	configureSecretInput = func(prompt string) string {
+		secretPrompts = append(secretPrompts, prompt)
+		return answer(prompt)
+	}
+	defer func() { configureInput, configureSecretInput = oldInput, oldSecretInput }()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	oldPromoCodeRegex := promoCodeRegex
+	defer func() { promoCodeRegex = oldPromoCodeRegex }()
+	promoCodeRegex = nil
+
+	if err := configureConfig(name); err != nil {
+		t.Fatal(err)
+	}
+	if promoCodeRegex != nil {
+		t.Errorf("Expected the checks not to leave the promo code regex of the edited config behind, got %v", promoCodeRegex)
+	}
+	if !strings.Contains(strings.Join(secretPrompts, "\n"), "ez_captcha_api_key [****]") {
+		t.Errorf("Expected the API key to be asked for masked, got %q", secretPrompts)
+	}
+	if !strings.Contains(strings.Join(prompts, "\n"), "cloudflare_zone_id [zone_1]") {
+		t.Errorf("Expected the zone ID to be shown and echoed like any other value, got %q", prompts)
+	}
+	if !strings.Contains(out.String(), "Invalid value for use_proxy") || !strings.Contains(out.String(), "forward_to_emails") {
+		t.Errorf("Expected the bad answer to be rejected and the list field to be named, got %q", out.String())
+	}
+
+	var c Config
+	if err := readConfigFile(name, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.MonsterPromoURL != "" || !c.UseProxy || c.MaxSubmitRetries != 5 || c.EZCaptchaAPIKey != "new-key" || len(c.ForwardToEmails) != 1 {
+		t.Errorf("Unexpected saved config: %+v", c)
+	}
+	if c.RunID != "" {
+		t.Errorf("Expected the defaults filled in by the checks not to be saved, got run_id %q", c.RunID)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the file mode to be kept, got %v, %v", info.Mode(), err)
+	}
+}
+
+func TestConfigureConfigNotSaved(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	oldInput, oldSecretInput := configureInput, configureSecretInput
+	configureInput = func(string) string { return "" }
+	configureSecretInput = configureInput
+	defer func() { configureInput, configureSecretInput = oldInput, oldSecretInput }()
+
+	var out strings.Builder
+	oldOutput := logOutput
+	logOutput = &out
+	defer func() { logOutput = oldOutput }()
+
+	if err := configureConfig(name); err == nil {
+		t.Error("Expected an empty config without confirmation not to be saved")
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written, got %v", err)
+	}
+}
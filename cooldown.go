@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// failureCooldown pauses automatic mode once too many entries in a row have
+// failed, so captcha solves are not spent on submissions that cannot succeed.
+type failureCooldown struct {
+	mu        sync.Mutex
+	threshold int
+	initial   time.Duration
+	max       time.Duration
+	now       func() time.Time
+	streak    int
+	next      time.Duration
+	until     time.Time
+}
+
+func newFailureCooldown(threshold int, initial, max time.Duration, now func() time.Time) *failureCooldown {
+	return &failureCooldown{threshold: threshold, initial: initial, max: max, now: now, next: initial}
+}
+
+// record adds one outcome and returns how long to cool down for, or 0 when no
+// new cooldown starts. Once the threshold is reached every further failure
+// starts a cooldown twice as long as the last, up to max. A success resets
+// both the streak and the cooldown length.
+func (c *failureCooldown) record(success bool) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if success {
+		c.streak = 0
+		c.next = c.initial
+		return 0
+	}
+
+	c.streak++
+	now := c.now()
+	// Entries that were already in flight when a cooldown started do not
+	// extend it
+	if c.streak < c.threshold || now.Before(c.until) {
+		return 0
+	}
+
+	d := c.next
+	c.until = now.Add(d)
+	c.next = min(2*c.next, c.max)
+	return d
+}
+
+// Streak returns the number of failures in a row.
+func (c *failureCooldown) Streak() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streak
+}
+
+// Pause makes Wait block for at least d from now, on top of any cooldown
+// already running.
+func (c *failureCooldown) Pause(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until := c.now().Add(d); until.After(c.until) {
+		c.until = until
+	}
+}
+
+// Wait blocks until the current cooldown, if any, has ended.
+func (c *failureCooldown) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	remaining := c.until.Sub(c.now())
+	c.mu.Unlock()
+
+	if remaining <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, remaining)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFailureCooldownBacksOff(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newFailureCooldown(3, 10*time.Second, 30*time.Second, func() time.Time { return now })
+
+	for i := 0; i < 2; i++ {
+		if d := c.record(false); d != 0 {
+			t.Fatalf("Failure %d started a %s cooldown before the threshold", i+1, d)
+		}
+	}
+
+	// Each failure after the threshold doubles the cooldown up to the cap
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if d := c.record(false); d != want {
+			t.Fatalf("Expected a %s cooldown, got %s", want, d)
+		}
+		// A failure still in flight during the cooldown does not extend it
+		if d := c.record(false); d != 0 {
+			t.Fatalf("Expected no new cooldown while cooling down, got %s", d)
+		}
+		now = now.Add(want)
+	}
+
+	c.record(true)
+	if c.Streak() != 0 {
+		t.Errorf("Expected a success to reset the streak, got %d", c.Streak())
+	}
+	for i := 0; i < 2; i++ {
+		c.record(false)
+	}
+	if d := c.record(false); d != 10*time.Second {
+		t.Errorf("Expected the cooldown to restart at 10s after a success, got %s", d)
+	}
+}
+
+func TestFailureCooldownWait(t *testing.T) {
+	c := newFailureCooldown(1, 50*time.Millisecond, time.Second, time.Now)
+	if err := c.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait without a cooldown returned %v", err)
+	}
+
+	c.record(false)
+	start := time.Now()
+	if err := c.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait returned %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected Wait to block for the cooldown, returned after %s", elapsed)
+	}
+
+	c.record(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Wait(ctx); err == nil {
+		t.Error("Expected Wait to return an error once ctx is cancelled")
+	}
+}
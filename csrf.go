@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/net/html"
+)
+
+// defaultCSRFFieldName is the hidden anti-forgery field of ASP.NET forms.
+const defaultCSRFFieldName = "__RequestVerificationToken"
+
+// csrfTokenRegex is compiled from CSRFTokenRegex by checkCSRF. When nil the
+// token is read from the hidden input named CSRFFieldName.
+var csrfTokenRegex *regexp.Regexp
+
+// scrapeCSRFToken returns the anti-forgery token on the promo page: the
+// first capture group of csrfTokenRegex when set, otherwise the value of the
+// first input named field.
+func scrapeCSRFToken(page []byte, field string) (string, error) {
+	if csrfTokenRegex != nil {
+		match := csrfTokenRegex.FindSubmatch(page)
+		if match == nil {
+			return "", fmt.Errorf("csrf_token_regex did not match the promo page")
+		}
+		return string(match[1]), nil
+	}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return "", fmt.Errorf("promo page has no %s field", field)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "input" {
+				continue
+			}
+			var name, value string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "name":
+					name = attr.Val
+				case "value":
+					value = attr.Val
+				}
+			}
+			if name == field {
+				return value, nil
+			}
+		}
+	}
+}
+
+// checkCSRF returns a description of every problem with the anti-forgery
+// token settings. The scrape step only runs when scrape_csrf_token is set.
+func checkCSRF() []string {
+	var errs []string
+
+	csrfTokenRegex = nil
+	if !config.ScrapeCSRFToken {
+		return nil
+	}
+	if config.CSRFFieldName == "" {
+		config.CSRFFieldName = defaultCSRFFieldName // Set a default value if not specified
+	}
+	if config.CSRFTokenRegex != "" {
+		re, err := regexp.Compile(config.CSRFTokenRegex)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("Invalid CSRF token regex: %v", err))
+		case re.NumSubexp() < 1:
+			errs = append(errs, "CSRF token regex needs a capture group for the token")
+		default:
+			csrfTokenRegex = re
+		}
+	}
+	return errs
+}
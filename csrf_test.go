@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestScrapeCSRFToken(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig; checkCSRF() }()
+
+	page := []byte(`<form><input type="hidden" name="Other" value="x">
+		<input name="__RequestVerificationToken" type="hidden" value="abc123" /></form>
+		<script>var token = "from-script";</script>`)
+
+	config = Config{ScrapeCSRFToken: true}
+	if errs := checkCSRF(); len(errs) != 0 {
+		t.Fatalf("Unexpected config errors: %v", errs)
+	}
+	if config.CSRFFieldName != defaultCSRFFieldName {
+		t.Errorf("Expected the default field name, got %q", config.CSRFFieldName)
+	}
+	if token, err := scrapeCSRFToken(page, config.CSRFFieldName); err != nil || token != "abc123" {
+		t.Errorf("Expected token abc123, got %q and %v", token, err)
+	}
+	if _, err := scrapeCSRFToken(page, "Missing"); err == nil {
+		t.Error("Expected an error for a missing field")
+	}
+
+	config.CSRFTokenRegex = `var token = "([^"]+)"`
+	if errs := checkCSRF(); len(errs) != 0 {
+		t.Fatalf("Unexpected config errors: %v", errs)
+	}
+	if token, err := scrapeCSRFToken(page, config.CSRFFieldName); err != nil || token != "from-script" {
+		t.Errorf("Expected the regex token, got %q and %v", token, err)
+	}
+
+	config.CSRFTokenRegex = `var token`
+	if errs := checkCSRF(); len(errs) != 1 {
+		t.Errorf("Expected an error for a regex without a capture group, got %v", errs)
+	}
+}
+
+func TestWarmUpKeepsCSRFTokenForSubmissions(t *testing.T) {
+	var posted []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			http.SetCookie(w, &http.Cookie{Name: "__RequestVerificationToken", Value: "cookie-half"})
+			w.Write([]byte(`<input name="__RequestVerificationToken" value="form-half">`))
+			return
+		}
+		r.ParseForm()
+		posted = append(posted, r.PostForm)
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig; checkCSRF() }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.ScrapeCSRFToken = true
+	config.CSRFFieldName = ""
+	config.CSRFTokenRegex = ""
+	checkCSRF()
+
+	session := &promoSession{
+		target:    Target{PromoURL: server.URL, SubmitURL: server.URL},
+		userAgent: "test-agent",
+		jar:       newSessionJar(newClearanceJar(time.Now)),
+	}
+	if err := warmUpPromoSession(context.Background(), session); err != nil {
+		t.Fatalf("warmUpPromoSession returned an error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := submitPromoEntry(context.Background(), session, "a@test.com", "token"); err != nil {
+			t.Fatalf("submitPromoEntry returned an error: %v", err)
+		}
+	}
+	for i, form := range posted {
+		if got := form.Get(defaultCSRFFieldName); got != "form-half" {
+			t.Errorf("Submission %d: expected the scraped token, got %q", i+1, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultsCSV receives one row per submission when CSVOutput is set.
+var resultsCSV *csvWriter
+
+var csvHeader = []string{"timestamp", "email", "success", "captcha_provider", "solve_seconds", "http_status", "error", "submit_seconds"}
+
+// csvWriter appends submission results to a CSV file, flushing after every
+// row so an interrupted run keeps everything written so far.
+type csvWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+}
+
+// openCSVWriter opens path for appending, writing the header row if the file
+// is new or empty. A file written with other columns, e.g. by an older
+// version, is renamed aside first so its rows never mix with these.
+func openCSVWriter(path string) (*csvWriter, error) {
+	if err := rotateStaleCSV(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	c := &csvWriter{file: file, w: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		if err := c.writeRow(csvHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// rotateStaleCSV renames the file at path to <name>-<timestamp><ext> when
+// its header differs from csvHeader. A missing or empty file is left alone.
+func rotateStaleCSV(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	file.Close()
+	if err == io.EOF || (err == nil && slices.Equal(header, csvHeader)) {
+		return nil
+	}
+
+	ext := filepath.Ext(path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), time.Now().Format("20060102T150405"), ext)
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	infof("%s has different columns, moved it to %s and starting a new file\n", path, rotated)
+	return nil
+}
+
+// Write appends one row for result.
+func (c *csvWriter) Write(result SubmissionResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status, submitSeconds := "", ""
+	if result.HTTPStatus != 0 {
+		status = strconv.Itoa(result.HTTPStatus)
+		submitSeconds = strconv.FormatFloat(result.SubmitSeconds, 'f', 3, 64)
+	}
+	return c.writeRow([]string{
+		result.Timestamp.Format(time.RFC3339),
+		result.Email,
+		strconv.FormatBool(result.Success),
+		result.CaptchaProvider,
+		strconv.FormatFloat(result.CaptchaSolveSeconds, 'f', 2, 64),
+		status,
+		result.Error,
+		submitSeconds,
+	})
+}
+
+func (c *csvWriter) writeRow(row []string) error {
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Close flushes any buffered data and closes the file.
+func (c *csvWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.Flush()
+	return c.file.Close()
+}
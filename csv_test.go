@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVWriterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+
+	w, err := openCSVWriter(path)
+	if err != nil {
+		t.Fatalf("openCSVWriter returned an error: %v", err)
+	}
+	w.Write(SubmissionResult{Timestamp: time.Now(), Email: "a@test.com", Success: true, CaptchaProvider: "ezcaptcha", CaptchaSolveSeconds: 12.5, HTTPStatus: 200, SubmitSeconds: 0.25})
+	w.Close()
+
+	// Reopening an existing file must not write the header again
+	w, err = openCSVWriter(path)
+	if err != nil {
+		t.Fatalf("openCSVWriter returned an error: %v", err)
+	}
+	w.Write(SubmissionResult{Timestamp: time.Now(), Email: "b@test.com", CaptchaProvider: "2captcha", Error: "captcha, rejected"})
+	w.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV output is not valid: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected header plus 2 rows, got %d rows", len(rows))
+	}
+	if rows[0][0] != "timestamp" || rows[1][1] != "a@test.com" || rows[1][5] != "200" || rows[1][7] != "0.250" {
+		t.Errorf("Unexpected rows: %v", rows[:2])
+	}
+	if rows[2][2] != "false" || rows[2][6] != "captcha, rejected" || rows[2][7] != "" {
+		t.Errorf("Unexpected failure row: %v", rows[2])
+	}
+}
+
+func TestCSVWriterRotatesOldHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.csv")
+	old := "timestamp,email,success,captcha_provider,solve_seconds,http_status,error\n2024-01-01T00:00:00Z,a@test.com,false,ezcaptcha,1.00,,proxy is dead\n"
+	os.WriteFile(path, []byte(old), 0644)
+
+	w, err := openCSVWriter(path)
+	if err != nil {
+		t.Fatalf("openCSVWriter returned an error: %v", err)
+	}
+	w.Write(SubmissionResult{Timestamp: time.Now(), Email: "b@test.com", Success: true})
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil || len(rows) != 2 || !slices.Equal(rows[0], csvHeader) {
+		t.Errorf("Expected a new file with the current header and 1 row, got %q (%v)", rows, err)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "results-*.csv"))
+	if len(rotated) != 1 {
+		t.Fatalf("Expected the old file to be moved aside, got %v", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != old {
+		t.Errorf("Expected the old file to be kept as it was, got %q", data)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dashboardInterval is how often the -tui dashboard is redrawn.
+	dashboardInterval = time.Second
+	// dashboardMessages is how many of the latest errors and codes it lists.
+	dashboardMessages = 5
+)
+
+// showDashboard is set by -tui when stdout is a terminal, and makes
+// automatic mode draw a dashboard in place of its progress lines.
+var showDashboard bool
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe
+// or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// dashboard redraws the counters of an automatic mode run in place. While it
+// runs it takes over logging, keeping the latest messages that would have
+// shown at every level.
+type dashboard struct {
+	out   io.Writer
+	stats *RunStats
+
+	mu       sync.Mutex
+	messages []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newDashboard(out io.Writer, stats *RunStats) *dashboard {
+	return &dashboard{
+		out:   out,
+		stats: stats,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start takes over logging and redraws the dashboard until Stop is called.
+// The captcha balance is refreshed in the background every BalanceCacheTTL
+// seconds until ctx is done.
+func (d *dashboard) Start(ctx context.Context) {
+	logMu.Lock()
+	logTap = d.addMessage
+	logMu.Unlock()
+
+	go d.refreshBalance(ctx, time.Duration(config.BalanceCacheTTL*float64(time.Second)))
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			d.draw(time.Now())
+			select {
+			case <-ticker.C:
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the dashboard one last time and hands logging back, so the
+// run summary prints below it.
+func (d *dashboard) Stop() {
+	close(d.stop)
+	<-d.done
+	d.draw(time.Now())
+
+	logMu.Lock()
+	logTap = nil
+	logMu.Unlock()
+}
+
+// refreshBalance keeps the cached captcha balance current for the dashboard
+// to show, reading it every interval. Failures are left to the next refresh.
+func (d *dashboard) refreshBalance(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			checkCaptchaBalance()
+		case <-ctx.Done():
+			return
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// addMessage keeps message, split into lines, among the latest ones.
+func (d *dashboard) addMessage(message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			d.messages = append(d.messages, line)
+		}
+	}
+	if len(d.messages) > dashboardMessages {
+		d.messages = d.messages[len(d.messages)-dashboardMessages:]
+	}
+}
+
+// draw clears the terminal and writes the dashboard at the top.
+func (d *dashboard) draw(now time.Time) {
+	fmt.Fprint(d.out, "\x1b[H\x1b[2J"+d.render(now))
+}
+
+// render returns the dashboard as of now.
+func (d *dashboard) render(now time.Time) string {
+	var b strings.Builder
+
+	total, success, failed := d.stats.counts()
+	fmt.Fprintf(&b, "Promogen %s - run %s - running for %s\n\n", version, config.RunID, now.Sub(d.stats.StartTime).Round(time.Second))
+	fmt.Fprintf(&b, "Submissions:     %d (%d succeeded, %d failed)\n", total, success, failed)
+	if total > 0 {
+		fmt.Fprintf(&b, "Success rate:    %.2f%%\n", float64(success)/float64(total)*100)
+	} else {
+		fmt.Fprintf(&b, "Success rate:    -\n")
+	}
+
+	balanceCache.mu.Lock()
+	balance, fetched := balanceCache.balance, balanceCache.fetched
+	balanceCache.mu.Unlock()
+	if fetched.IsZero() {
+		fmt.Fprintf(&b, "Captcha balance: unknown\n")
+	} else {
+		fmt.Fprintf(&b, "Captcha balance: $%.2f (read %s ago)\n", balance, now.Sub(fetched).Round(time.Second))
+	}
+
+	solves, avgSolveTime := captchaStats.summary()
+	fmt.Fprintf(&b, "Captcha solves:  %d, %.1fs on average\n", solves, avgSolveTime.Seconds())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(&b, "\nLatest errors and codes:\n")
+	if len(d.messages) == 0 {
+		fmt.Fprintf(&b, "  none yet\n")
+	}
+	for _, message := range d.messages {
+		fmt.Fprintf(&b, "  %s\n", message)
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboardRender(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.RunID = "run-1"
+
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	stats := newRunStats(start)
+	stats.record(SubmissionResult{Email: "a@test.com"}, nil)
+	stats.record(SubmissionResult{Email: "b@test.com"}, nil)
+	stats.record(SubmissionResult{Email: "c@test.com"}, errors.New("error solving captcha: timeout"))
+
+	d := newDashboard(&bytes.Buffer{}, stats)
+	for i := 1; i <= dashboardMessages+2; i++ {
+		d.addMessage(fmt.Sprintf("Error %d\n", i))
+	}
+
+	out := d.render(start.Add(90 * time.Second))
+	for _, want := range []string{"run run-1", "running for 1m30s", "3 (2 succeeded, 1 failed)", "66.67%", "Error 7"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the dashboard to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Error 2\n") {
+		t.Errorf("Expected only the latest %d messages, got:\n%s", dashboardMessages, out)
+	}
+}
+
+func TestDashboardTakesOverLogging(t *testing.T) {
+	oldConfig, oldOutput := config, logOutput
+	defer func() { config, logOutput = oldConfig, oldOutput }()
+	config = Config{LogLevel: logLevelInfo, BalanceCacheTTL: 60}
+	var logged, drawn bytes.Buffer
+	logOutput = &logged
+
+	d := newDashboard(&drawn, newRunStats(time.Now()))
+	d.Start(context.Background())
+	infof("a progress line\n")
+	errorf("an error\n")
+	d.Stop()
+	infof("after the dashboard\n")
+
+	if logged.String() != "after the dashboard\n" {
+		t.Errorf("Expected logging to be held back while the dashboard runs, got %q", logged.String())
+	}
+	if !strings.Contains(drawn.String(), "an error") || strings.Contains(drawn.String(), "a progress line") {
+		t.Errorf("Expected the dashboard to list errors only, got %q", drawn.String())
+	}
+}
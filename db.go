@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// resultsDB is the SQLite database opened from DBPath, or nil when results
+// are only written to the submissions log.
+var resultsDB *submissionDB
+
+// submissionDB records one row per alias so a code that arrives later can be
+// matched to the entry it came from, across restarts.
+type submissionDB struct {
+	db *sql.DB
+}
+
+func openSubmissionDB(path string) (*submissionDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serialize the workers instead of failing
+	// with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS submissions (
+		alias TEXT PRIMARY KEY,
+		rule_id TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		submitted INTEGER NOT NULL DEFAULT 0,
+		code_received INTEGER NOT NULL DEFAULT 0,
+		code TEXT NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating submissions table: %v", err)
+	}
+
+	return &submissionDB{db: db}, nil
+}
+
+// Upsert stores result under its alias. A known alias keeps its original
+// created_at and any code it already received.
+func (d *submissionDB) Upsert(result SubmissionResult) error {
+	_, err := d.db.Exec(`INSERT INTO submissions (alias, rule_id, created_at, submitted, code_received, code)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(alias) DO UPDATE SET
+			rule_id = excluded.rule_id,
+			submitted = max(submitted, excluded.submitted),
+			code_received = max(code_received, excluded.code_received),
+			code = CASE WHEN excluded.code != '' THEN excluded.code ELSE code END`,
+		result.Email, result.RuleID, result.Timestamp.UTC().Format(time.RFC3339),
+		result.Success, result.Code != "", result.Code)
+	if err != nil {
+		return fmt.Errorf("error saving submission for %s: %v", result.Email, err)
+	}
+	return nil
+}
+
+// Report writes the totals followed by one line per alias.
+func (d *submissionDB) Report(w io.Writer) error {
+	var total, submitted, codes int
+	err := d.db.QueryRow(`SELECT count(*), coalesce(sum(submitted), 0), coalesce(sum(code_received), 0) FROM submissions`).Scan(&total, &submitted, &codes)
+	if err != nil {
+		return fmt.Errorf("error reading submission totals: %v", err)
+	}
+	fmt.Fprintf(w, "Aliases: %d, submitted: %d, codes received: %d\n\n", total, submitted, codes)
+
+	rows, err := d.db.Query(`SELECT alias, rule_id, created_at, submitted, code FROM submissions ORDER BY created_at`)
+	if err != nil {
+		return fmt.Errorf("error reading submissions: %v", err)
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tRULE ID\tCREATED\tSUBMITTED\tCODE")
+	for rows.Next() {
+		var alias, ruleID, createdAt, code string
+		var wasSubmitted bool
+		if err := rows.Scan(&alias, &ruleID, &createdAt, &wasSubmitted, &code); err != nil {
+			return fmt.Errorf("error reading submission row: %v", err)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", alias, ruleID, createdAt, wasSubmitted, code)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading submissions: %v", err)
+	}
+	return tw.Flush()
+}
+
+func (d *submissionDB) Close() error {
+	return d.db.Close()
+}
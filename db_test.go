@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubmissionDBUpsertAndReport(t *testing.T) {
+	db, err := openSubmissionDB(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("openSubmissionDB returned an error: %v", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	results := []SubmissionResult{
+		{Timestamp: created, Email: "a@test.com", RuleID: "rule_a", Success: true},
+		{Timestamp: created.Add(time.Minute), Email: "b@test.com", RuleID: "rule_b", Error: "boom"},
+		// A later result for the same alias adds the code but keeps created_at
+		{Timestamp: created.Add(time.Hour), Email: "a@test.com", RuleID: "rule_a", Success: true, Code: "ABCD-EFGH-IJKL"},
+	}
+	for _, result := range results {
+		if err := db.Upsert(result); err != nil {
+			t.Fatalf("Upsert returned an error: %v", err)
+		}
+	}
+
+	var report strings.Builder
+	if err := db.Report(&report); err != nil {
+		t.Fatalf("Report returned an error: %v", err)
+	}
+	out := report.String()
+	if !strings.Contains(out, "Aliases: 2, submitted: 1, codes received: 1") {
+		t.Errorf("Unexpected report totals:\n%s", out)
+	}
+	if !strings.Contains(out, "ABCD-EFGH-IJKL") || !strings.Contains(out, "2024-06-01T12:00:00Z") {
+		t.Errorf("Expected the code and original created_at in the report:\n%s", out)
+	}
+}
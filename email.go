@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	emailProviderCloudflare = "cloudflare"
+	emailProviderMailTM     = "mailtm"
+)
+
+// EmailProvider is implemented by each source of throwaway email addresses.
+type EmailProvider interface {
+	// Name identifies the provider in logs.
+	Name() string
+	// CreateAlias returns a new address along with the ID Cleanup takes to
+	// remove it again.
+	CreateAlias(ctx context.Context) (email, id string, err error)
+	// Cleanup removes the address created with the given ID.
+	Cleanup(ctx context.Context, id string) error
+}
+
+// inboxProvider is implemented by providers that receive the mail for their
+// addresses themselves, so promo codes can be read without IMAP.
+type inboxProvider interface {
+	// FetchCode returns the promo code in the mail received by the address
+	// with the given ID, or an empty code when none has arrived yet.
+	FetchCode(ctx context.Context, id string) (string, error)
+}
+
+// emailProvider is the provider chosen at startup by newEmailProvider.
+var emailProvider EmailProvider = cloudflareProvider{}
+
+// newEmailProvider returns the provider selected in the config file.
+func newEmailProvider() EmailProvider {
+	if config.EmailProviderName == emailProviderMailTM {
+		return newMailTMProvider()
+	}
+	return cloudflareProvider{}
+}
+
+// generatesAliases reports whether entries get a new address from
+// emailProvider instead of prompting for one. Cloudflare aliases need
+// use_cloudflare_email, mail.tm addresses are always generated.
+func generatesAliases() bool {
+	return config.UseCloudflareEmail || config.EmailProviderName == emailProviderMailTM
+}
+
+// fetchesCodes reports whether submitEntry waits for the promo code mail,
+// either through the provider's own inbox or over IMAP.
+func fetchesCodes() bool {
+	_, ok := emailProvider.(inboxProvider)
+	return (ok && generatesAliases()) || config.IMAPHost != ""
+}
+
+// waitForCode waits for the promo code sent to email, which emailProvider
+// created with the given ID, reading the provider's inbox when it has one.
+func waitForCode(ctx context.Context, email, id string) (string, error) {
+	if inbox, ok := emailProvider.(inboxProvider); ok && id != "" {
+		return pollPromoCode(ctx, email, func() (string, error) {
+			return inbox.FetchCode(ctx, id)
+		})
+	}
+	return waitForPromoCode(ctx, email)
+}
+
+// cloudflareProvider creates forwarding rules on EmailDomain through
+// Cloudflare email routing.
+type cloudflareProvider struct{}
+
+func (cloudflareProvider) Name() string { return emailProviderCloudflare }
+
+func (cloudflareProvider) CreateAlias(ctx context.Context) (string, string, error) {
+	return createCloudflareEmailAlias(ctx)
+}
+
+func (cloudflareProvider) Cleanup(ctx context.Context, id string) error {
+	return deleteCloudflareEmailAlias(ctx, id)
+}
+
+// checkEmailProvider returns a description of every problem with the
+// settings of the selected email provider.
+func checkEmailProvider() []string {
+	var errs []string
+
+	if config.EmailProviderName == "" {
+		config.EmailProviderName = emailProviderCloudflare // Set a default value if not specified
+	}
+	switch config.EmailProviderName {
+	case emailProviderCloudflare:
+		if config.CloudflareAPIToken == "" {
+			errs = append(errs, "Cloudflare API token is missing")
+		}
+		if config.EmailDomain == "" {
+			errs = append(errs, "Email domain is missing")
+		}
+		if config.CloudflareZoneID == "" {
+			errs = append(errs, "Cloudflare Zone ID is missing")
+		}
+		errs = append(errs, checkAliasActions()...)
+		if addresses := forwardAddresses(); len(addresses) == 0 {
+			if aliasActionsNeedForwardAddress() {
+				errs = append(errs, "Forward to email is missing")
+			}
+		} else {
+			for _, address := range addresses {
+				if !emailAddressRegex.MatchString(address) {
+					errs = append(errs, fmt.Sprintf("Forward to email %q is not a valid email address", address))
+				}
+			}
+		}
+	case emailProviderMailTM:
+	default:
+		errs = append(errs, fmt.Sprintf("Unsupported email provider %q (expected cloudflare or mailtm)", config.EmailProviderName))
+	}
+	return errs
+}
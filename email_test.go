@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCheckEmailProvider(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{}
+	if errs := checkEmailProvider(); len(errs) != 4 || config.EmailProviderName != emailProviderCloudflare {
+		t.Errorf("Expected cloudflare by default with 4 missing settings, got %q and %v", config.EmailProviderName, errs)
+	}
+
+	config = Config{EmailProviderName: emailProviderMailTM}
+	if errs := checkEmailProvider(); len(errs) != 0 {
+		t.Errorf("Expected mail.tm to need no Cloudflare settings, got %v", errs)
+	}
+	if !generatesAliases() {
+		t.Error("Expected mail.tm to generate aliases without use_cloudflare_email")
+	}
+
+	config = Config{EmailProviderName: "gmail"}
+	if errs := checkEmailProvider(); len(errs) != 1 || !strings.HasPrefix(errs[0], "Unsupported email provider") {
+		t.Errorf("Expected an unsupported provider error, got %v", errs)
+	}
+}
+
+func TestWaitForCodeReadsProviderInbox(t *testing.T) {
+	var deleted []string
+	newMailTMServer(t, &deleted)
+
+	oldConfig, oldPromoCodeRegex, oldEmailProvider := config, promoCodeRegex, emailProvider
+	defer func() { config, promoCodeRegex, emailProvider = oldConfig, oldPromoCodeRegex, oldEmailProvider }()
+	config.EmailProviderName = emailProviderMailTM
+	config.IMAPWaitTimeout = 1
+	promoCodeRegex = regexp.MustCompile(defaultCodeRegex)
+	emailProvider = newMailTMProvider()
+
+	if !fetchesCodes() {
+		t.Fatal("Expected codes to be fetched from the mail.tm inbox without IMAP")
+	}
+	email, id, err := emailProvider.CreateAlias(context.Background())
+	if err != nil {
+		t.Fatalf("CreateAlias returned an error: %v", err)
+	}
+	if code, err := waitForCode(context.Background(), email, id); err != nil || code != "ABCD-EFGH-IJKL" {
+		t.Errorf("Expected the code from the mail.tm inbox, got %q: %v", code, err)
+	}
+}
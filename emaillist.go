@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// errEmailsExhausted is returned by submitEntry once every address from the
+// -emails list has been used.
+var errEmailsExhausted = errors.New("the email list is exhausted")
+
+// manualEmails is the list loaded with -emails, or nil when entries prompt
+// for an address.
+var manualEmails *emailList
+
+// emailList hands out pre-provisioned addresses, one per entry.
+type emailList struct {
+	mu     sync.Mutex
+	emails []string
+	next   int
+}
+
+// openEmailList loads the list from path, or from stdin when path is "-".
+func openEmailList(path string) (*emailList, error) {
+	if path == "-" {
+		return loadEmailList(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return loadEmailList(file)
+}
+
+// loadEmailList reads one address per line from r. Blank lines and lines
+// starting with # are ignored.
+func loadEmailList(r io.Reader) (*emailList, error) {
+	var emails []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !emailAddressRegex.MatchString(line) {
+			return nil, fmt.Errorf("line %d: %q is not a valid email address", n, line)
+		}
+		emails = append(emails, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading email list: %v", err)
+	}
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("email list is empty")
+	}
+	return &emailList{emails: emails}, nil
+}
+
+// Next returns the next unused address, or false once the list is used up.
+func (l *emailList) Next() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next >= len(l.emails) {
+		return "", false
+	}
+	email := l.emails[l.next]
+	l.next++
+	return email, true
+}
+
+// Len returns the number of addresses in the list, used or not.
+func (l *emailList) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.emails)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadEmailList(t *testing.T) {
+	list, err := loadEmailList(strings.NewReader("# batch 1\na@test.com\n\n  b@test.com  \n"))
+	if err != nil {
+		t.Fatalf("loadEmailList returned an error: %v", err)
+	}
+	for _, want := range []string{"a@test.com", "b@test.com"} {
+		if got, ok := list.Next(); !ok || got != want {
+			t.Errorf("Expected %s, got %q (%v)", want, got, ok)
+		}
+	}
+	if _, ok := list.Next(); ok {
+		t.Error("Expected the list to be exhausted")
+	}
+
+	if _, err := loadEmailList(strings.NewReader("a@test.com\nnot-an-email\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error naming line 2, got %v", err)
+	}
+	if _, err := loadEmailList(strings.NewReader("# nothing\n")); err == nil {
+		t.Error("Expected an error for an empty list")
+	}
+}
+
+func TestSubmitEntryUsesEmailList(t *testing.T) {
+	var submitted []string
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			r.ParseForm()
+			submitted = append(submitted, r.PostForm.Get("Email"))
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName, oldManualEmails := config, captchaSolver, submissionLogFileName, manualEmails
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName, manualEmails = oldConfig, oldCaptchaSolver, oldLogFileName, oldManualEmails
+	}()
+	config.UseCloudflareEmail = false
+	config.EmailProviderName = emailProviderCloudflare
+	config.MonsterPromoURL = promo.URL + "/promo"
+	config.MonsterSubmitURL = promo.URL + "/submit"
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+	manualEmails = &emailList{emails: []string{"a@test.com", "b@test.com"}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := submitEntry(context.Background(), nextTarget()); err != nil {
+			t.Fatalf("submitEntry returned an error: %v", err)
+		}
+	}
+	if _, err := submitEntry(context.Background(), nextTarget()); err != errEmailsExhausted {
+		t.Fatalf("Expected errEmailsExhausted, got %v", err)
+	}
+	if len(submitted) != 2 || submitted[0] != "a@test.com" || submitted[1] != "b@test.com" {
+		t.Errorf("Expected one entry per listed address, got %v", submitted)
+	}
+	if solves != 2 {
+		t.Errorf("Expected no captcha to be solved once the list ran out, got %d solves", solves)
+	}
+
+	// Running out is not logged as a failed entry
+	log, _ := os.ReadFile(submissionLogFileName)
+	if strings.Contains(string(log), "Failed entry") {
+		t.Errorf("Expected no failed entries in the log, got %q", log)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "errors"
+
+// Failures submitEntry wraps with %w, so callers can tell them apart with
+// errors.Is rather than by their message.
+var (
+	// errCaptchaTimeout is returned when the provider has no solution
+	// within CaptchaTimeout seconds or MaxCaptchaRetries polls.
+	errCaptchaTimeout = errors.New("captcha solving timed out")
+	// errCaptchaRejected matches a *promoRejectedError for an entry whose
+	// captcha token the promo endpoint refused.
+	errCaptchaRejected = errors.New("captcha token rejected")
+	// errProxyDead is returned when the promo endpoint could not be reached
+	// through the entry's proxy, which is then marked dead.
+	errProxyDead = errors.New("proxy is not responding")
+	// errPromoEnded is returned for a response containing EndedMarker.
+	errPromoEnded = errors.New("the promotion has ended")
+)
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrappedErrorsMatch(t *testing.T) {
+	rejected := fmt.Errorf("error submitting promo entry: %w", &promoRejectedError{Message: "Invalid captcha", CaptchaRejected: true})
+	if !errors.Is(rejected, errCaptchaRejected) {
+		t.Errorf("Expected a refused token to match errCaptchaRejected: %v", rejected)
+	}
+	var rejectedErr *promoRejectedError
+	if !errors.As(rejected, &rejectedErr) || rejectedErr.Message != "Invalid captcha" {
+		t.Errorf("Expected errors.As to find the rejection, got %v", rejectedErr)
+	}
+	if errors.Is(&promoRejectedError{Message: "Already entered"}, errCaptchaRejected) {
+		t.Error("Expected other rejections not to match errCaptchaRejected")
+	}
+}
+
+func TestPollCaptchaResultTimeout(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.MaxCaptchaRetries = 2
+	config.CaptchaTimeout = 60
+	config.CaptchaInitialDelay = 0.001
+	config.CaptchaPollInterval = 0.001
+
+	_, err := pollCaptchaResult(context.Background(), "test", "task_1", func(context.Context) (bool, string, error) {
+		return false, "", nil
+	})
+	if !errors.Is(err, errCaptchaTimeout) || !strings.Contains(err.Error(), "test task task_1") {
+		t.Errorf("Expected errCaptchaTimeout naming the abandoned task, got %v", err)
+	}
+}
+
+func TestPollCaptchaResultCutsSlowPollAtTimeout(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.MaxCaptchaRetries = 5
+	config.CaptchaTimeout = 0.05
+	config.CaptchaInitialDelay = 0.001
+	config.CaptchaPollInterval = 0.001
+
+	start := time.Now()
+	_, err := pollCaptchaResult(context.Background(), "test", "task_1", func(ctx context.Context) (bool, string, error) {
+		<-ctx.Done()
+		return false, "", ctx.Err()
+	})
+	if !errors.Is(err, errCaptchaTimeout) {
+		t.Errorf("Expected errCaptchaTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hanging poll to end at the timeout, took %v", elapsed)
+	}
+}
+
+func TestSubmitPromoEntryProxyDead(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ProxyScheme = "http"
+	config.MaxSubmitRetries = 0
+
+	// Nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	session := &promoSession{target: Target{SubmitURL: "http://promo.test/submit"}, proxyAddr: addr, userAgent: "test-agent"}
+	_, err = submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if !errors.Is(err, errProxyDead) {
+		t.Errorf("Expected errProxyDead, got %v", err)
+	}
+}
+
+func TestSubmitPromoEntryProxyNotBlamed(t *testing.T) {
+	oldConfig, oldProxies := config, proxies
+	defer func() { config, proxies = oldConfig, oldProxies }()
+	config.ProxyScheme = "http"
+	config.MaxSubmitRetries = 0
+
+	// The proxy accepts the connection, then hangs up without an answer
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer hangUp.Close()
+	addr := strings.TrimPrefix(hangUp.URL, "http://")
+	proxies = newProxyPool([]string{addr}, 10)
+
+	session := &promoSession{target: Target{SubmitURL: "http://promo.test/submit"}, proxyAddr: addr, userAgent: "test-agent"}
+	_, err := submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if err == nil || errors.Is(err, errProxyDead) {
+		t.Errorf("Expected a failure after connecting not to be blamed on the proxy, got %v", err)
+	}
+
+	// Nor is a shutdown, even when the proxy is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.proxyAddr = listener.Addr().String()
+	listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := submitPromoEntry(ctx, session, "a@test.com", "token"); errors.Is(err, errProxyDead) {
+		t.Errorf("Expected a cancelled submission not to report errProxyDead, got %v", err)
+	}
+
+	if dead := proxies.DeadCount(); dead != 0 {
+		t.Errorf("Expected no proxy to be marked dead, got %d", dead)
+	}
+}
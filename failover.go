@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Names of the providers captcha_providers may list, as reported by Name.
+const (
+	captchaProviderEZCaptcha   = "ezcaptcha"
+	captchaProviderTwoCaptcha  = "2captcha"
+	captchaProviderAntiCaptcha = "anticaptcha"
+	captchaProviderCapMonster  = "capmonster"
+)
+
+// captchaProviderSolvers maps the names in captcha_providers to solvers.
+var captchaProviderSolvers = map[string]CaptchaSolver{
+	captchaProviderEZCaptcha:   ezCaptchaSolver{},
+	captchaProviderTwoCaptcha:  twoCaptchaSolver{},
+	captchaProviderAntiCaptcha: antiCaptchaSolver{},
+	captchaProviderCapMonster:  capMonsterSolver{},
+}
+
+// failoverSolver tries each of its providers in order until one solves the
+// captcha. Providers whose last known balance is empty are skipped.
+type failoverSolver struct {
+	solvers []CaptchaSolver
+
+	mu sync.Mutex
+	// balances holds the last balance read from each provider by name
+	balances map[string]float64
+}
+
+func newFailoverSolver(names []string) *failoverSolver {
+	f := &failoverSolver{balances: make(map[string]float64)}
+	for _, name := range names {
+		f.solvers = append(f.solvers, captchaProviderSolvers[name])
+	}
+	return f
+}
+
+// Name lists the providers in order, e.g. "ezcaptcha,2captcha".
+func (f *failoverSolver) Name() string {
+	names := make([]string, len(f.solvers))
+	for i, solver := range f.solvers {
+		names[i] = solver.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *failoverSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	token, _, err := f.solve(ctx, siteKey, pageURL)
+	return token, err
+}
+
+// solve returns a token along with the name of the provider that solved it.
+// When every provider fails, the error of the last one tried is returned.
+func (f *failoverSolver) solve(ctx context.Context, siteKey, pageURL string) (string, string, error) {
+	var lastErr error
+	for i, solver := range f.solvers {
+		if f.empty(solver.Name()) {
+			debugPrint(fmt.Sprintf("Skipping captcha provider %s, its balance is empty", solver.Name()))
+			continue
+		}
+		token, err := solver.Solve(ctx, siteKey, pageURL)
+		if err == nil {
+			return token, solver.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return "", solver.Name(), err
+		}
+		lastErr = fmt.Errorf("%s: %w", solver.Name(), err)
+		if i < len(f.solvers)-1 {
+			errorf("Captcha provider %s failed, falling back to the next one: %v\n", solver.Name(), err)
+		}
+	}
+	if lastErr == nil {
+		return "", "", fmt.Errorf("every captcha provider has an empty balance")
+	}
+	return "", "", lastErr
+}
+
+// Balance returns the combined balance of every provider that answered, and
+// remembers each one so that empty providers are skipped.
+func (f *failoverSolver) Balance() (float64, error) {
+	var total float64
+	var answered int
+	var lastErr error
+	for _, solver := range f.solvers {
+		balance, err := solver.Balance()
+		if err != nil {
+			debugPrint(fmt.Sprintf("Error checking %s balance: %v", solver.Name(), err))
+			lastErr = fmt.Errorf("%s: %w", solver.Name(), err)
+			continue
+		}
+		f.mu.Lock()
+		f.balances[solver.Name()] = balance
+		f.mu.Unlock()
+		total += balance
+		answered++
+	}
+	if answered == 0 {
+		return 0, lastErr
+	}
+	return total, nil
+}
+
+// empty reports whether the last balance read from the named provider was
+// zero or less. Providers never read are assumed to have funds.
+func (f *failoverSolver) empty(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	balance, ok := f.balances[name]
+	return ok && balance <= 0
+}
+
+// checkCaptchaProviders returns a description of every problem with
+// CaptchaProviders.
+func checkCaptchaProviders() []string {
+	if len(config.CaptchaProviders) == 0 {
+		return nil
+	}
+
+	var errs []string
+	if countTrue(config.UseTwoCaptcha, config.UseAntiCaptcha, config.UseCapMonster) > 0 {
+		errs = append(errs, "captcha_providers replaces use_2captcha, use_anticaptcha and use_capmonster, which must not be set with it")
+	}
+	keys := map[string]string{
+		captchaProviderEZCaptcha:   config.EZCaptchaAPIKey,
+		captchaProviderTwoCaptcha:  config.TwoCaptchaAPIKey,
+		captchaProviderAntiCaptcha: config.AntiCaptchaAPIKey,
+		captchaProviderCapMonster:  config.CapMonsterAPIKey,
+	}
+	seen := make(map[string]bool)
+	for _, name := range config.CaptchaProviders {
+		key, ok := keys[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("Unsupported captcha provider %q (expected ezcaptcha, 2captcha, anticaptcha or capmonster)", name))
+		case seen[name]:
+			errs = append(errs, fmt.Sprintf("Captcha provider %q is listed more than once", name))
+		case key == "":
+			errs = append(errs, fmt.Sprintf("API key for captcha provider %q is missing", name))
+		case name == captchaProviderTwoCaptcha && config.CaptchaType == captchaTypeTurnstile:
+			errs = append(errs, "Captcha provider 2captcha does not support turnstile")
+		}
+		seen[name] = true
+	}
+	return errs
+}
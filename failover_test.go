@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFailoverSolverFallsBack(t *testing.T) {
+	oldOutput := logOutput
+	logOutput = io.Discard
+	defer func() { logOutput = oldOutput }()
+
+	first := &namedCaptchaSolver{name: "first", err: errors.New("provider down")}
+	second := &namedCaptchaSolver{name: "second", balance: 2.5}
+	f := newFailoverSolver(nil)
+	f.solvers = []CaptchaSolver{first, second}
+	if f.Name() != "first,second" {
+		t.Errorf("Expected the providers listed in order, got %q", f.Name())
+	}
+
+	token, provider, err := f.solve(context.Background(), "key", "https://promo.test")
+	if err != nil || token != "second-token" || provider != "second" {
+		t.Fatalf("Expected the second provider to solve, got %q from %q (%v)", token, provider, err)
+	}
+
+	// Once read as empty, a provider is not tried at all
+	first.err = nil
+	if balance, err := f.Balance(); err != nil || balance != 2.5 {
+		t.Fatalf("Expected a combined balance of 2.50, got %v (%v)", balance, err)
+	}
+	if _, provider, err := f.solve(context.Background(), "key", "https://promo.test"); err != nil || provider != "second" || first.solves != 1 {
+		t.Errorf("Expected the empty provider to be skipped, got %q after %d solves of the first (%v)", provider, first.solves, err)
+	}
+}
+
+func TestFailoverSolverKeepsErrorChain(t *testing.T) {
+	oldOutput := logOutput
+	logOutput = io.Discard
+	defer func() { logOutput = oldOutput }()
+
+	first := &namedCaptchaSolver{name: "first", err: fmt.Errorf("%wno solution", errCaptchaTimeout)}
+	second := &namedCaptchaSolver{name: "second", err: &captchaAPIError{ID: 1, Code: "ERROR_ZERO_BALANCE"}}
+	f := newFailoverSolver(nil)
+	f.solvers = []CaptchaSolver{first, second}
+
+	_, _, err := f.solve(context.Background(), "key", "https://promo.test")
+	var apiErr *captchaAPIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "ERROR_ZERO_BALANCE" || !strings.HasPrefix(err.Error(), "second: ") {
+		t.Errorf("Expected the last provider's captchaAPIError behind its name, got %v", err)
+	}
+
+	f.solvers = []CaptchaSolver{second, first}
+	if _, _, err := f.solve(context.Background(), "key", "https://promo.test"); !errors.Is(err, errCaptchaTimeout) {
+		t.Errorf("Expected errCaptchaTimeout to match through the failover, got %v", err)
+	}
+}
+
+// namedCaptchaSolver solves with a token named after it unless err is set.
+type namedCaptchaSolver struct {
+	name    string
+	balance float64
+	err     error
+	solves  int
+}
+
+func (s *namedCaptchaSolver) Name() string { return s.name }
+
+func (s *namedCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	s.solves++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.name + "-token", nil
+}
+
+func (s *namedCaptchaSolver) Balance() (float64, error) { return s.balance, s.err }
+
+func TestFailoverSolverAllFail(t *testing.T) {
+	oldOutput := logOutput
+	logOutput = io.Discard
+	defer func() { logOutput = oldOutput }()
+
+	f := newFailoverSolver(nil)
+	f.solvers = []CaptchaSolver{stubCaptchaSolver{err: errors.New("first down")}, stubCaptchaSolver{err: errors.New("second down")}}
+	if _, _, err := f.solve(context.Background(), "key", "https://promo.test"); err == nil || !strings.Contains(err.Error(), "second down") {
+		t.Errorf("Expected the last provider's error, got %v", err)
+	}
+}
+
+func TestCheckCaptchaProviders(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{EZCaptchaAPIKey: "ez", TwoCaptchaAPIKey: "two", CaptchaProviders: []string{"ezcaptcha", "2captcha"}}
+	if errs := checkCaptchaProviders(); len(errs) != 0 {
+		t.Errorf("Expected a valid provider list, got %q", errs)
+	}
+
+	config = Config{
+		EZCaptchaAPIKey:  "ez",
+		UseCapMonster:    true,
+		CaptchaType:      captchaTypeTurnstile,
+		TwoCaptchaAPIKey: "two",
+		CaptchaProviders: []string{"ezcaptcha", "ezcaptcha", "anticaptcha", "deathbycaptcha", "2captcha"},
+	}
+	// use_capmonster, the duplicate, the missing key, the unknown name and
+	// 2captcha for turnstile
+	if errs := checkCaptchaProviders(); len(errs) != 5 {
+		t.Errorf("Expected 5 errors, got %q", errs)
+	}
+}
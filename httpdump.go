@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpDumpFileName = "http_dump.log"
+
+var httpDumpMu sync.Mutex
+
+// authHeaderRegex matches credential headers, which may carry secrets that
+// are not in the config, e.g. base64 encoded proxy credentials.
+var authHeaderRegex = regexp.MustCompile(`(?mi)^((?:Proxy-)?Authorization:).*$`)
+
+// dumpTransport writes every request and response passing through it to
+// httpDumpFileName with secrets redacted.
+type dumpTransport struct {
+	next http.RoundTripper
+}
+
+// dumpingTransport wraps next in a dumpTransport when DumpHTTP is set and
+// returns next unchanged otherwise. A nil next stands for
+// http.DefaultTransport.
+func dumpingTransport(next http.RoundTripper) http.RoundTripper {
+	if !config.DumpHTTP {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &dumpTransport{next: next}
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqDump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		reqDump = []byte(fmt.Sprintf("error dumping request: %v", err))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		writeHTTPDump(reqDump, []byte(fmt.Sprintf("error: %v", err)))
+		return nil, err
+	}
+
+	respDump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		respDump = []byte(fmt.Sprintf("error dumping response: %v", err))
+	}
+	writeHTTPDump(reqDump, respDump)
+	return resp, nil
+}
+
+func writeHTTPDump(reqDump, respDump []byte) {
+	httpDumpMu.Lock()
+	defer httpDumpMu.Unlock()
+
+	file, err := os.OpenFile(httpDumpFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		errorf("Error opening HTTP dump file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	dump := fmt.Sprintf("=== %s ===\n--- request ---\n%s\n--- response ---\n%s\n\n",
+		time.Now().Format(time.RFC3339), reqDump, respDump)
+	if _, err := file.WriteString(redactSecrets(dump)); err != nil {
+		errorf("Error writing HTTP dump: %v\n", err)
+	}
+}
+
+// isSecretField reports whether the Config field f holds a credential,
+// marked with a secret:"true" tag. Only those are redacted and masked; other
+// values that can come from the environment, such as usernames, are not.
+func isSecretField(f reflect.StructField) bool {
+	return f.Tag.Get("secret") == "true"
+}
+
+// redactSecrets replaces the credential headers and the value of every
+// secret Config field in s.
+func redactSecrets(s string) string {
+	s = authHeaderRegex.ReplaceAllString(s, "$1 [REDACTED]")
+
+	v := reflect.ValueOf(config)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !isSecretField(t.Field(i)) || v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		secret := v.Field(i).String()
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+		s = strings.ReplaceAll(s, url.QueryEscape(secret), "[REDACTED]")
+	}
+	return s
+}
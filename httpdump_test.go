@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDumpHTTPRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errorId":0,"taskId":"task_1"}`))
+	}))
+	defer server.Close()
+
+	oldConfig, oldDumpFileName := config, httpDumpFileName
+	defer func() { config, httpDumpFileName = oldConfig, oldDumpFileName }()
+	config.DumpHTTP = true
+	config.EZCaptchaAPIKey = "secret_ez_key"
+	config.ProxyPassword = "proxy pass"
+	config.ProxyUsername = "proxy_user"
+	httpDumpFileName = t.TempDir() + "/http_dump.log"
+
+	var result map[string]interface{}
+	payload := map[string]string{"clientKey": config.EZCaptchaAPIKey, "note": "proxy pass", "user": "proxy_user"}
+	if err := postJSON(context.Background(), server.URL+"/createTask?password=proxy+pass", payload, &result); err != nil {
+		t.Fatalf("postJSON returned an error: %v", err)
+	}
+	if result["taskId"] != "task_1" {
+		t.Errorf("Expected the response body to still be readable, got %v", result)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Authorization", "Bearer cloudflare_token")
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(httpDumpFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(data)
+	// Only the secret fields are redacted, not every value the environment can set
+	for _, want := range []string{"POST /createTask", `"taskId":"task_1"`, "Authorization: [REDACTED]", "proxy_user"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected the dump to contain %q:\n%s", want, dump)
+		}
+	}
+	for _, secret := range []string{"secret_ez_key", "proxy pass", "proxy+pass", "cloudflare_token"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("Expected %q to be redacted:\n%s", secret, dump)
+		}
+	}
+}
+
+func TestDumpingTransportDisabled(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.DumpHTTP = false
+
+	if transport := dumpingTransport(nil); transport != nil {
+		t.Errorf("Expected no transport wrapper without dump_http, got %T", transport)
+	}
+}
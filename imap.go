@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// defaultCodeRegex matches codes shaped like XXXX-XXXX-XXXX.
+const defaultCodeRegex = `\b[A-Z0-9]{4}(?:-[A-Z0-9]{4}){2,}\b`
+
+// imapCodePollInterval is how often waitForPromoCode re-checks the inbox.
+const imapCodePollInterval = 15 * time.Second
+
+// fetchPromoCode searches the IMAP inbox for a message addressed to alias and
+// extracts the promo code from it. It returns an empty code without an error
+// when no matching message has arrived yet.
+func fetchPromoCode(alias string) (string, error) {
+	addr := config.IMAPHost
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "993")
+	}
+
+	c, err := client.DialWithDialerTLS(&net.Dialer{Timeout: httpTimeout()}, addr, nil)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to IMAP server: %v", err)
+	}
+	defer c.Logout()
+	c.Timeout = httpTimeout()
+
+	if err := c.Login(config.IMAPUsername, config.IMAPPassword); err != nil {
+		return "", fmt.Errorf("error logging in to IMAP server: %v", err)
+	}
+
+	if _, err := c.Select("INBOX", true); err != nil {
+		return "", fmt.Errorf("error selecting INBOX: %v", err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header = textproto.MIMEHeader{}
+	criteria.Header.Add("To", alias)
+	ids, err := c.Search(criteria)
+	if err != nil {
+		return "", fmt.Errorf("error searching INBOX: %v", err)
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, len(ids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var code string
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil || code != "" {
+			continue
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			continue
+		}
+		code = extractPromoCode(string(data), promoCodeRegex)
+	}
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("error fetching messages: %v", err)
+	}
+
+	return code, nil
+}
+
+// waitForPromoCode polls fetchPromoCode until a code arrives or
+// IMAPWaitTimeout seconds pass.
+func waitForPromoCode(ctx context.Context, alias string) (string, error) {
+	return pollPromoCode(ctx, alias, func() (string, error) {
+		return fetchPromoCode(alias)
+	})
+}
+
+// pollPromoCode calls fetch every imapCodePollInterval until it returns a
+// code for alias or IMAPWaitTimeout seconds pass.
+func pollPromoCode(ctx context.Context, alias string, fetch func() (string, error)) (string, error) {
+	deadline := time.Now().Add(time.Duration(config.IMAPWaitTimeout * float64(time.Second)))
+	for {
+		code, err := fetch()
+		if err != nil {
+			return "", err
+		}
+		if code != "" {
+			return code, nil
+		}
+		if time.Now().Add(imapCodePollInterval).After(deadline) {
+			return "", fmt.Errorf("no promo code received for %s after %.0f seconds", alias, config.IMAPWaitTimeout)
+		}
+
+		debugPrint(fmt.Sprintf("No promo code for %s yet, checking again in %.0fs...", alias, imapCodePollInterval.Seconds()))
+		if err := sleepContext(ctx, imapCodePollInterval); err != nil {
+			return "", err
+		}
+	}
+}
+
+// extractPromoCode returns the first match of re in body, or its first
+// capture group when the pattern has one.
+func extractPromoCode(body string, re *regexp.Regexp) string {
+	match := re.FindStringSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	if len(match) > 1 {
+		return match[1]
+	}
+	return match[0]
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExtractPromoCode(t *testing.T) {
+	body := "Subject: Your reward\r\n\r\nThanks for entering! Your code is AB12-CD34-EF56. Enjoy."
+
+	if got := extractPromoCode(body, regexp.MustCompile(defaultCodeRegex)); got != "AB12-CD34-EF56" {
+		t.Errorf("Expected AB12-CD34-EF56, got %q", got)
+	}
+	if got := extractPromoCode(body, regexp.MustCompile(`code is ([A-Z0-9-]+)\.`)); got != "AB12-CD34-EF56" {
+		t.Errorf("Expected the capture group to be returned, got %q", got)
+	}
+	if got := extractPromoCode("no code here", regexp.MustCompile(defaultCodeRegex)); got != "" {
+		t.Errorf("Expected no code, got %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	logLevelQuiet = "quiet"
+	logLevelInfo  = "info"
+	logLevelDebug = "debug"
+)
+
+// logVerbosity orders the log levels, so a message prints when its level is
+// at most the configured one.
+type logVerbosity int
+
+const (
+	verbosityQuiet logVerbosity = iota
+	verbosityInfo
+	verbosityDebug
+)
+
+var (
+	// logOutput is where every message goes; tests swap it for a buffer.
+	logOutput io.Writer = os.Stdout
+	// logMu serializes writes to logOutput so lines from concurrent workers
+	// never interleave.
+	logMu sync.Mutex
+	// logTap, when set, takes over from logOutput: it receives the messages
+	// shown at every level and the rest are dropped. The -tui dashboard uses
+	// it to list errors and codes without scrolling its counters away.
+	logTap func(message string)
+)
+
+// currentVerbosity returns the verbosity selected by LogLevel. debug_mode is
+// kept as a shorthand for the debug level.
+func currentVerbosity() logVerbosity {
+	switch {
+	case config.DebugMode || config.LogLevel == logLevelDebug:
+		return verbosityDebug
+	case config.LogLevel == logLevelQuiet:
+		return verbosityQuiet
+	default:
+		return verbosityInfo
+	}
+}
+
+// logAt writes the formatted message when level is enabled.
+func logAt(level logVerbosity, format string, args ...interface{}) {
+	if level > currentVerbosity() {
+		return
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logTap != nil {
+		if level == verbosityQuiet {
+			logTap(fmt.Sprintf(format, args...))
+		}
+		return
+	}
+	fmt.Fprintf(logOutput, format, args...)
+}
+
+// errorf prints errors and warnings, which show at every level.
+func errorf(format string, args ...interface{}) {
+	logAt(verbosityQuiet, format, args...)
+}
+
+// outputf prints prompts, summaries and the output of one-shot commands,
+// which show at every level.
+func outputf(format string, args ...interface{}) {
+	logAt(verbosityQuiet, format, args...)
+}
+
+// infof prints progress messages, hidden in quiet mode.
+func infof(format string, args ...interface{}) {
+	logAt(verbosityInfo, format, args...)
+}
+
+func debugPrint(message string) {
+	logAt(verbosityDebug, "[DEBUG] %s\n", message)
+}
+
+// checkLogLevel returns a description of a problem with LogLevel, if any.
+func checkLogLevel() []string {
+	if config.LogLevel == "" {
+		config.LogLevel = logLevelInfo // Set a default value if not specified
+	}
+	switch config.LogLevel {
+	case logLevelQuiet, logLevelInfo, logLevelDebug:
+		return nil
+	}
+	return []string{fmt.Sprintf("Unsupported log level %q (expected quiet, info or debug)", config.LogLevel)}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	oldConfig, oldOutput := config, logOutput
+	defer func() { config, logOutput = oldConfig, oldOutput }()
+
+	tests := []struct {
+		level     string
+		debugMode bool
+		wantInfo  bool
+		wantDebug bool
+	}{
+		{level: logLevelQuiet},
+		{level: logLevelInfo, wantInfo: true},
+		{level: logLevelDebug, wantInfo: true, wantDebug: true},
+		{level: logLevelInfo, debugMode: true, wantInfo: true, wantDebug: true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logOutput = &buf
+		config = Config{LogLevel: tt.level, DebugMode: tt.debugMode}
+
+		errorf("an error\n")
+		outputf("a summary\n")
+		infof("a progress line\n")
+		debugPrint("a debug line")
+
+		out := buf.String()
+		if !strings.Contains(out, "an error") || !strings.Contains(out, "a summary") {
+			t.Errorf("level %s: expected errors and summaries, got %q", tt.level, out)
+		}
+		if got := strings.Contains(out, "a progress line"); got != tt.wantInfo {
+			t.Errorf("level %s (debug_mode %v): progress printed = %v, want %v", tt.level, tt.debugMode, got, tt.wantInfo)
+		}
+		if got := strings.Contains(out, "[DEBUG] a debug line"); got != tt.wantDebug {
+			t.Errorf("level %s (debug_mode %v): debug printed = %v, want %v", tt.level, tt.debugMode, got, tt.wantDebug)
+		}
+	}
+}
+
+func TestLogLinesDoNotInterleave(t *testing.T) {
+	oldConfig, oldOutput := config, logOutput
+	defer func() { config, logOutput = oldConfig, oldOutput }()
+
+	var buf bytes.Buffer
+	logOutput = &buf
+	config = Config{LogLevel: logLevelInfo}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				infof("worker %d line %d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 20*50 {
+		t.Fatalf("Expected %d lines, got %d", 20*50, len(lines))
+	}
+	for _, line := range lines {
+		var i, j int
+		if n, err := fmt.Sscanf(line, "worker %d line %d", &i, &j); n != 2 || err != nil {
+			t.Fatalf("Garbled line %q", line)
+		}
+	}
+}
+
+func TestCheckLogLevel(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{}
+	if errs := checkLogLevel(); len(errs) != 0 || config.LogLevel != logLevelInfo {
+		t.Errorf("Expected the default level info, got %q and %v", config.LogLevel, errs)
+	}
+	config.LogLevel = "verbose"
+	if errs := checkLogLevel(); len(errs) != 1 {
+		t.Errorf("Expected an error for an unknown level, got %v", errs)
+	}
+}
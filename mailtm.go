@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// mailTMPasswordLength is the length of the random password each mail.tm
+// account is created with.
+const mailTMPasswordLength = 24
+
+// mailTMProvider creates a mail.tm account for every alias and reads the
+// promo code from its inbox. The API token of each account is kept in memory
+// for FetchCode and Cleanup, so accounts left over from an earlier run can
+// only be removed on mail.tm itself.
+type mailTMProvider struct {
+	mu     sync.Mutex
+	domain string
+	// tokens maps account IDs to their bearer tokens
+	tokens map[string]string
+}
+
+func newMailTMProvider() *mailTMProvider {
+	return &mailTMProvider{tokens: make(map[string]string)}
+}
+
+func (p *mailTMProvider) Name() string { return emailProviderMailTM }
+
+// mailTMRequest sends a request to the mail.tm API with body encoded as JSON
+// and decodes the response into result, unless it is nil. token is sent as
+// the bearer token when it is not empty.
+func mailTMRequest(ctx context.Context, method, path, token string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %v", err)
+		}
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, config.MailTMBaseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/ld+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("mail.tm %s %s returned status code: %d, response: %s", method, path, resp.StatusCode, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// accountDomain returns the first active mail.tm domain, looked up once.
+func (p *mailTMProvider) accountDomain(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.domain != "" {
+		return p.domain, nil
+	}
+
+	var domains struct {
+		Members []struct {
+			Domain   string `json:"domain"`
+			IsActive bool   `json:"isActive"`
+		} `json:"hydra:member"`
+	}
+	if err := mailTMRequest(ctx, "GET", "/domains", "", nil, &domains); err != nil {
+		return "", fmt.Errorf("error listing mail.tm domains: %v", err)
+	}
+	for _, domain := range domains.Members {
+		if domain.IsActive {
+			p.domain = domain.Domain
+			return p.domain, nil
+		}
+	}
+	return "", fmt.Errorf("mail.tm has no active domain")
+}
+
+// CreateAlias creates a mail.tm account on a random alias and returns its
+// address and account ID.
+func (p *mailTMProvider) CreateAlias(ctx context.Context) (string, string, error) {
+	domain, err := p.accountDomain(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	alias, err := generateAlias()
+	if err != nil {
+		return "", "", fmt.Errorf("error generating random alias: %v", err)
+	}
+	password, err := generateRandomAlias(mailTMPasswordLength)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating password: %v", err)
+	}
+
+	credentials := map[string]string{
+		"address":  strings.ToLower(alias) + "@" + domain,
+		"password": password,
+	}
+	var account struct {
+		ID      string `json:"id"`
+		Address string `json:"address"`
+	}
+	if err := mailTMRequest(ctx, "POST", "/accounts", "", credentials, &account); err != nil {
+		return "", "", fmt.Errorf("error creating mail.tm account: %v", err)
+	}
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := mailTMRequest(ctx, "POST", "/token", "", credentials, &token); err != nil {
+		return "", "", fmt.Errorf("error logging in to mail.tm account: %v", err)
+	}
+
+	p.mu.Lock()
+	p.tokens[account.ID] = token.Token
+	p.mu.Unlock()
+	return account.Address, account.ID, nil
+}
+
+// token returns the bearer token of the account with the given ID.
+func (p *mailTMProvider) token(id string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token, ok := p.tokens[id]
+	if !ok {
+		return "", fmt.Errorf("no token for mail.tm account %s", id)
+	}
+	return token, nil
+}
+
+// FetchCode reads the messages received by the account with the given ID
+// and extracts the promo code from the first one that has it.
+func (p *mailTMProvider) FetchCode(ctx context.Context, id string) (string, error) {
+	token, err := p.token(id)
+	if err != nil {
+		return "", err
+	}
+
+	var messages struct {
+		Members []struct {
+			ID string `json:"id"`
+		} `json:"hydra:member"`
+	}
+	if err := mailTMRequest(ctx, "GET", "/messages", token, nil, &messages); err != nil {
+		return "", fmt.Errorf("error listing mail.tm messages: %v", err)
+	}
+
+	for _, member := range messages.Members {
+		var message struct {
+			Text string   `json:"text"`
+			HTML []string `json:"html"`
+		}
+		if err := mailTMRequest(ctx, "GET", "/messages/"+member.ID, token, nil, &message); err != nil {
+			return "", fmt.Errorf("error reading mail.tm message: %v", err)
+		}
+		body := message.Text + "\n" + strings.Join(message.HTML, "\n")
+		if code := extractPromoCode(body, promoCodeRegex); code != "" {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+// Cleanup deletes the account with the given ID.
+func (p *mailTMProvider) Cleanup(ctx context.Context, id string) error {
+	token, err := p.token(id)
+	if err != nil {
+		return err
+	}
+	if err := mailTMRequest(ctx, "DELETE", "/accounts/"+id, token, nil, nil); err != nil {
+		return fmt.Errorf("error deleting mail.tm account: %v", err)
+	}
+
+	p.mu.Lock()
+	delete(p.tokens, id)
+	p.mu.Unlock()
+	return nil
+}
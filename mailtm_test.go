@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newMailTMServer returns a mock mail.tm API with one active domain whose
+// accounts each have a single promo code message.
+func newMailTMServer(t *testing.T, deleted *[]string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/domains" && r.URL.Path != "/accounts" && r.URL.Path != "/token" && r.Header.Get("Authorization") != "Bearer token_1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /domains":
+			w.Write([]byte(`{"hydra:member":[{"domain":"inactive.test","isActive":false},{"domain":"mail.test","isActive":true}]}`))
+		case "POST /accounts":
+			var credentials map[string]string
+			json.NewDecoder(r.Body).Decode(&credentials)
+			if credentials["password"] == "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"id": "account_1", "address": credentials["address"]})
+		case "POST /token":
+			w.Write([]byte(`{"id":"account_1","token":"token_1"}`))
+		case "GET /messages":
+			w.Write([]byte(`{"hydra:member":[{"id":"welcome"},{"id":"promo"}]}`))
+		case "GET /messages/welcome":
+			w.Write([]byte(`{"text":"Welcome to mail.tm","html":[]}`))
+		case "GET /messages/promo":
+			w.Write([]byte(`{"text":"","html":["<p>Your code: <b>ABCD-EFGH-IJKL</b></p>"]}`))
+		case "DELETE /accounts/account_1":
+			*deleted = append(*deleted, "account_1")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	oldMailTMBaseURL := config.MailTMBaseURL
+	config.MailTMBaseURL = server.URL
+	t.Cleanup(func() {
+		config.MailTMBaseURL = oldMailTMBaseURL
+		server.Close()
+	})
+}
+
+func TestMailTMProvider(t *testing.T) {
+	var deleted []string
+	newMailTMServer(t, &deleted)
+
+	oldConfig, oldPromoCodeRegex := config, promoCodeRegex
+	defer func() { config, promoCodeRegex = oldConfig, oldPromoCodeRegex }()
+	promoCodeRegex = regexp.MustCompile(defaultCodeRegex)
+
+	provider := newMailTMProvider()
+	email, id, err := provider.CreateAlias(context.Background())
+	if err != nil {
+		t.Fatalf("CreateAlias returned an error: %v", err)
+	}
+	if !strings.HasSuffix(email, "@mail.test") || id != "account_1" {
+		t.Errorf("Expected an address on the active domain and its account ID, got %q and %q", email, id)
+	}
+
+	code, err := provider.FetchCode(context.Background(), id)
+	if err != nil || code != "ABCD-EFGH-IJKL" {
+		t.Errorf("Expected the code from the promo message, got %q: %v", code, err)
+	}
+
+	if err := provider.Cleanup(context.Background(), id); err != nil {
+		t.Fatalf("Cleanup returned an error: %v", err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("Expected the account to be deleted, got %v", deleted)
+	}
+	if _, err := provider.FetchCode(context.Background(), id); err == nil {
+		t.Error("Expected an error for a deleted account")
+	}
+}
@@ -3,92 +3,230 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"crypto/rand"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"math/big"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 type Config struct {
-	CloudflareAPIToken string  `json:"cloudflare_api_token"`
-	EZCaptchaAPIKey    string  `json:"ez_captcha_api_key"`
-	TwoCaptchaAPIKey   string  `json:"2captcha_api_key"`
-	RecaptchaSiteKey   string  `json:"recaptcha_site_key"`
-	EmailDomain        string  `json:"email_domain"`
-	CloudflareZoneID   string  `json:"cloudflare_zone_id"`
-	ForwardToEmail     string  `json:"forward_to_email"`
-	MonsterPromoURL    string  `json:"monster_promo_url"`
-	MonsterSubmitURL   string  `json:"monster_submit_url"`
-	UseProxy           bool    `json:"use_proxy"`
-	ProxyUsername      string  `json:"proxy_username"`
-	ProxyPassword      string  `json:"proxy_password"`
-	ProxyDNS           string  `json:"proxy_dns"`
-	ProxyPort          string  `json:"proxy_port"`
-	UseCloudflareEmail bool    `json:"use_cloudflare_email"`
-	DebugMode          bool    `json:"debug_mode"`
-	UseTwoCaptcha      bool    `json:"use_2captcha"`
-	MaxCaptchaRetries  int     `json:"max_captcha_retries"`
-	CaptchaTimeout     float64 `json:"captcha_timeout"`
+	ConfigVersion         int               `json:"config_version"`
+	CloudflareAPIToken    string            `json:"cloudflare_api_token" env:"PROMOGEN_CLOUDFLARE_API_TOKEN" secret:"true"`
+	EZCaptchaAPIKey       string            `json:"ez_captcha_api_key" env:"PROMOGEN_EZCAPTCHA_API_KEY" secret:"true"`
+	TwoCaptchaAPIKey      string            `json:"2captcha_api_key" env:"PROMOGEN_2CAPTCHA_API_KEY" secret:"true"`
+	AntiCaptchaAPIKey     string            `json:"anticaptcha_api_key" env:"PROMOGEN_ANTICAPTCHA_API_KEY" secret:"true"`
+	CapMonsterAPIKey      string            `json:"capmonster_api_key" env:"PROMOGEN_CAPMONSTER_API_KEY" secret:"true"`
+	RecaptchaSiteKey      string            `json:"recaptcha_site_key"`
+	RecaptchaVersion      string            `json:"recaptcha_version"`
+	RecaptchaAction       string            `json:"recaptcha_action"`
+	RecaptchaMinScore     float64           `json:"recaptcha_min_score"`
+	RecaptchaEnterprise   bool              `json:"recaptcha_enterprise"`
+	EnterprisePayload     map[string]string `json:"enterprise_payload"`
+	TurnstileSiteKey      string            `json:"turnstile_site_key"`
+	HCaptchaSiteKey       string            `json:"hcaptcha_site_key"`
+	CheckSiteKey          bool              `json:"check_sitekey"`
+	CaptchaType           string            `json:"captcha_type"`
+	EmailDomain           string            `json:"email_domain"`
+	CloudflareZoneID      string            `json:"cloudflare_zone_id" env:"PROMOGEN_CLOUDFLARE_ZONE_ID"`
+	ForwardToEmail        string            `json:"forward_to_email"`
+	ForwardToEmails       []string          `json:"forward_to_emails"`
+	AliasActions          []AliasAction     `json:"alias_actions"`
+	MonsterPromoURL       string            `json:"monster_promo_url"`
+	MonsterSubmitURL      string            `json:"monster_submit_url"`
+	Targets               []Target          `json:"targets"`
+	ExtraFormFields       map[string]string `json:"extra_form_fields"`
+	Region                string            `json:"region"`
+	AgeConfirmed          bool              `json:"age_confirmed"`
+	ScrapeCSRFToken       bool              `json:"scrape_csrf_token"`
+	CSRFFieldName         string            `json:"csrf_field_name"`
+	CSRFTokenRegex        string            `json:"csrf_token_regex"`
+	ExtraHeaders          map[string]string `json:"extra_headers"`
+	SubmitContentType     string            `json:"submit_content_type"`
+	CaptchaRejectCodes    []string          `json:"captcha_reject_codes"`
+	Referer               string            `json:"referer"`
+	AcceptLanguage        string            `json:"accept_language"`
+	SuccessMarker         string            `json:"success_marker"`
+	EndedMarker           string            `json:"ended_marker"`
+	UseProxy              bool              `json:"use_proxy"`
+	ProxyScheme           string            `json:"proxy_scheme"`
+	ProxyList             string            `json:"proxy_list"`
+	ProxyDeadSkip         int               `json:"proxy_dead_skip"`
+	ProxyStateFile        string            `json:"proxy_state_file"`
+	ProxyDeadTTL          float64           `json:"proxy_dead_ttl"`
+	ProxyUsername         string            `json:"proxy_username" env:"PROMOGEN_PROXY_USERNAME"`
+	ProxyPassword         string            `json:"proxy_password" env:"PROMOGEN_PROXY_PASSWORD" secret:"true"`
+	ProxyDNS              string            `json:"proxy_dns"`
+	ProxyPort             string            `json:"proxy_port"`
+	ProxyCheckURL         string            `json:"proxy_check_url"`
+	ProxyAuthHeader       bool              `json:"proxy_auth_header"`
+	Proxy                 string            `json:"proxy,omitempty"`
+	SpoofTLS              bool              `json:"spoof_tls"`
+	UseCloudflareEmail    bool              `json:"use_cloudflare_email"`
+	EmailProviderName     string            `json:"email_provider"`
+	AliasPoolSize         int               `json:"alias_pool_size"`
+	AliasPattern          string            `json:"alias_pattern"`
+	AliasCharset          string            `json:"alias_charset"`
+	AliasLength           int               `json:"alias_length"`
+	CleanupAliases        bool              `json:"cleanup_aliases"`
+	IMAPHost              string            `json:"imap_host"`
+	IMAPUsername          string            `json:"imap_username" env:"PROMOGEN_IMAP_USERNAME"`
+	IMAPPassword          string            `json:"imap_password" env:"PROMOGEN_IMAP_PASSWORD" secret:"true"`
+	IMAPWaitTimeout       float64           `json:"imap_wait_timeout"`
+	CodeRegex             string            `json:"code_regex"`
+	CodesFile             string            `json:"codes_file"`
+	DebugMode             bool              `json:"debug_mode"`
+	DumpHTTP              bool              `json:"dump_http"`
+	DryRun                bool              `json:"dry_run"`
+	DryRunFakeCaptcha     bool              `json:"dry_run_fake_captcha"`
+	LogFormat             string            `json:"log_format"`
+	LogLevel              string            `json:"log_level"`
+	LogMaxSizeMB          int               `json:"log_max_size_mb"`
+	LogMaxBackups         int               `json:"log_max_backups"`
+	RunID                 string            `json:"run_id"`
+	CSVOutput             string            `json:"csv_output"`
+	DBPath                string            `json:"db_path"`
+	MetricsAddr           string            `json:"metrics_addr"`
+	APIAddr               string            `json:"api_addr"`
+	APIToken              string            `json:"api_token" env:"PROMOGEN_API_TOKEN" secret:"true"`
+	DiscordWebhookURL     string            `json:"discord_webhook_url" env:"PROMOGEN_DISCORD_WEBHOOK_URL" secret:"true"`
+	CodeWebhookURL        string            `json:"code_webhook_url" env:"PROMOGEN_CODE_WEBHOOK_URL" secret:"true"`
+	TelegramBotToken      string            `json:"telegram_bot_token" env:"PROMOGEN_TELEGRAM_BOT_TOKEN" secret:"true"`
+	TelegramChatID        string            `json:"telegram_chat_id"`
+	TelegramInterval      float64           `json:"telegram_progress_interval"`
+	LowBalanceAlert       float64           `json:"low_balance_alert"`
+	MinBalance            float64           `json:"min_balance"`
+	BalanceCacheTTL       float64           `json:"balance_cache_ttl"`
+	EntriesPerClearance   int               `json:"entries_per_clearance"`
+	SingleEntryMode       bool              `json:"single_entry_mode"`
+	BalanceCheckEvery     int               `json:"balance_check_every"`
+	UseTwoCaptcha         bool              `json:"use_2captcha"`
+	UseAntiCaptcha        bool              `json:"use_anticaptcha"`
+	UseCapMonster         bool              `json:"use_capmonster"`
+	CaptchaProviders      []string          `json:"captcha_providers"`
+	MaxCaptchaRetries     int               `json:"max_captcha_retries"`
+	MaxCaptchaResolves    int               `json:"max_captcha_resolves"`
+	MaxConcurrentCaptchas int               `json:"max_concurrent_captchas"`
+	BreakerThreshold      int               `json:"captcha_breaker_threshold"`
+	BreakerCooldown       float64           `json:"captcha_breaker_cooldown"`
+	MaxSubmitRetries      int               `json:"max_submit_retries"`
+	UserAgents            []string          `json:"user_agents"`
+	CaptchaTimeout        float64           `json:"captcha_timeout"`
+	CaptchaInitialDelay   float64           `json:"captcha_initial_delay"`
+	CaptchaPollInterval   float64           `json:"captcha_poll_interval"`
+	CostPerThousand       float64           `json:"cost_per_thousand"`
+	RandSeed              int64             `json:"rand_seed"`
+	HTTPTimeout           float64           `json:"http_timeout"`
+	Concurrency           int               `json:"concurrency"`
+	MaxSubmissions        int               `json:"max_submissions"`
+	MaxRuntime            float64           `json:"max_runtime"`
+	SubmissionsPerMinute  float64           `json:"submissions_per_minute"`
+	DelayMin              float64           `json:"delay_min"`
+	DelayMax              float64           `json:"delay_max"`
+	Schedule              string            `json:"schedule"`
+	BatchSize             int               `json:"batch_size"`
+	CooldownThreshold     int               `json:"cooldown_threshold"`
+	CooldownInitial       float64           `json:"cooldown_initial"`
+	CooldownMax           float64           `json:"cooldown_max"`
+	MinSuccessRate        float64           `json:"min_success_rate"`
+	SuccessRateWindow     int               `json:"success_rate_window"`
+	SuccessRatePause      float64           `json:"success_rate_pause"`
+	CloudflareAPIBaseURL  string            `json:"cloudflare_api_base_url"`
+	EZCaptchaBaseURL      string            `json:"ez_captcha_base_url"`
+	TwoCaptchaBaseURL     string            `json:"two_captcha_base_url"`
+	AntiCaptchaBaseURL    string            `json:"anticaptcha_base_url"`
+	CapMonsterBaseURL     string            `json:"capmonster_base_url"`
+	TelegramAPIBaseURL    string            `json:"telegram_api_base_url"`
+	MailTMBaseURL         string            `json:"mailtm_base_url"`
+	S3Endpoint            string            `json:"s3_endpoint"`
+	S3Region              string            `json:"s3_region"`
+	S3Bucket              string            `json:"s3_bucket"`
+	S3Prefix              string            `json:"s3_prefix"`
+	S3AccessKey           string            `json:"s3_access_key" env:"PROMOGEN_S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey           string            `json:"s3_secret_key" env:"PROMOGEN_S3_SECRET_KEY" secret:"true"`
+	S3UploadInterval      float64           `json:"s3_upload_interval"`
 }
 
 var config Config
 
+// promoCodeRegex is compiled from CodeRegex by validateConfig.
+var promoCodeRegex *regexp.Regexp
+
+var (
+	configFileName        = "config.json"
+	submissionLogFileName = "submissions.log"
+)
+
+// Default base URLs of the provider APIs, used unless overridden in the
+// config file.
 const (
-	configFileName       = "config.json"
-	cloudflareAPIBaseURL = "https://api.cloudflare.com/client/v4"
-	ezCaptchaBaseURL     = "https://api.ez-captcha.com"
-	twoCaptchaBaseURL    = "https://api.2captcha.com"
-	modeInteractive      = 1
-	modeAutomatic        = 2
+	defaultCloudflareAPIBaseURL = "https://api.cloudflare.com/client/v4"
+	defaultEZCaptchaBaseURL     = "https://api.ez-captcha.com"
+	defaultTwoCaptchaBaseURL    = "https://api.2captcha.com"
+	defaultAntiCaptchaBaseURL   = "https://api.anti-captcha.com"
+	defaultCapMonsterBaseURL    = "https://api.capmonster.cloud"
+	defaultTelegramAPIBaseURL   = "https://api.telegram.org"
+	defaultMailTMBaseURL        = "https://api.mail.tm"
 )
 
-type eZCaptchaTask struct {
-	ClientKey string `json:"clientKey"`
-	Task      struct {
-		Type       string `json:"type"`
-		WebsiteURL string `json:"websiteURL"`
-		WebsiteKey string `json:"websiteKey"`
-		SParams    string `json:"sParams"`
-	} `json:"task"`
-}
+const (
+	modeInteractive = 1
+	modeAutomatic   = 2
+	modeAPI         = 3
+	modeSchedule    = 4
+)
 
-type eZCaptchaResult struct {
-	Status   string `json:"status"`
-	Solution struct {
-		GRecaptchaResponse string `json:"gRecaptchaResponse"`
-	} `json:"solution"`
+// modeNames maps the -mode flag values and the prompt answers to modes.
+var modeNames = map[string]int{
+	"interactive": modeInteractive,
+	"automatic":   modeAutomatic,
+	"api":         modeAPI,
+	"schedule":    modeSchedule,
+	"1":           modeInteractive,
+	"2":           modeAutomatic,
+	"3":           modeAPI,
+	"4":           modeSchedule,
 }
 
-type twoCaptchaTask struct {
-	ClientKey string `json:"clientKey"`
-	Task      struct {
-		Type       string `json:"type"`
-		WebsiteURL string `json:"websiteURL"`
-		WebsiteKey string `json:"websiteKey"`
-	} `json:"task"`
-}
+const (
+	captchaTypeRecaptchaV2 = "recaptcha_v2"
+	captchaTypeTurnstile   = "turnstile"
+	captchaTypeHCaptcha    = "hcaptcha"
+)
 
-type twoCaptchaResult struct {
-	Status   string `json:"status"`
-	Solution struct {
-		GRecaptchaResponse string `json:"gRecaptchaResponse"`
-	} `json:"solution"`
-}
+const (
+	recaptchaVersionV2 = "v2"
+	recaptchaVersionV3 = "v3"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+const (
+	submitContentTypeForm = "form"
+	submitContentTypeJSON = "json"
+)
 
 type cloudflareEmailRule struct {
-	Actions []struct {
-		Type  string   `json:"type"`
-		Value []string `json:"value"`
-	} `json:"actions"`
-	Enabled  bool `json:"enabled"`
+	Actions  []AliasAction `json:"actions"`
+	Enabled  bool          `json:"enabled"`
 	Matchers []struct {
 		Field string `json:"field"`
 		Type  string `json:"type"`
@@ -99,189 +237,1286 @@ type cloudflareEmailRule struct {
 }
 
 func main() {
+	flag.StringVar(&configFileName, "config", configFileName, "path to the config file")
+	validateOnly := flag.Bool("validate", false, "load and validate the config file, then exit")
+	report := flag.Bool("report", false, "print a summary of the submission database, then exit")
+	checkSiteKeyOnly := flag.Bool("check-sitekey", false, "compare the configured site key with the promo page, then exit")
+	testCaptchaOnly := flag.Bool("test-captcha", false, "solve one captcha with the configured provider and site key, print the token, solve time and cost, then exit")
+	updateSiteKey := flag.Bool("update-sitekey", false, "use the site key found on the promo page when it differs from the configured one")
+	modeFlag := flag.String("mode", "", "start this mode without prompting: interactive, automatic, api or schedule")
+	delayFlag := flag.String("delay", "", "delay between automatic mode submissions in seconds, or a range like 5-15")
+	pruneAliases := flag.Duration("prune-aliases", 0, "delete forwarding rules created more than this long ago (e.g. 72h), then exit")
+	pruneRun := flag.String("prune-run", "", "delete the forwarding rules created by this run ID, then exit; combine with -prune-aliases to keep recent ones")
+	listAliases := flag.Bool("list-aliases", false, "print every forwarding rule this tool created in the zone, then exit")
+	cleanupAliases := flag.Bool("cleanup-aliases", false, "delete every forwarding rule this tool created in the zone after confirming, then exit")
+	olderThan := flag.Duration("older-than", 0, "limit -list-aliases and -cleanup-aliases to rules created more than this long ago (e.g. 72h)")
+	runPrefix := flag.String("run-prefix", "", "limit -list-aliases and -cleanup-aliases to rules of run IDs starting with this")
+	yes := flag.Bool("yes", false, "delete without asking for confirmation with -cleanup-aliases")
+	emailsFlag := flag.String("emails", "", "read one email address per line from this file, or - for stdin, instead of prompting for each entry")
+	replayFlag := flag.String("replay", "", "resubmit the failed entries of this CSV results file with the same addresses, appending the outcomes to it")
+	tui := flag.Bool("tui", false, "show a live dashboard in place of progress lines during automatic mode, when stdout is a terminal")
+	installServiceFlag := flag.Bool("install-service", false, "install a system service that runs automatic mode with -config, -delay and -emails, then exit")
+	uninstallServiceFlag := flag.Bool("uninstall-service", false, "stop and remove the installed system service, then exit")
+	runServiceFlag := flag.Bool("run-service", false, "run automatic mode under the system service manager, as the installed service does")
+	configure := flag.Bool("configure", false, "walk through the config file fields interactively and write it back, then exit")
+	migrate := flag.Bool("migrate", false, "upgrade the config file to the current config_version and write it back, then exit")
+	showVersion := flag.Bool("version", false, "print the version and build information, then exit")
+	serveMockAddr := flag.String("serve-mock", "", "serve fake Cloudflare, EZ Captcha and promo endpoints on this address for offline runs")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if *showVersion {
+		outputf("Promogen %s\n", versionString())
+		return
+	}
+	if *serveMockAddr != "" {
+		if err := serveMock(*serveMockAddr); err != nil {
+			log.Fatalf("Mock server failed: %v", err)
+		}
+		return
+	}
+
+	if *uninstallServiceFlag {
+		if err := uninstallService(); err != nil {
+			log.Fatalf("Error uninstalling service %s: %v", serviceName, err)
+		}
+		outputf("Uninstalled service %s\n", serviceName)
+		return
+	}
+	if *configure {
+		if err := configureConfig(configFileName); err != nil {
+			log.Fatalf("Error configuring %s: %v", configFileName, err)
+		}
+		outputf("Saved %s\n", configFileName)
+		return
+	}
+	if *migrate {
+		changes, err := writeMigratedConfig(configFileName)
+		if err != nil {
+			log.Fatalf("Error migrating config file: %v", err)
+		}
+		outputf("Config file %s is at config_version %d, %d change(s) made\n", configFileName, currentConfigVersion, len(changes))
+		for _, change := range changes {
+			outputf("  - %s\n", change)
+		}
+		return
+	}
+
 	loadConfig()
 	validateConfig()
+	// Both exit before the proxy state, CSV output and log files are opened
+	if *validateOnly {
+		outputf("Config file %s is valid\n", configFileName)
+		return
+	}
+	if *report {
+		if config.DBPath == "" {
+			log.Fatalf("-report needs db_path to be set in %s", configFileName)
+		}
+		db, err := openSubmissionDB(config.DBPath)
+		if err != nil {
+			log.Fatalf("Error opening submission database: %v", err)
+		}
+		defer db.Close()
+		if err := db.Report(os.Stdout); err != nil {
+			log.Fatalf("Error printing report: %v", err)
+		}
+		return
+	}
+
+	mode, ok := modeNames[*modeFlag]
+	if *modeFlag != "" && !ok {
+		log.Fatalf("Unknown -mode %q (expected interactive, automatic, api or schedule)", *modeFlag)
+	}
+	var delay *delayRange
+	if *delayFlag != "" {
+		d, err := parseDelayRange(*delayFlag)
+		if err != nil {
+			log.Fatalf("Invalid -delay: %v", err)
+		}
+		delay = &d
+	}
+	if *replayFlag != "" && mode == 0 {
+		mode = modeAutomatic
+	}
+	if *installServiceFlag || *runServiceFlag {
+		// The service only runs automatic mode, nothing can answer a prompt
+		if mode != 0 && mode != modeAutomatic {
+			log.Fatalf("-install-service and -run-service only support -mode=automatic")
+		}
+		if *replayFlag != "" || *emailsFlag == "-" {
+			log.Fatalf("-install-service and -run-service cannot be combined with -replay or -emails -")
+		}
+		mode = modeAutomatic
+	}
+	if mode == modeAutomatic {
+		// Nothing may prompt when started without a terminal
+		if delay == nil && config.DelayMax == 0 {
+			log.Fatalf("-mode=automatic needs -delay or delay_min/delay_max in %s", configFileName)
+		}
+		if !generatesAliases() && *emailsFlag == "" && *replayFlag == "" {
+			log.Fatalf("-mode=automatic needs use_cloudflare_email, email_provider mailtm or -emails, it cannot prompt for an email address")
+		}
+	}
+	if *emailsFlag != "" {
+		if generatesAliases() {
+			log.Fatalf("-emails cannot be combined with use_cloudflare_email or email_provider mailtm")
+		}
+		// Prompts read stdin too, so a piped list leaves nothing to answer them
+		if *emailsFlag == "-" && mode != modeAutomatic {
+			log.Fatalf("-emails - reads stdin, so it needs -mode=automatic; pass a file for interactive mode")
+		}
+		list, err := openEmailList(*emailsFlag)
+		if err != nil {
+			log.Fatalf("Error loading email list: %v", err)
+		}
+		manualEmails = list
+		infof("Loaded %d email addresses\n", list.Len())
+	}
+	if *replayFlag != "" {
+		if *emailsFlag != "" {
+			log.Fatalf("-replay cannot be combined with -emails")
+		}
+		list, err := loadReplayEmails(*replayFlag)
+		if err != nil {
+			log.Fatalf("Error loading results to replay: %v", err)
+		}
+		// The aliases already exist, so entries reuse them rather than
+		// creating new ones, and the outcomes go to the same file
+		manualEmails = list
+		config.CSVOutput = *replayFlag
+		infof("Replaying %d failed entries from %s\n", list.Len(), *replayFlag)
+	}
+	if *installServiceFlag {
+		args, err := serviceArguments(configFileName, *delayFlag, *emailsFlag)
+		if err != nil {
+			log.Fatalf("Error preparing service arguments: %v", err)
+		}
+		if err := installService(args); err != nil {
+			log.Fatalf("Error installing service %s: %v", serviceName, err)
+		}
+		outputf("Installed service %s, started as: %s\n", serviceName, strings.Join(args, " "))
+		return
+	}
+	if *tui {
+		// Redrawing into a pipe or a file would only leave escape codes
+		showDashboard = isTerminal(os.Stdout)
+		if !showDashboard {
+			infof("stdout is not a terminal, -tui falls back to progress lines\n")
+		}
+	}
+	if config.RandSeed != 0 {
+		infof("Using random seed %d\n", config.RandSeed)
+	}
+	random = newRandomSource(config.RandSeed)
+	sharedHTTPClient = newHTTPClient()
+	captchaSolver = newCaptchaSolver()
+	emailProvider = newEmailProvider()
+	captchaSlots = make(chan struct{}, config.MaxConcurrentCaptchas)
+	captchaBreaker = newCircuitBreaker(config.BreakerThreshold, time.Duration(config.BreakerCooldown*float64(time.Second)), time.Now)
+	submissionLimiter = newSubmissionLimiter(config.SubmissionsPerMinute)
+
+	if config.UseProxy && config.ProxyList != "" {
+		pool, err := loadProxyPool(config.ProxyList, config.ProxyDeadSkip)
+		if err != nil {
+			log.Fatalf("Error loading proxy list: %v", err)
+		}
+		proxies = pool
+		infof("Loaded %d proxies from %s\n", pool.Len(), config.ProxyList)
+		if config.ProxyStateFile != "" {
+			if err := pool.loadState(config.ProxyStateFile, time.Duration(config.ProxyDeadTTL*float64(time.Second))); err != nil {
+				errorf("Error loading proxy state, starting with every proxy alive: %v\n", err)
+			} else if dead := pool.DeadCount(); dead > 0 {
+				infof("%d proxies are still marked dead from %s\n", dead, config.ProxyStateFile)
+			}
+		}
+	}
 
-	fmt.Println("Welcome to the Call of Duty Monster Energy Promo Bot!")
+	// Deferred before the output files are opened so it runs after they
+	// are closed
+	defer flushUploads()
+	defer closeSubmissionLog()
+
+	if config.CSVOutput != "" {
+		w, err := openCSVWriter(config.CSVOutput)
+		if err != nil {
+			log.Fatalf("Error opening CSV output: %v", err)
+		}
+		defer w.Close()
+		resultsCSV = w
+	}
+
+	if config.DBPath != "" {
+		db, err := openSubmissionDB(config.DBPath)
+		if err != nil {
+			log.Fatalf("Error opening submission database: %v", err)
+		}
+		defer db.Close()
+		resultsDB = db
+	}
+
+	if *pruneAliases > 0 || *pruneRun != "" {
+		deleted, err := pruneExpiredAliases(context.Background(), *pruneAliases, *pruneRun)
+		switch {
+		case *pruneRun != "" && *pruneAliases > 0:
+			outputf("Deleted %d forwarding rules of run %s older than %s\n", deleted, *pruneRun, *pruneAliases)
+		case *pruneRun != "":
+			outputf("Deleted %d forwarding rules of run %s\n", deleted, *pruneRun)
+		default:
+			outputf("Deleted %d forwarding rules older than %s\n", deleted, *pruneAliases)
+		}
+		if err != nil {
+			log.Fatalf("Error pruning aliases: %v", err)
+		}
+		return
+	}
+
+	if *listAliases || *cleanupAliases {
+		rules, err := listOwnAliasRules(context.Background(), *olderThan, *runPrefix)
+		if err != nil {
+			log.Fatalf("Error listing aliases: %v", err)
+		}
+		if *listAliases || !*yes {
+			if err := printAliasRules(os.Stdout, rules); err != nil {
+				log.Fatalf("Error printing aliases: %v", err)
+			}
+		}
+		if !*cleanupAliases {
+			outputf("%d forwarding rules\n", len(rules))
+			return
+		}
+		if len(rules) == 0 {
+			outputf("No forwarding rules to delete\n")
+			return
+		}
+		if !*yes && !confirmAction(fmt.Sprintf("Delete these %d forwarding rules?", len(rules))) {
+			outputf("Nothing deleted\n")
+			return
+		}
+		deleted, err := deleteAliasRules(context.Background(), rules)
+		outputf("Deleted %d forwarding rules\n", deleted)
+		if err != nil {
+			log.Fatalf("Error deleting aliases: %v", err)
+		}
+		return
+	}
+
+	if *testCaptchaOnly {
+		if config.DryRun && config.DryRunFakeCaptcha {
+			log.Fatalf("-test-captcha needs a real solve, turn off dry_run_fake_captcha")
+		}
+		if err := testCaptcha(context.Background(), os.Stdout); err != nil {
+			log.Fatalf("Captcha test failed: %v", err)
+		}
+		return
+	}
+
+	if config.UseProxy {
+		if err := checkProxies(context.Background()); err != nil {
+			log.Fatalf("Proxy check failed: %v", err)
+		}
+	}
+
+	if *checkSiteKeyOnly {
+		if err := checkSiteKey(context.Background(), false); err != nil {
+			log.Fatalf("Site key check failed: %v", err)
+		}
+		outputf("Site keys match the promo pages\n")
+		return
+	}
+
+	if config.CheckSiteKey {
+		if err := checkSiteKey(context.Background(), *updateSiteKey); err != nil {
+			errorf("WARNING: %v\nEvery captcha solve will likely be wasted until the site key is updated.\n", err)
+		}
+	}
+
+	if config.MetricsAddr != "" {
+		server, err := startMetricsServer(config.MetricsAddr)
+		if err != nil {
+			log.Fatalf("Error starting metrics server: %v", err)
+		}
+		defer shutdownMetricsServer(server)
+		infof("Serving metrics on http://%s/metrics\n", server.Addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Under the service manager, stopping the service cancels ctx instead
+	if !*runServiceFlag {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			infof("\nShutting down after the current submission, press Ctrl-C again to force quit.\n")
+			// Restore the default handler so a second Ctrl-C exits immediately
+			signal.Stop(signals)
+			cancel()
+		}()
+	}
+
+	if config.S3Endpoint != "" {
+		uploader, err := newS3Uploader()
+		if err != nil {
+			errorf("Error setting up the S3 upload, output files will not be uploaded: %v\n", err)
+		} else {
+			resultsUploader = uploader
+			if config.S3UploadInterval > 0 {
+				go uploader.uploadPeriodically(ctx)
+			}
+		}
+	}
+
+	infof("Welcome to the Call of Duty Monster Energy Promo Bot! (Promogen %s)\n", versionString())
+	infof("Run ID: %s\n", config.RunID)
 
 	balance, err := checkCaptchaBalance()
 	if err != nil {
-		fmt.Printf("Error checking CAPTCHA balance: %v\n", err)
+		errorf("Error checking CAPTCHA balance: %v\n", err)
 	} else {
-		fmt.Printf("Current CAPTCHA balance: $%.2f\n", balance)
+		infof("Current CAPTCHA balance: $%.2f\n", balance)
+		notifyTelegram(fmt.Sprintf("Promogen %s started, captcha balance: $%.2f", version, balance))
+		checkLowBalance(balance)
 	}
 
-	mode := getUserInput("Select mode (1 for Interactive, 2 for Automatic): ")
+	if mode == 0 {
+		prompt := "Select mode (1 for Interactive, 2 for Automatic"
+		if config.APIAddr != "" {
+			prompt += ", 3 for API server"
+		}
+		if config.Schedule != "" {
+			prompt += ", 4 for Scheduled"
+		}
+		mode = modeNames[getUserInput(prompt+"): ")]
+	}
 
 	switch mode {
-	case "1":
-		interactiveMode()
-	case "2":
-		automaticMode()
+	case modeInteractive:
+		interactiveMode(ctx)
+	case modeAutomatic:
+		if !*runServiceFlag {
+			automaticMode(ctx, delay)
+		} else if err := runService(func() { automaticMode(ctx, delay) }, cancel); err != nil {
+			errorf("%v\n", err)
+		}
+	case modeAPI:
+		if config.APIAddr == "" {
+			errorf("API server mode needs api_addr to be set. Exiting.\n")
+			return
+		}
+		apiMode(ctx)
+	case modeSchedule:
+		if config.Schedule == "" {
+			errorf("Scheduled mode needs schedule to be set. Exiting.\n")
+			return
+		}
+		scheduleMode(ctx)
 	default:
-		fmt.Println("Invalid mode selected. Exiting.")
+		errorf("Invalid mode selected. Exiting.\n")
 	}
 }
 
 func loadConfig() {
-	file, err := os.Open(configFileName)
+	if err := readConfigFile(configFileName, &config); err != nil {
+		log.Fatalf("Error reading config file %s: %v", configFileName, err)
+	}
+
+	if changes := migrateConfig(&config, config.ConfigVersion); len(changes) > 0 {
+		infof("Upgraded %s to config_version %d in memory, run with -migrate to save it:\n  - %s\n", configFileName, currentConfigVersion, strings.Join(changes, "\n  - "))
+	}
+
+	if err := applyEnvOverrides(&config); err != nil {
+		log.Fatalf("Error applying environment overrides: %v", err)
+	}
+}
+
+// readConfigFile decodes the config file at name into c.
+func readConfigFile(name string, c *Config) error {
+	file, err := os.Open(name)
 	if err != nil {
-		log.Fatalf("Error opening config file: %v", err)
+		return err
 	}
 	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
-	if err != nil {
-		log.Fatalf("Error decoding config file: %v", err)
+	if err := json.NewDecoder(file).Decode(c); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
 	}
+	return nil
 }
 
+// applyEnvOverrides replaces each Config field that has an env struct tag
+// with the value of that environment variable, when it is set.
+func applyEnvOverrides(c *Config) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			field.SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			field.SetFloat(f)
+		default:
+			return fmt.Errorf("%s: unsupported field type %s", name, field.Kind())
+		}
+	}
+	return nil
+}
+
+// validateConfig fills in defaults and exits with every problem found in the
+// config file.
 func validateConfig() {
-	if config.CloudflareAPIToken == "" {
-		log.Fatal("Cloudflare API token is missing in the config file")
+	if errs := checkConfig(); len(errs) > 0 {
+		log.Fatalf("Invalid config file %s:\n  - %s", configFileName, strings.Join(errs, "\n  - "))
+	}
+}
+
+// checkConfig fills in defaults for unset fields and returns a description of
+// every invalid value.
+func checkConfig() []string {
+	var errs []string
+
+	if config.EZCaptchaAPIKey == "" && config.TwoCaptchaAPIKey == "" && config.AntiCaptchaAPIKey == "" && config.CapMonsterAPIKey == "" {
+		errs = append(errs, "EZ Captcha, 2captcha, AntiCaptcha and CapMonster API keys are all missing")
+	}
+	if enabled := countTrue(config.UseTwoCaptcha, config.UseAntiCaptcha, config.UseCapMonster); enabled > 1 {
+		errs = append(errs, "Only one of use_2captcha, use_anticaptcha and use_capmonster can be enabled")
+	}
+	if config.UseAntiCaptcha && config.AntiCaptchaAPIKey == "" {
+		errs = append(errs, "AntiCaptcha API key is missing while use_anticaptcha is enabled")
+	}
+	if config.UseCapMonster && config.CapMonsterAPIKey == "" {
+		errs = append(errs, "CapMonster API key is missing while use_capmonster is enabled")
+	}
+	errs = append(errs, checkCaptchaProviders()...)
+	if config.CaptchaType == "" {
+		config.CaptchaType = captchaTypeRecaptchaV2
+	}
+	// Targets that all carry their own site key need no global one
+	needSiteKey := targetsNeedSiteKey()
+	switch config.CaptchaType {
+	case captchaTypeRecaptchaV2:
+		if needSiteKey && config.RecaptchaSiteKey == "" {
+			errs = append(errs, "ReCaptcha site key is missing")
+		}
+		if config.RecaptchaVersion == "" {
+			config.RecaptchaVersion = recaptchaVersionV2
+		}
+		switch config.RecaptchaVersion {
+		case recaptchaVersionV2:
+		case recaptchaVersionV3:
+			if config.RecaptchaEnterprise {
+				errs = append(errs, "recaptcha_enterprise is only supported with recaptcha_version v2")
+			}
+			if config.RecaptchaAction == "" {
+				errs = append(errs, "ReCaptcha action is missing while recaptcha_version is v3")
+			}
+			if config.RecaptchaMinScore == 0 {
+				config.RecaptchaMinScore = 0.7 // Set a default value if not specified
+			}
+			if config.RecaptchaMinScore < 0 || config.RecaptchaMinScore > 1 {
+				errs = append(errs, fmt.Sprintf("ReCaptcha min score %v must be between 0 and 1", config.RecaptchaMinScore))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("Unsupported recaptcha version %q (expected v2 or v3)", config.RecaptchaVersion))
+		}
+	case captchaTypeTurnstile:
+		if needSiteKey && config.TurnstileSiteKey == "" {
+			errs = append(errs, "Turnstile site key is missing")
+		}
+		if len(config.CaptchaProviders) == 0 && config.EZCaptchaAPIKey == "" && !config.UseAntiCaptcha && !config.UseCapMonster {
+			errs = append(errs, "Turnstile solving requires an EZ Captcha, AntiCaptcha or CapMonster API key")
+		}
+	case captchaTypeHCaptcha:
+		if needSiteKey && config.HCaptchaSiteKey == "" {
+			errs = append(errs, "hCaptcha site key is missing")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("Unsupported captcha type %q (expected recaptcha_v2, turnstile or hcaptcha)", config.CaptchaType))
+	}
+	if config.RecaptchaEnterprise && config.CaptchaType != captchaTypeRecaptchaV2 {
+		errs = append(errs, "recaptcha_enterprise needs captcha_type recaptcha_v2")
+	}
+	if len(config.EnterprisePayload) > 0 && !config.RecaptchaEnterprise {
+		errs = append(errs, "enterprise_payload is only sent with recaptcha_enterprise")
+	}
+	errs = append(errs, checkEmailProvider()...)
+	errs = append(errs, checkTargets()...)
+	errs = append(errs, checkBaseURLs()...)
+	errs = append(errs, checkCSRF()...)
+	if config.SubmitContentType == "" {
+		config.SubmitContentType = submitContentTypeForm
+	}
+	if config.SubmitContentType != submitContentTypeForm && config.SubmitContentType != submitContentTypeJSON {
+		errs = append(errs, fmt.Sprintf("Unsupported submit content type %q (expected form or json)", config.SubmitContentType))
+	}
+	if config.CaptchaRejectCodes == nil {
+		config.CaptchaRejectCodes = defaultCaptchaRejectCodes // Set a default value if not specified
+	}
+	errs = append(errs, checkPromoFields()...)
+	errs = append(errs, checkRunID()...)
+	if config.ProxyScheme == "" {
+		config.ProxyScheme = "http"
+	}
+	switch config.ProxyScheme {
+	case "http", "https", "socks5":
+	default:
+		errs = append(errs, fmt.Sprintf("Unsupported proxy scheme %q (expected http, https or socks5)", config.ProxyScheme))
+	}
+	if config.ProxyAuthHeader && config.ProxyScheme == "socks5" {
+		errs = append(errs, "proxy_auth_header only applies to http and https proxies, SOCKS5 has its own authentication")
+	}
+	if config.ProxyCheckURL == "" {
+		config.ProxyCheckURL = "https://api.ipify.org" // Set a default value if not specified
+	}
+	if err := checkHTTPURL(config.ProxyCheckURL); err != nil {
+		errs = append(errs, fmt.Sprintf("Proxy check URL %v", err))
+	}
+	if config.AcceptLanguage == "" {
+		config.AcceptLanguage = "en-US,en;q=0.9" // Set a default value if not specified
+	}
+	if config.Referer != "" {
+		if err := checkHTTPURL(config.Referer); err != nil {
+			errs = append(errs, fmt.Sprintf("Referer %v", err))
+		}
+	}
+	if config.UseProxy && config.ProxyList == "" {
+		if config.ProxyDNS == "" {
+			errs = append(errs, "Proxy DNS is missing while use_proxy is enabled")
+		}
+		if port, err := strconv.Atoi(config.ProxyPort); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Sprintf("Proxy port %q is not a valid port number", config.ProxyPort))
+		}
+	}
+	errs = append(errs, checkLogLevel()...)
+	errs = append(errs, checkSubmissionLog()...)
+	if config.LogFormat == "" {
+		config.LogFormat = logFormatText
+	}
+	if config.LogFormat != logFormatText && config.LogFormat != logFormatJSON {
+		errs = append(errs, fmt.Sprintf("Unsupported log format %q (expected text or json)", config.LogFormat))
+	}
+	if config.ProxyDeadSkip == 0 {
+		config.ProxyDeadSkip = 10 // Set a default value if not specified
+	}
+	if config.ProxyDeadTTL == 0 {
+		config.ProxyDeadTTL = 1800 // Set a default value if not specified
+	}
+	if config.ProxyDeadTTL < 0 {
+		errs = append(errs, "Proxy dead TTL must not be negative")
+	}
+	if config.MaxCaptchaRetries == 0 {
+		config.MaxCaptchaRetries = 5 // Set a default value if not specified
+	}
+	if config.MaxCaptchaResolves == 0 {
+		config.MaxCaptchaResolves = 4 // Set a default value if not specified
+	}
+	if config.MaxCaptchaResolves < 0 {
+		errs = append(errs, "Max captcha resolves must not be negative")
+	}
+	if config.CaptchaTimeout == 0 {
+		config.CaptchaTimeout = 120 // Set a default value if not specified
+	}
+	if config.CaptchaTimeout < 0 {
+		errs = append(errs, "Captcha timeout must be greater than 0")
+	}
+	if config.CaptchaInitialDelay == 0 {
+		config.CaptchaInitialDelay = captchaPollMinDelay.Seconds() // Set a default value if not specified
+	}
+	if config.CaptchaPollInterval == 0 {
+		config.CaptchaPollInterval = captchaPollMaxDelay.Seconds() // Set a default value if not specified
+	}
+	if config.CaptchaInitialDelay < 0 || config.CaptchaPollInterval < 0 {
+		errs = append(errs, "Captcha initial delay and poll interval must be greater than 0")
+	}
+	errs = append(errs, checkCaptchaBreaker()...)
+	if config.MaxSubmitRetries == 0 {
+		config.MaxSubmitRetries = 3 // Set a default value if not specified
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1 // Set a default value if not specified
+	}
+	if config.MaxConcurrentCaptchas == 0 {
+		config.MaxConcurrentCaptchas = 10 // Set a default value if not specified
+	}
+	if config.MaxConcurrentCaptchas < 0 {
+		errs = append(errs, "Max concurrent captchas must be greater than 0")
+	}
+	if config.HTTPTimeout == 0 {
+		config.HTTPTimeout = 30 // Set a default value if not specified
+	}
+	if config.HTTPTimeout < 0 {
+		errs = append(errs, "HTTP timeout must be greater than 0")
+	}
+	if err := checkHTTPURL(config.DiscordWebhookURL); config.DiscordWebhookURL != "" && err != nil {
+		errs = append(errs, fmt.Sprintf("Discord webhook URL %v", err))
+	}
+	if err := checkHTTPURL(config.CodeWebhookURL); config.CodeWebhookURL != "" && err != nil {
+		errs = append(errs, fmt.Sprintf("Code webhook URL %v", err))
+	}
+	if (config.TelegramBotToken == "") != (config.TelegramChatID == "") {
+		errs = append(errs, "Telegram bot token and chat ID must be set together")
+	}
+	if config.TelegramInterval == 0 {
+		config.TelegramInterval = 600 // Set a default value if not specified
+	}
+	if config.TelegramInterval < 0 {
+		errs = append(errs, "Telegram progress interval must be greater than 0")
+	}
+	if config.DelayMax == 0 {
+		config.DelayMax = config.DelayMin // A lone delay_min is a fixed delay
 	}
-	if config.EZCaptchaAPIKey == "" && config.TwoCaptchaAPIKey == "" {
-		log.Fatal("Both EZ Captcha and 2captcha API keys are missing in the config file")
+	if config.DelayMin < 0 || config.DelayMax < 0 {
+		errs = append(errs, "Delay min and max must not be negative")
+	} else if config.DelayMax < config.DelayMin {
+		errs = append(errs, "Delay max must not be less than delay min")
 	}
-	if config.RecaptchaSiteKey == "" {
-		log.Fatal("ReCaptcha site key is missing in the config file")
+	if config.MaxSubmissions < 0 {
+		errs = append(errs, "Max submissions must not be negative")
 	}
-	if config.EmailDomain == "" {
-		log.Fatal("Email domain is missing in the config file")
+	if config.MaxRuntime < 0 {
+		errs = append(errs, "Max runtime must not be negative")
 	}
-	if config.CloudflareZoneID == "" {
-		log.Fatal("Cloudflare Zone ID is missing in the config file")
+	if config.SubmissionsPerMinute < 0 {
+		errs = append(errs, "Submissions per minute must not be negative")
 	}
-	if config.ForwardToEmail == "" {
-		log.Fatal("Forward to email is missing in the config file")
+	if config.MinBalance < 0 {
+		errs = append(errs, "Minimum balance must not be negative")
+	}
+	if config.BalanceCheckEvery <= 0 {
+		config.BalanceCheckEvery = 25 // Set a default value if not specified
+	}
+	if config.EntriesPerClearance == 0 {
+		config.EntriesPerClearance = 5 // Set a default value if not specified
+	}
+	if config.EntriesPerClearance < 0 {
+		errs = append(errs, "Entries per clearance must not be negative")
+	}
+	if config.BalanceCacheTTL == 0 {
+		config.BalanceCacheTTL = 60 // Set a default value if not specified
+	}
+	if config.BalanceCacheTTL < 0 {
+		errs = append(errs, "Balance cache TTL must not be negative")
+	}
+	if config.CooldownThreshold == 0 {
+		config.CooldownThreshold = 5 // Set a default value if not specified
+	}
+	if config.CooldownInitial == 0 {
+		config.CooldownInitial = 30 // Set a default value if not specified
+	}
+	if config.CooldownMax == 0 {
+		config.CooldownMax = 600 // Set a default value if not specified
+	}
+	if config.CooldownThreshold < 0 || config.CooldownInitial < 0 || config.CooldownMax < 0 {
+		errs = append(errs, "Cooldown threshold, initial and max must be greater than 0")
+	} else if config.CooldownMax < config.CooldownInitial {
+		errs = append(errs, "Cooldown max must not be less than cooldown initial")
+	}
+	errs = append(errs, checkSuccessRate()...)
+	if config.APIAddr != "" {
+		if config.APIToken == "" {
+			errs = append(errs, "API token is missing while api_addr is set")
+		}
+		if !generatesAliases() {
+			errs = append(errs, "API server mode requires use_cloudflare_email or email_provider mailtm, it cannot prompt for an email address")
+		}
+	}
+	errs = append(errs, checkAliasPattern()...)
+	errs = append(errs, checkSchedule()...)
+	errs = append(errs, checkS3Upload()...)
+	if config.AliasPoolSize < 0 {
+		errs = append(errs, "Alias pool size must not be negative")
+	}
+	if config.IMAPHost != "" && (config.IMAPUsername == "" || config.IMAPPassword == "") {
+		errs = append(errs, "IMAP username or password is missing")
+	}
+	if config.IMAPWaitTimeout == 0 {
+		config.IMAPWaitTimeout = 300 // Set a default value if not specified
+	}
+	if config.CodeRegex == "" {
+		config.CodeRegex = defaultCodeRegex
+	}
+	if config.CodesFile == "" {
+		config.CodesFile = "codes.txt" // Set a default value if not specified
+	}
+	if re, err := regexp.Compile(config.CodeRegex); err != nil {
+		errs = append(errs, fmt.Sprintf("Invalid code regex: %v", err))
+	} else {
+		promoCodeRegex = re
+	}
+
+	return errs
+}
+
+// countTrue returns how many of values are true.
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// emailAddressRegex is a pragmatic check for user@domain.tld addresses.
+var emailAddressRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// checkHTTPURL returns an error unless rawURL is an absolute http or https URL.
+func checkHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL: %v", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an http or https URL with a host", rawURL)
+	}
+	return nil
+}
+
+// hiddenFlags are development flags left out of the usage message.
+var hiddenFlags = map[string]bool{"serve-mock": true}
+
+// printUsage prints the usage message of every flag except hiddenFlags.
+func printUsage() {
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fmt.Fprintf(visible.Output(), "Usage of %s:\n", os.Args[0])
+	visible.PrintDefaults()
+}
+
+// checkBaseURLs fills in the default provider API base URLs and returns a
+// description of every invalid override.
+func checkBaseURLs() []string {
+	var errs []string
+	for _, baseURL := range []struct {
+		name  string
+		value *string
+		def   string
+	}{
+		{"Cloudflare API base URL", &config.CloudflareAPIBaseURL, defaultCloudflareAPIBaseURL},
+		{"EZ Captcha base URL", &config.EZCaptchaBaseURL, defaultEZCaptchaBaseURL},
+		{"2captcha base URL", &config.TwoCaptchaBaseURL, defaultTwoCaptchaBaseURL},
+		{"AntiCaptcha base URL", &config.AntiCaptchaBaseURL, defaultAntiCaptchaBaseURL},
+		{"CapMonster base URL", &config.CapMonsterBaseURL, defaultCapMonsterBaseURL},
+		{"Telegram API base URL", &config.TelegramAPIBaseURL, defaultTelegramAPIBaseURL},
+		{"mail.tm base URL", &config.MailTMBaseURL, defaultMailTMBaseURL},
+	} {
+		if *baseURL.value == "" {
+			*baseURL.value = baseURL.def // Set a default value if not specified
+		}
+		// Paths are appended to the base URL with a leading slash
+		*baseURL.value = strings.TrimRight(*baseURL.value, "/")
+		if err := checkHTTPURL(*baseURL.value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %v", baseURL.name, err))
+		}
+	}
+	return errs
+}
+
+func interactiveMode(ctx context.Context) {
+	for {
+		infof("\n--- Starting new entry submission ---\n")
+		if !confirmAction("Continue with submission?") {
+			infof("Exiting interactive mode.\n")
+			return
+		}
+
+		_, err := submitEntry(context.WithoutCancel(ctx), nextTarget())
+		if errors.Is(err, errPromoEnded) {
+			infof("The promotion has ended. Exiting interactive mode.\n")
+			return
+		}
+		if errors.Is(err, errEmailsExhausted) {
+			infof("Every address in the email list has been used. Exiting interactive mode.\n")
+			return
+		}
+		if err != nil {
+			errorf("Error submitting entry: %v\n", err)
+		} else {
+			infof("Entry submitted successfully\n")
+		}
+
+		if ctx.Err() != nil || !confirmAction("Submit another entry?") {
+			infof("Exiting interactive mode.\n")
+			return
+		}
+	}
+}
+
+// automaticMode submits entries until ctx is cancelled or a limit is hit,
+// waiting a random time within flagDelay between them. A nil flagDelay falls
+// back to delay_min/delay_max and then to asking the user.
+func automaticMode(ctx context.Context, flagDelay *delayRange) {
+	delay := delayRange{
+		min: time.Duration(config.DelayMin * float64(time.Second)),
+		max: time.Duration(config.DelayMax * float64(time.Second)),
+	}
+	if flagDelay != nil {
+		delay = *flagDelay
+	} else if config.DelayMax == 0 {
+		delay = getUserInputDelay("Enter delay between submissions in seconds (e.g. 10, or 5-15 for a random delay): ")
+	}
+	infof("Running in automatic mode with a %s delay and %d worker(s).\n", delay, config.Concurrency)
+
+	var stats submissionStats
+	runStats := newRunStats(time.Now())
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+
+	// Submissions already in flight run to completion on shutdown so their
+	// results are logged and their aliases cleaned up.
+	submitCtx := context.WithoutCancel(ctx)
+
+	// stop ends the run early, e.g. when the captcha balance runs out
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	if config.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.MaxRuntime*float64(time.Second)))
+		defer cancel()
+	}
+
+	// Replayed entries reuse their addresses and never take from the pool
+	if generatesAliases() && manualEmails == nil && config.AliasPoolSize > 0 {
+		infof("Pre-creating %d email aliases...\n", config.AliasPoolSize)
+		aliases = newAliasPool(ctx, config.AliasPoolSize)
+		if err := aliases.refill(); err != nil {
+			errorf("Error pre-creating email aliases: %v\n", err)
+		}
+		defer closeAliasPool(submitCtx)
+	}
+
+	if telegramEnabled() {
+		go reportProgress(ctx, &stats)
+	}
+
+	var dash *dashboard
+	if showDashboard {
+		dash = newDashboard(os.Stdout, runStats)
+		dash.Start(ctx)
+	}
+
+	cooldown := newFailureCooldown(config.CooldownThreshold,
+		time.Duration(config.CooldownInitial*float64(time.Second)),
+		time.Duration(config.CooldownMax*float64(time.Second)),
+		time.Now)
+	var successRate *successRateMonitor
+	if config.MinSuccessRate > 0 {
+		successRate = newSuccessRateMonitor(config.SuccessRateWindow, config.MinSuccessRate)
+	}
+
+	for w := 0; w < config.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				// A job handed out just before stop is dropped
+				if ctx.Err() != nil {
+					return
+				}
+				if err := cooldown.Wait(ctx); err != nil {
+					return
+				}
+				if err := waitSubmissionLimit(ctx); err != nil {
+					return
+				}
+				infof("\n--- Starting new entry submission ---\n")
+				result, err := submitEntry(submitCtx, nextTarget())
+				if errors.Is(err, errEmailsExhausted) {
+					infof("Stopping automatic mode: every address in the email list has been used\n")
+					stop()
+					return
+				}
+				runStats.record(result, err)
+				if err != nil {
+					errorf("Error submitting entry: %v\n", err)
+				} else {
+					infof("Entry submitted successfully\n")
+				}
+				if d := cooldown.record(err == nil); d > 0 {
+					errorf("WARNING: %d submissions in a row have failed, pausing for %s. Check that the captcha site key is still valid and that Cloudflare is not blocking requests.\n", cooldown.Streak(), d)
+				}
+				if successRate != nil {
+					if rate, dropped, recovered := successRate.record(err == nil); dropped || recovered {
+						alertSuccessRate(rate, dropped)
+						if dropped && config.SuccessRatePause > 0 {
+							cooldown.Pause(time.Duration(config.SuccessRatePause * float64(time.Second)))
+						}
+					}
+				}
+
+				successCount, totalCount := stats.record(err == nil)
+				infof("Success rate: %d/%d (%.2f%%)\n", successCount, totalCount, float64(successCount)/float64(totalCount)*100)
+				if errors.Is(err, errPromoEnded) {
+					infof("Stopping automatic mode: the promotion has ended\n")
+					notifyTelegram("Stopping automatic mode: the promotion has ended")
+					stop()
+				}
+				if config.MinBalance > 0 && totalCount%config.BalanceCheckEvery == 0 {
+					if err := checkMinBalance(); err != nil {
+						errorf("Stopping automatic mode: %v\n", err)
+						stop()
+					}
+				}
+				if ctx.Err() != nil || (config.MaxSubmissions > 0 && totalCount >= config.MaxSubmissions) {
+					return
+				}
+				wait := delay.next()
+				infof("Waiting %.1f seconds before next submission...\n", wait.Seconds())
+				if err := sleepContext(ctx, wait); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; ctx.Err() == nil; i++ {
+		if config.MaxSubmissions > 0 && i >= config.MaxSubmissions {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if dash != nil {
+		dash.Stop()
+	}
+
+	if _, totalCount := stats.summary(); config.MaxSubmissions > 0 && totalCount >= config.MaxSubmissions {
+		infof("\nReached the limit of %d submissions.", config.MaxSubmissions)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		infof("\nReached the max runtime of %s.", time.Duration(config.MaxRuntime*float64(time.Second)))
+	}
+	infof("\nExiting automatic mode.\n")
+	printRunSummary(&stats)
+
+	runStats.finish(time.Now())
+	if name, err := writeRunSummary(runStats); err != nil {
+		errorf("Error saving run summary: %v\n", err)
+	} else {
+		outputf("Run summary saved to %s\n", name)
+	}
+}
+
+// checkMinBalance returns an error when the captcha balance has dropped below
+// MinBalance. A failed balance lookup is only reported so that one bad
+// response does not end the run.
+func checkMinBalance() error {
+	balance, err := forceBalanceRefresh()
+	if err != nil {
+		errorf("Error checking CAPTCHA balance: %v\n", err)
+		return nil
 	}
-	if config.MonsterPromoURL == "" || config.MonsterSubmitURL == "" {
-		log.Fatal("Monster promo URL or submit URL is missing in the config file")
+	checkLowBalance(balance)
+	if balance < config.MinBalance {
+		return fmt.Errorf("captcha balance $%.2f is below the minimum of $%.2f", balance, config.MinBalance)
 	}
-	if config.MaxCaptchaRetries == 0 {
-		config.MaxCaptchaRetries = 5 // Set a default value if not specified
+	return nil
+}
+
+// printRunSummary prints the final success rate and captcha spend.
+func printRunSummary(stats *submissionStats) {
+	successCount, totalCount := stats.summary()
+	if totalCount > 0 {
+		outputf("Final success rate: %d/%d (%.2f%%)\n", successCount, totalCount, float64(successCount)/float64(totalCount)*100)
+	} else {
+		outputf("No entries were submitted.\n")
 	}
-	if config.CaptchaTimeout == 0 {
-		config.CaptchaTimeout = 120 // Set a default value if not specified
+	printCaptchaSummary()
+}
+
+// submissionStats tallies submission outcomes across automatic mode workers.
+type submissionStats struct {
+	mu           sync.Mutex
+	successCount int
+	totalCount   int
+}
+
+// record adds one outcome and returns the updated totals.
+func (s *submissionStats) record(success bool) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalCount++
+	if success {
+		s.successCount++
 	}
+	return s.successCount, s.totalCount
 }
 
-func interactiveMode() {
-	for {
-		fmt.Println("\n--- Starting new entry submission ---")
-		if !confirmAction("Continue with submission?") {
-			fmt.Println("Exiting interactive mode.")
-			return
+// summary returns the current totals without recording an outcome.
+func (s *submissionStats) summary() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.successCount, s.totalCount
+}
+
+// submitEntry submits one entry to target, from creating the email alias to
+// fetching the promo code.
+func submitEntry(ctx context.Context, target Target) (result SubmissionResult, err error) {
+	// Checked before anything is recorded, running out is not a failed entry
+	var listedEmail string
+	if manualEmails != nil {
+		var ok bool
+		if listedEmail, ok = manualEmails.Next(); !ok {
+			return result, errEmailsExhausted
 		}
+	}
 
-		err := submitEntry()
+	result = SubmissionResult{
+		Timestamp:       time.Now(),
+		RunID:           config.RunID,
+		Target:          target.String(),
+		CaptchaProvider: captchaSolver.Name(),
+	}
+	defer func() {
+		result.Success = err == nil
 		if err != nil {
-			fmt.Printf("Error submitting entry: %v\n", err)
+			result.Error = err.Error()
+		}
+		observeSubmission(err)
+		logSubmissionResult(result)
+		notifySubmissionOutcome(result)
+		if resultsCSV != nil {
+			if err := resultsCSV.Write(result); err != nil {
+				errorf("Error writing CSV result: %v\n", err)
+			}
+		}
+	}()
+
+	var email, ruleID string
+
+	if manualEmails != nil {
+		email = listedEmail
+	} else if generatesAliases() {
+		if aliases != nil {
+			email, ruleID, err = aliases.Take(ctx)
 		} else {
-			fmt.Println("Entry submitted successfully")
+			debugPrint(fmt.Sprintf("Generating temporary email alias with %s...", emailProvider.Name()))
+			email, ruleID, err = emailProvider.CreateAlias(ctx)
+		}
+		if err != nil {
+			return result, fmt.Errorf("error creating email alias: %w", err)
 		}
+		infof("Generated email: %s\n", email)
+	} else {
+		email = getUserInput("Enter email address: ")
+	}
+	result.Email = email
+	result.RuleID = ruleID
 
-		if !confirmAction("Submit another entry?") {
-			fmt.Println("Exiting interactive mode.")
-			return
+	session := &promoSession{target: target, userAgent: randomUserAgent()}
+	releaseProxy := func() {}
+	if config.UseProxy {
+		// The warm-up, the POSTs and the follow-ups all share this exit IP
+		session.proxyAddr, releaseProxy, err = leaseProxyAddr(ctx)
+		if err != nil {
+			return result, fmt.Errorf("error selecting proxy: %w", err)
+		}
+		defer releaseProxy()
+		result.Proxy = proxyHost(session.proxyAddr)
+	}
+	session.jar = newSessionJar(clearanceJarFor(session.proxyAddr))
+
+	if !config.DryRun {
+		debugPrint("Loading promo page...")
+		if err := warmUpPromoSession(ctx, session); err != nil {
+			// Without the token the POST is rejected, so do not pay for a
+			// captcha. Otherwise it may still get through; only report it
+			if config.ScrapeCSRFToken {
+				return result, fmt.Errorf("error loading promo page: %w", err)
+			}
+			errorf("Error loading promo page: %v\n", err)
 		}
 	}
-}
 
-func automaticMode() {
-	delay := getUserInputInt("Enter delay between submissions (in seconds): ")
-	fmt.Printf("Running in automatic mode with %d second delay.\n", delay)
+	var captchaToken string
+	var submitted SubmitResult
+	// A token the promo endpoint rejects is never resubmitted; solve a fresh
+	// task instead, up to MaxCaptchaResolves times
+	for resolves := 0; ; resolves++ {
+		debugPrint("Solving CAPTCHA...")
+		solveStart := time.Now()
+		captchaToken, result.CaptchaProvider, err = solveCaptcha(ctx, target)
+		result.CaptchaSolveSeconds += time.Since(solveStart).Seconds()
+		if err != nil {
+			return result, fmt.Errorf("error solving captcha: %w", err)
+		}
+		debugPrint(fmt.Sprintf("CAPTCHA solved successfully by %s", result.CaptchaProvider))
+
+		debugPrint("Submitting promo entry...")
+		submitted, err = submitPromoEntry(ctx, session, email, captchaToken)
+		result.HTTPStatus = submitted.Status
+		result.SubmitSeconds = submitted.Latency.Seconds()
+		if errors.Is(err, errCaptchaRejected) && resolves < config.MaxCaptchaResolves && ctx.Err() == nil {
+			errorf("Captcha token was rejected, solving a new one (%d/%d)\n", resolves+1, config.MaxCaptchaResolves)
+			continue
+		}
+		break
+	}
+	if errors.Is(err, errPromoEnded) {
+		// Returned as is so the modes can tell it apart and stop
+		promoEnded.Store(true)
+		return result, err
+	}
+	if err != nil {
+		return result, fmt.Errorf("error submitting promo entry: %w", err)
+	}
 
-	successCount := 0
-	totalCount := 0
+	if submitted.Clearance && !config.SingleEntryMode {
+		debugPrint("Cloudflare clearance cookie obtained")
+		submitFollowUps(ctx, session, email, &result)
+	}
+	// Waiting for the code does not need the proxy
+	releaseProxy()
 
-	for {
-		fmt.Println("\n--- Starting new entry submission ---")
-		err := submitEntry()
-		totalCount++
+	if fetchesCodes() && !config.DryRun {
+		debugPrint("Waiting for promo code email...")
+		code, err := waitForCode(ctx, email, ruleID)
 		if err != nil {
-			fmt.Printf("Error submitting entry: %v\n", err)
+			errorf("Error fetching promo code for %s: %v\n", email, err)
 		} else {
-			fmt.Println("Entry submitted successfully")
-			successCount++
+			result.Code = code
+			outputf("\n*** PROMO CODE for %s: %s ***\n\n", email, code)
+			if added, err := saveCode(code); err != nil {
+				errorf("Error saving promo code: %v\n", err)
+			} else if added {
+				debugPrint(fmt.Sprintf("Promo code appended to %s", config.CodesFile))
+			}
+			sendCodeWebhook(ctx, email, code, time.Now())
 		}
-		fmt.Printf("Success rate: %d/%d (%.2f%%)\n", successCount, totalCount, float64(successCount)/float64(totalCount)*100)
-		fmt.Printf("Waiting %d seconds before next submission...\n", delay)
-		time.Sleep(time.Duration(delay) * time.Second)
 	}
-}
 
-func submitEntry() error {
-	var email string
-	var err error
+	if config.CleanupAliases && ruleID != "" {
+		debugPrint("Deleting email alias rule...")
+		if err := emailProvider.Cleanup(ctx, ruleID); err != nil {
+			errorf("Error deleting email alias %s: %v\n", email, err)
+		}
+	}
+
+	return result, nil
+}
 
-	if config.UseCloudflareEmail {
-		debugPrint("Generating temporary email alias...")
-		email, err = createCloudflareEmailAlias()
+// submitFollowUps reuses the clearance of a successful entry for
+// EntriesPerClearance more entries on the same email. Captcha tokens are
+// single-use, so each follow-up solves its own; the follow-ups stop at the
+// first failed solve, refused token or ended promo rather than keep paying
+// for entries that will not count.
+func submitFollowUps(ctx context.Context, session *promoSession, email string, result *SubmissionResult) {
+	for i := 0; i < config.EntriesPerClearance && ctx.Err() == nil; i++ {
+		solveStart := time.Now()
+		token, _, err := solveCaptcha(ctx, session.target)
+		result.CaptchaSolveSeconds += time.Since(solveStart).Seconds()
 		if err != nil {
-			return fmt.Errorf("error creating email alias: %v", err)
+			errorf("Error solving captcha for additional entry %d/%d, skipping the rest: %v\n", i+1, config.EntriesPerClearance, err)
+			return
 		}
-		fmt.Printf("Generated email: %s\n", email)
-	} else {
-		email = getUserInput("Enter email address: ")
-	}
 
-	debugPrint("Solving CAPTCHA...")
-	var captchaToken string
-	if config.UseTwoCaptcha {
-		captchaToken, err = solveCaptchaWith2Captcha()
-	} else {
-		captchaToken, err = solveCaptchaWithEZCaptcha()
+		debugPrint(fmt.Sprintf("Submitting additional entry %d/%d", i+1, config.EntriesPerClearance))
+		_, err = submitPromoEntry(ctx, session, email, token)
+		switch {
+		case err == nil:
+			debugPrint("Additional entry submitted successfully")
+		case errors.Is(err, errPromoEnded):
+			promoEnded.Store(true)
+			return
+		case errors.Is(err, errCaptchaRejected):
+			errorf("Captcha token was rejected for additional entry %d/%d, skipping the rest\n", i+1, config.EntriesPerClearance)
+			return
+		default:
+			debugPrint(fmt.Sprintf("Error submitting additional entry: %v", err))
+		}
 	}
-	if err != nil {
-		return fmt.Errorf("error solving captcha: %v", err)
+}
+
+// solveCaptcha returns a token from a new captcha task for target, or a
+// placeholder in dry-run mode when DryRunFakeCaptcha is set, along with the
+// name of the provider that solved it.
+func solveCaptcha(ctx context.Context, target Target) (string, string, error) {
+	if config.DryRun && config.DryRunFakeCaptcha {
+		return "dry-run-captcha-token", captchaSolver.Name(), nil
 	}
-	debugPrint("CAPTCHA solved successfully")
 
-	debugPrint("Submitting promo entry...")
-	cfClearance, err := submitPromoEntry(email, captchaToken)
+	release, err := acquireCaptchaSlot(ctx)
 	if err != nil {
-		return fmt.Errorf("error submitting promo entry: %v", err)
+		return "", "", err
 	}
+	defer release()
 
-	if cfClearance != "" {
-		debugPrint("Cloudflare clearance cookie obtained")
-		// Use this cookie for subsequent requests
-		// For example, you might want to submit multiple entries:
-		for i := 0; i < 5; i++ {
-			debugPrint(fmt.Sprintf("Submitting additional entry %d/5", i+1))
-			_, err := submitPromoEntryWithCookie(email, captchaToken, cfClearance)
-			if err != nil {
-				debugPrint(fmt.Sprintf("Error submitting additional entry: %v", err))
-			} else {
-				debugPrint("Additional entry submitted successfully")
-			}
+	var trial bool
+	if captchaBreaker != nil {
+		if trial, err = captchaBreaker.allow(); err != nil {
+			return "", "", err
 		}
 	}
 
-	logSubmission(email)
-	return nil
+	solveStart := time.Now()
+	var token string
+	provider := captchaSolver.Name()
+	if failover, ok := captchaSolver.(*failoverSolver); ok {
+		token, provider, err = failover.solve(ctx, target.siteKey(), target.PromoURL)
+	} else {
+		token, err = captchaSolver.Solve(ctx, target.siteKey(), target.PromoURL)
+	}
+	observeCaptchaSolve(time.Since(solveStart), err)
+	if captchaBreaker != nil {
+		if ctx.Err() != nil {
+			// A cancelled solve says nothing about the provider
+			captchaBreaker.abandon(trial)
+		} else {
+			captchaBreaker.record(trial, err == nil)
+		}
+	}
+	return token, provider, err
 }
 
-func createCloudflareEmailAlias() (string, error) {
-	randomAlias, err := generateRandomAlias(10)
+// createCloudflareEmailAlias creates a forwarding rule for a new random alias
+// and returns the alias address along with the ID of the rule.
+func createCloudflareEmailAlias(ctx context.Context) (string, string, error) {
+	email, err := reserveAlias(ctx)
 	if err != nil {
-		return "", fmt.Errorf("error generating random alias: %v", err)
+		return "", "", err
 	}
 
-	email := fmt.Sprintf("%s@%s", randomAlias, config.EmailDomain)
-
 	rule := cloudflareEmailRule{
-		Actions: []struct {
-			Type  string   `json:"type"`
-			Value []string `json:"value"`
-		}{
-			{
-				Type:  "forward",
-				Value: []string{config.ForwardToEmail},
-			},
-		},
+		Actions: aliasRuleActions(),
 		Enabled: true,
 		Matchers: []struct {
 			Field string `json:"field"`
@@ -294,322 +1529,571 @@ func createCloudflareEmailAlias() (string, error) {
 				Value: email,
 			},
 		},
-		Name:     fmt.Sprintf("Rule created at %s", time.Now().Format(time.RFC3339)),
+		Name:     ruleName(config.RunID, time.Now()),
 		Priority: 0,
 	}
 
 	jsonData, err := json.Marshal(rule)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling JSON: %v", err)
+		return "", "", fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/zones/%s/email/routing/rules", config.CloudflareAPIBaseURL, config.CloudflareZoneID)
+	client := httpClient()
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return "", "", fmt.Errorf("error creating request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+config.CloudflareAPIToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return "", "", fmt.Errorf("error sending request: %v", err)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= cloudflareRateLimitRetries {
+			break
+		}
+		resp.Body.Close()
+
+		wait := cloudflareRetryDelay(resp.Header, attempt)
+		debugPrint(fmt.Sprintf("Cloudflare rate limited alias creation, retrying in %.1fs (%d/%d)", wait.Seconds(), attempt+1, cloudflareRateLimitRetries))
+		if err := sleepContext(ctx, wait); err != nil {
+			return "", "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", "", fmt.Errorf("error creating email alias, status code: %d, response: %s", resp.StatusCode, cloudflareErrorMessage(body))
+	}
+
+	var ruleResponse struct {
+		Result struct {
+			ID  string `json:"id"`
+			Tag string `json:"tag"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ruleResponse); err != nil {
+		return "", "", fmt.Errorf("error decoding response: %v", err)
+	}
+
+	ruleID := ruleResponse.Result.ID
+	if ruleID == "" {
+		ruleID = ruleResponse.Result.Tag
 	}
 
-	url := fmt.Sprintf("%s/zones/%s/email/routing/rules", cloudflareAPIBaseURL, config.CloudflareZoneID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	return email, ruleID, nil
+}
+
+// deleteCloudflareEmailAlias removes the forwarding rule with the given ID.
+func deleteCloudflareEmailAlias(ctx context.Context, ruleID string) error {
+	url := fmt.Sprintf("%s/zones/%s/email/routing/rules/%s", config.CloudflareAPIBaseURL, config.CloudflareZoneID, ruleID)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return fmt.Errorf("error creating request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+config.CloudflareAPIToken)
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := httpClient()
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %v", err)
+		return fmt.Errorf("error sending request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("error creating email alias, status code: %d, response: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("error deleting email alias, status code: %d, response: %s", resp.StatusCode, cloudflareErrorMessage(body))
 	}
 
-	return email, nil
+	return nil
 }
 
-func generateRandomAlias(length int) (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	alias := make([]byte, length)
-	for i := range alias {
-		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		if err != nil {
-			return "", err
-		}
-		alias[i] = charset[n.Int64()]
-	}
-	return string(alias), nil
+// promoSession holds what must stay the same across every request made for
+// one entry: the target, the exit proxy, the browser identity and the cookie
+// jar, whose cf_clearance is shared with other entries on the same proxy.
+type promoSession struct {
+	target    Target
+	proxyAddr string
+	userAgent string
+	jar       *sessionJar
+	// csrfToken is the anti-forgery token scraped during the warm-up, which
+	// the server checks against the cookies set alongside it
+	csrfToken string
 }
 
-func solveCaptchaWithEZCaptcha() (string, error) {
-	task := eZCaptchaTask{
-		ClientKey: config.EZCaptchaAPIKey,
-	}
-	task.Task.Type = "ReCaptchaV2TaskProxyless"
-	task.Task.WebsiteURL = config.MonsterPromoURL
-	task.Task.WebsiteKey = config.RecaptchaSiteKey
-	task.Task.SParams = `{"id":"0","version":"V2","sitekey":"` + config.RecaptchaSiteKey + `","function":"captchaSubmit","callback":"___grecaptcha_cfg.clients['0']['V']['V']['callback']","pageurl":"` + config.MonsterPromoURL + `"}`
-
-	jsonData, err := json.Marshal(task)
+// warmUpPromoSession loads the promo page of the target the way a browser
+// would before the first POST, through the same proxy and jar, so the cookies
+// the page sets are sent with every submission. With ScrapeCSRFToken set it
+// also keeps the page's anti-forgery token in the session.
+func warmUpPromoSession(ctx context.Context, session *promoSession) error {
+	client, err := newPromoHTTPClient(session.proxyAddr)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if session.jar != nil {
+		client.Jar = session.jar
 	}
 
-	resp, err := http.Post(ezCaptchaBaseURL+"/createTask", "application/json", bytes.NewBuffer(jsonData))
+	resp, err := doWithRetry(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", session.target.PromoURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", session.userAgent)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		req.Header.Set("Accept-Encoding", browserAcceptEncoding)
+		// The page cannot refer to itself, so only a configured referer
+		setBrowserHeaders(req, "")
+		req.AddCookie(&http.Cookie{Name: "cookieconsent_status", Value: "dismiss"})
+		return req, nil
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
-
-	var createTaskResult struct {
-		TaskID string `json:"taskId"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&createTaskResult)
+	page, err := readResponseBody(resp)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error reading promo page: %v", err)
 	}
 
-	debugPrint("Waiting for CAPTCHA solution...")
-	startTime := time.Now()
-	for i := 0; i < config.MaxCaptchaRetries; i++ {
-		debugPrint(fmt.Sprintf("Attempt %d/%d: Checking CAPTCHA solution...", i+1, config.MaxCaptchaRetries))
-		time.Sleep(10 * time.Second)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("promo page returned status code: %d", resp.StatusCode)
+	}
+	debugPrint(fmt.Sprintf("Promo page loaded, %d cookies set", len(resp.Cookies())))
 
-		result, err := getEZCaptchaTaskResult(createTaskResult.TaskID)
+	if config.ScrapeCSRFToken {
+		token, err := scrapeCSRFToken(page, config.CSRFFieldName)
 		if err != nil {
-			debugPrint(fmt.Sprintf("Error getting task result: %v", err))
-			continue
-		}
-
-		if result.Status == "ready" {
-			return result.Solution.GRecaptchaResponse, nil
+			return err
 		}
+		session.csrfToken = token
+		debugPrint(fmt.Sprintf("Found %s token", config.CSRFFieldName))
+	}
+	return nil
+}
 
-		if time.Since(startTime).Seconds() > config.CaptchaTimeout {
-			return "", fmt.Errorf("captcha solving timed out after %.2f seconds", config.CaptchaTimeout)
-		}
+// setBrowserHeaders sets the Accept-Language and Referer headers a browser
+// sends to the promo site. The configured Referer wins over referer, and no
+// Referer is sent when both are empty.
+func setBrowserHeaders(req *http.Request, referer string) {
+	if config.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", config.AcceptLanguage)
+	}
+	if config.Referer != "" {
+		referer = config.Referer
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
 	}
+}
 
-	return "", fmt.Errorf("captcha solving failed after %d attempts", config.MaxCaptchaRetries)
+// SubmitResult describes the response to one promo POST.
+type SubmitResult struct {
+	Status int
+	// Latency is how long the last attempt took, from sending the request
+	// to reading the whole body, without the waits between retries
+	Latency time.Duration
+	Body    string
+	// Clearance reports whether a cf_clearance cookie is held for the
+	// submit URL afterwards
+	Clearance bool
 }
 
-func getEZCaptchaTaskResult(taskID string) (*eZCaptchaResult, error) {
-	data := map[string]string{
-		"clientKey": config.EZCaptchaAPIKey,
-		"taskId":    taskID,
+// submitPromoEntry posts one entry for email and returns what the endpoint
+// answered. The result is filled in as far as the request got, even when an
+// error is returned. Every cookie the responses set is kept in the session
+// jar and sent with follow-up entries.
+func submitPromoEntry(ctx context.Context, session *promoSession, email, captchaToken string) (SubmitResult, error) {
+	data := url.Values{}
+	for name, value := range config.ExtraFormFields {
+		data.Set(name, value)
 	}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
+	setPromoFields(data)
+	// The email and token always win over a clashing extra field
+	data.Set("Email", email)
+	data.Set(captchaFormField(), captchaToken)
+	if session.csrfToken != "" {
+		data.Set(config.CSRFFieldName, session.csrfToken)
 	}
 
-	resp, err := http.Post(ezCaptchaBaseURL+"/getTaskResult", "application/json", bytes.NewBuffer(jsonData))
+	var result SubmitResult
+	body, contentType, err := encodePromoEntry(data)
 	if err != nil {
-		return nil, err
+		return result, err
 	}
-	defer resp.Body.Close()
-
-	var result eZCaptchaResult
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	client, err := newPromoHTTPClient(session.proxyAddr)
 	if err != nil {
-		return nil, err
-	}
-
-	return &result, nil
-}
+		return result, err
+	}
+	if session.jar != nil {
+		client.Jar = session.jar
+	}
+
+	var sent time.Time
+	// Cleared for every attempt; a failure before the connection was made
+	// lies with the proxy, one after it with the promo endpoint
+	var connected atomic.Bool
+	traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { connected.Store(true) },
+	})
+	newRequest := func() (*http.Request, error) {
+		sent = time.Now()
+		connected.Store(false)
+		req, err := http.NewRequestWithContext(traceCtx, "POST", session.target.SubmitURL, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
 
-func solveCaptchaWith2Captcha() (string, error) {
-	task := twoCaptchaTask{
-		ClientKey: config.TwoCaptchaAPIKey,
+		req.Header.Add("Content-Type", contentType)
+		req.Header.Add("User-Agent", session.userAgent)
+		req.Header.Set("Accept-Encoding", browserAcceptEncoding)
+		setBrowserHeaders(req, session.target.PromoURL)
+		for name, value := range config.ExtraHeaders {
+			req.Header.Set(name, value)
+		}
+		req.AddCookie(&http.Cookie{Name: "cookieconsent_status", Value: "dismiss"})
+		return req, nil
 	}
-	task.Task.Type = "ReCaptchaV2TaskProxyless"
-	task.Task.WebsiteURL = config.MonsterPromoURL
-	task.Task.WebsiteKey = config.RecaptchaSiteKey
 
-	jsonData, err := json.Marshal(task)
-	if err != nil {
-		return "", err
+	if config.DryRun {
+		return result, logDryRunRequest(newRequest)
 	}
 
-	resp, err := http.Post(twoCaptchaBaseURL+"/createTask", "application/json", bytes.NewBuffer(jsonData))
+	resp, err := doWithRetry(ctx, client, newRequest)
 	if err != nil {
-		return "", err
+		// A cancelled run says nothing about the proxy
+		if session.proxyAddr != "" && ctx.Err() == nil && !connected.Load() {
+			if proxies != nil {
+				proxies.MarkDead(session.proxyAddr)
+			}
+			return result, fmt.Errorf("%w: %v", errProxyDead, err)
+		}
+		return result, err
 	}
 	defer resp.Body.Close()
 
-	var createTaskResult struct {
-		TaskID int `json:"taskId"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&createTaskResult)
+	result.Status = resp.StatusCode
+	respBody, err := readResponseBody(resp)
+	result.Latency = time.Since(sent)
 	if err != nil {
-		return "", err
+		return result, fmt.Errorf("error reading response body: %v", err)
 	}
+	result.Body = string(respBody)
+	debugPrint(fmt.Sprintf("Response from promo submission after %s: %s", result.Latency.Round(time.Millisecond), result.Body))
 
-	debugPrint("Waiting for CAPTCHA solution...")
-	startTime := time.Now()
-	for i := 0; i < config.MaxCaptchaRetries; i++ {
-		debugPrint(fmt.Sprintf("Attempt %d/%d: Checking CAPTCHA solution...", i+1, config.MaxCaptchaRetries))
-		time.Sleep(10 * time.Second)
-
-		result, err := get2CaptchaTaskResult(createTaskResult.TaskID)
-		if err != nil {
-			debugPrint(fmt.Sprintf("Error getting task result: %v", err))
-			continue
-		}
-
-		if result.Status == "ready" {
-			return result.Solution.GRecaptchaResponse, nil
-		}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("promo submission failed with status code: %d", resp.StatusCode)
+	}
+	if err := checkPromoResponse(respBody); err != nil {
+		return result, err
+	}
 
-		if time.Since(startTime).Seconds() > config.CaptchaTimeout {
-			return "", fmt.Errorf("captcha solving timed out after %.2f seconds", config.CaptchaTimeout)
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "cf_clearance" && cookie.Value != "" {
+			result.Clearance = true
+			return result, nil
 		}
 	}
-
-	return "", fmt.Errorf("captcha solving failed after %d attempts", config.MaxCaptchaRetries)
+	if session.jar != nil && session.jar.clearance(resp.Request.URL) != "" {
+		debugPrint("Reusing cached Cloudflare clearance cookie")
+		result.Clearance = true
+	}
+	return result, nil
 }
 
-func get2CaptchaTaskResult(taskID int) (*twoCaptchaResult, error) {
-	data := map[string]interface{}{
-		"clientKey": config.TwoCaptchaAPIKey,
-		"taskId":    taskID,
+// encodePromoEntry returns the body of an entry POST with the form fields in
+// data, and its Content-Type. With SubmitContentType json the fields are sent
+// as one JSON object of strings, e.g. {"Email":"...","g-recaptcha-response":"..."}.
+func encodePromoEntry(data url.Values) (string, string, error) {
+	if config.SubmitContentType != submitContentTypeJSON {
+		return data.Encode(), "application/x-www-form-urlencoded", nil
 	}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := http.Post(twoCaptchaBaseURL+"/getTaskResult", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	fields := make(map[string]string, len(data))
+	for name := range data {
+		fields[name] = data.Get(name)
 	}
-	defer resp.Body.Close()
-
-	var result twoCaptchaResult
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	jsonData, err := json.Marshal(fields)
 	if err != nil {
-		return nil, err
+		return "", "", fmt.Errorf("error marshaling entry: %v", err)
 	}
-
-	return &result, nil
+	return string(jsonData), "application/json", nil
 }
 
-func submitPromoEntry(email, captchaToken string) (string, error) {
-	data := url.Values{}
-	data.Set("Email", email)
-	data.Set("g-recaptcha-response", captchaToken)
+// promoResponse is the JSON body the submit endpoint answers with, e.g.
+// {"success":false,"message":"Invalid captcha","code":"invalid_captcha"}.
+// Field names the form field a rejection is about, when the endpoint says.
+type promoResponse struct {
+	Success *bool  `json:"success"`
+	Message string `json:"message"`
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+}
 
-	var client *http.Client
+// defaultCaptchaRejectCodes are the response codes that mean the captcha
+// token was refused, unless captcha_reject_codes is set.
+var defaultCaptchaRejectCodes = []string{"invalid_captcha", "captcha_invalid", "captcha_failed"}
 
-	if config.UseProxy {
-		proxyURL, err := url.Parse(fmt.Sprintf("http://%s:%s@%s:%s", config.ProxyUsername, config.ProxyPassword, config.ProxyDNS, config.ProxyPort))
-		if err != nil {
-			return "", fmt.Errorf("failed to parse proxy URL: %v", err)
+// captchaRejected reports whether r refused the captcha token rather than
+// the entry itself, going by its code or field and never its message.
+func (r promoResponse) captchaRejected() bool {
+	if r.Field != "" && r.Field == captchaFormField() {
+		return true
+	}
+	for _, code := range config.CaptchaRejectCodes {
+		if r.Code != "" && strings.EqualFold(r.Code, code) {
+			return true
 		}
-
-		transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
-		client = &http.Client{Transport: transport}
-	} else {
-		client = &http.Client{}
 	}
+	return false
+}
 
-	req, err := http.NewRequest("POST", config.MonsterSubmitURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
+// promoRejectedError is returned when the submit endpoint answers 200 but
+// reports that the entry was not accepted.
+type promoRejectedError struct {
+	Message string
+	// CaptchaRejected is set when the response refused the captcha token
+	CaptchaRejected bool
+}
+
+func (e *promoRejectedError) Error() string {
+	if e.Message == "" {
+		return "promo submission rejected"
 	}
+	return fmt.Sprintf("promo submission rejected: %s", e.Message)
+}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-	req.Header.Add("Cookie", "cookieconsent_status=dismiss")
+// Is makes errors.Is(err, errCaptchaRejected) true for a refused token.
+func (e *promoRejectedError) Is(target error) bool {
+	return target == errCaptchaRejected && e.CaptchaRejected
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// promoEnded is set once any submission has returned errPromoEnded, so that
+// every mode stops starting new ones.
+var promoEnded atomic.Bool
+
+// checkPromoResponse returns errPromoEnded when body contains EndedMarker,
+// and a *promoRejectedError when it lacks SuccessMarker or reports a failed
+// entry. Bodies that don't match promoResponse are accepted, since the HTTP
+// status already indicated success.
+func checkPromoResponse(body []byte) error {
+	if config.EndedMarker != "" && bytes.Contains(body, []byte(config.EndedMarker)) {
+		return errPromoEnded
+	}
+	if config.SuccessMarker != "" && !bytes.Contains(body, []byte(config.SuccessMarker)) {
+		return &promoRejectedError{Message: "response does not contain the success marker"}
+	}
+
+	var parsed promoResponse
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Success == nil {
+		// Some endpoints answer in kind with success=false&message=...
+		values, err := url.ParseQuery(string(body))
+		success, boolErr := strconv.ParseBool(values.Get("success"))
+		if err != nil || boolErr != nil {
+			debugPrint("Promo response has an unexpected format, treating it as a success")
+			return nil
+		}
+		parsed = promoResponse{Success: &success, Message: values.Get("message"), Code: values.Get("code"), Field: values.Get("field")}
 	}
-	defer resp.Body.Close()
+	if !*parsed.Success {
+		return &promoRejectedError{Message: parsed.Message, CaptchaRejected: parsed.captchaRejected()}
+	}
+	return nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// logDryRunRequest prints the request that would have been sent in place of
+// sending it.
+func logDryRunRequest(newRequest func() (*http.Request, error)) error {
+	req, err := newRequest()
 	if err != nil {
-		return "", fmt.Errorf("error reading response body: %v", err)
+		return err
 	}
-	debugPrint(fmt.Sprintf("Response from promo submission: %s", string(body)))
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("promo submission failed with status code: %d", resp.StatusCode)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("error reading request body: %v", err)
 	}
 
-	var cfClearance string
-	for _, cookie := range resp.Cookies() {
-		if cookie.Name == "cf_clearance" {
-			cfClearance = cookie.Value
-			break
-		}
+	infof("[DRY RUN] Would %s %s\n", req.Method, req.URL)
+	for name, values := range req.Header {
+		infof("[DRY RUN]   %s: %s\n", name, strings.Join(values, ", "))
 	}
+	infof("[DRY RUN] Body: %s\n", string(body))
+	return nil
+}
 
-	return cfClearance, nil
+// defaultUserAgents is used when the config file doesn't list any.
+var defaultUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36 Edg/125.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
 }
 
-func submitPromoEntryWithCookie(email, captchaToken, cfClearance string) (string, error) {
-	data := url.Values{}
-	data.Set("Email", email)
-	data.Set("g-recaptcha-response", captchaToken)
+// randomUserAgent picks a User-Agent from UserAgents, or from the built-in
+// pool when none are configured.
+func randomUserAgent() string {
+	userAgents := config.UserAgents
+	if len(userAgents) == 0 {
+		userAgents = defaultUserAgents
+	}
+	return userAgents[random.Intn(len(userAgents))]
+}
 
-	var client *http.Client
+// doWithRetry sends the request built by newRequest, retrying responses with
+// a transient status code up to MaxSubmitRetries times. Retry-After is
+// honored when the server sends it.
+func doWithRetry(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
 
-	if config.UseProxy {
-		proxyURL, err := url.Parse(fmt.Sprintf("http://%s:%s@%s:%s", config.ProxyUsername, config.ProxyPassword, config.ProxyDNS, config.ProxyPort))
+		resp, err := client.Do(req)
 		if err != nil {
-			return "", fmt.Errorf("failed to parse proxy URL: %v", err)
+			return nil, err
 		}
+		if !isRetryableStatus(resp.StatusCode) || attempt >= config.MaxSubmitRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
 
-		transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
-		client = &http.Client{Transport: transport}
-	} else {
-		client = &http.Client{}
+		wait := retryDelay(resp.Header.Get("Retry-After"), attempt)
+		debugPrint(fmt.Sprintf("Promo submission returned status %d, retrying in %.1fs (%d/%d)", resp.StatusCode, wait.Seconds(), attempt+1, config.MaxSubmitRetries))
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	req, err := http.NewRequest("POST", config.MonsterSubmitURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
+// isRetryableStatus reports whether a promo submission that returned status
+// is worth retrying: Cloudflare rate limiting and upstream gateway errors.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
 	}
+	return false
+}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-	req.Header.Add("Cookie", fmt.Sprintf("cookieconsent_status=dismiss; cf_clearance=%s", cfClearance))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// maxRetryDelay caps every wait retryDelay returns, so a server asking for
+// a day does not stall a worker or hold up shutdown for that long.
+const maxRetryDelay = 30 * time.Second
+
+// retryDelay returns how long to wait before retry attempt n (0-based). A
+// Retry-After value in seconds or as an HTTP date takes precedence over the
+// default exponential backoff. Either is capped at maxRetryDelay.
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	if retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return min(max(time.Until(date), 0), maxRetryDelay)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %v", err)
+	delay := time.Second << attempt
+	if attempt >= 5 || delay > maxRetryDelay {
+		delay = maxRetryDelay
 	}
-	debugPrint(fmt.Sprintf("Response from additional promo submission: %s", string(body)))
+	return delay
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("additional promo submission failed with status code: %d", resp.StatusCode)
+// captchaFormField returns the form field the promo endpoint expects the
+// solved token in for the configured captcha type.
+func captchaFormField() string {
+	switch config.CaptchaType {
+	case captchaTypeTurnstile:
+		return "cf-turnstile-response"
+	case captchaTypeHCaptcha:
+		return "h-captcha-response"
+	default:
+		return "g-recaptcha-response"
 	}
+}
+
+// sleepContext pauses for d, returning early with the context's error if ctx
+// is canceled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	return "", nil
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func getUserInput(prompt string) string {
-	fmt.Print(prompt)
+	outputf("%s", prompt)
 	reader := bufio.NewReader(os.Stdin)
 	input, _ := reader.ReadString('\n')
 	return strings.TrimSpace(input)
 }
 
-func getUserInputInt(prompt string) int {
+// delayRange is the pause between automatic mode submissions, drawn
+// uniformly from [min, max] so the requests do not arrive on a fixed beat.
+type delayRange struct {
+	min, max time.Duration
+}
+
+// parseDelayRange parses a number of seconds, or a range like "5-15".
+func parseDelayRange(s string) (delayRange, error) {
+	minText, maxText, isRange := strings.Cut(s, "-")
+	if !isRange {
+		maxText = minText
+	}
+	minSeconds, err := strconv.ParseFloat(strings.TrimSpace(minText), 64)
+	if err != nil {
+		return delayRange{}, err
+	}
+	maxSeconds, err := strconv.ParseFloat(strings.TrimSpace(maxText), 64)
+	if err != nil {
+		return delayRange{}, err
+	}
+	if minSeconds < 0 || maxSeconds < minSeconds {
+		return delayRange{}, fmt.Errorf("delay range %q must not be negative or reversed", s)
+	}
+	return delayRange{
+		min: time.Duration(minSeconds * float64(time.Second)),
+		max: time.Duration(maxSeconds * float64(time.Second)),
+	}, nil
+}
+
+// next returns a random delay within the range.
+func (d delayRange) next() time.Duration {
+	if d.max <= d.min {
+		return d.min
+	}
+	return d.min + time.Duration(random.Int63n(int64(d.max-d.min)+1))
+}
+
+func (d delayRange) String() string {
+	if d.max <= d.min {
+		return d.min.String()
+	}
+	return fmt.Sprintf("%s-%s", d.min, d.max)
+}
+
+func getUserInputDelay(prompt string) delayRange {
 	for {
-		input := getUserInput(prompt)
-		value, err := strconv.Atoi(input)
+		delay, err := parseDelayRange(getUserInput(prompt))
 		if err == nil {
-			return value
+			return delay
 		}
-		fmt.Println("Invalid input. Please enter a number.")
+		errorf("Invalid input. Please enter a number of seconds or a range like 5-15.\n")
 	}
 }
 
@@ -618,49 +2102,53 @@ func confirmAction(prompt string) bool {
 	return strings.ToLower(input) == "y"
 }
 
-func debugPrint(message string) {
-	if config.DebugMode {
-		fmt.Printf("[DEBUG] %s\n", message)
-	}
+// SubmissionResult describes the outcome of one submitEntry call.
+type SubmissionResult struct {
+	Timestamp           time.Time `json:"timestamp"`
+	Email               string    `json:"email"`
+	RunID               string    `json:"run_id,omitempty"`
+	Target              string    `json:"target,omitempty"`
+	RuleID              string    `json:"rule_id,omitempty"`
+	Proxy               string    `json:"proxy,omitempty"`
+	CaptchaProvider     string    `json:"captcha_provider"`
+	CaptchaSolveSeconds float64   `json:"captcha_solve_seconds"`
+	Success             bool      `json:"success"`
+	Error               string    `json:"error,omitempty"`
+	HTTPStatus          int       `json:"http_status,omitempty"`
+	SubmitSeconds       float64   `json:"submit_seconds,omitempty"`
+	Code                string    `json:"code,omitempty"`
 }
 
-func logSubmission(email string) {
-	logFile, err := os.OpenFile("submissions.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		debugPrint(fmt.Sprintf("Error opening log file: %v", err))
-		return
-	}
-	defer logFile.Close()
-
-	logEntry := fmt.Sprintf("%s - Submitted entry for email: %s\n", time.Now().Format(time.RFC3339), email)
-	if _, err := logFile.WriteString(logEntry); err != nil {
-		debugPrint(fmt.Sprintf("Error writing to log file: %v", err))
+// logSubmissionResult stores result in the submission database when DBPath
+// is set. Otherwise, or if that fails, it appends result to the submissions
+// log, either as a plaintext line or, when LogFormat is "json", as one JSON
+// object per line.
+func logSubmissionResult(result SubmissionResult) {
+	if resultsDB != nil {
+		err := resultsDB.Upsert(result)
+		if err == nil {
+			return
+		}
+		errorf("Error writing to submission database: %v\n", err)
 	}
-}
-func checkCaptchaBalance() (float64, error) {
-	var url string
 
-	if config.UseTwoCaptcha {
-		url = fmt.Sprintf("https://api.2captcha.com/getBalance?key=%s&action=getbalance", config.TwoCaptchaAPIKey)
+	var logEntry string
+	if config.LogFormat == logFormatJSON {
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			debugPrint(fmt.Sprintf("Error marshaling log entry: %v", err))
+			return
+		}
+		logEntry = string(jsonData) + "\n"
+	} else if result.Success && result.Code != "" {
+		logEntry = fmt.Sprintf("%s - [run %s] Submitted entry for email: %s, received code: %s\n", result.Timestamp.Format(time.RFC3339), result.RunID, result.Email, result.Code)
+	} else if result.Success {
+		logEntry = fmt.Sprintf("%s - [run %s] Submitted entry for email: %s\n", result.Timestamp.Format(time.RFC3339), result.RunID, result.Email)
 	} else {
-		url = fmt.Sprintf("https://api.ez-captcha.com/getBalance?clientKey=%s", config.EZCaptchaAPIKey)
-	}
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+		logEntry = fmt.Sprintf("%s - [run %s] Failed entry for email: %s: %s\n", result.Timestamp.Format(time.RFC3339), result.RunID, result.Email, result.Error)
 	}
 
-	balance, err := strconv.ParseFloat(string(body), 64)
-	if err != nil {
-		return 0, err
+	if err := writeSubmissionLog(logEntry); err != nil {
+		debugPrint(fmt.Sprintf("Error writing to log file: %v", err))
 	}
-
-	return balance, nil
 }
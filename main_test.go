@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -45,30 +53,9 @@ func TestLoadConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Set the config file name to our temp file
-	getConfigFileName := func() string {
-		return tmpfile.Name()
-	}
-
-	// Modify the loadConfig function to use our test config file
-	oldLoadConfig := loadConfig
-	loadConfig = func() {
-		file, err := os.Open(getConfigFileName())
-		if err != nil {
-			log.Fatalf("Error opening config file: %v", err)
-		}
-		defer file.Close()
-
-		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&config)
-		if err != nil {
-			log.Fatalf("Error decoding config file: %v", err)
-		}
-	}
-
-	// Restore the original loadConfig function after the test
+	// Point loadConfig at our temp file and restore the original afterwards
+	configFileName = tmpfile.Name()
 	defer func() {
-		loadConfig = oldLoadConfig
 		configFileName = originalConfigFileName
 	}()
 
@@ -87,89 +74,946 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
-func TestGenerateRandomAlias(t *testing.T) {
-	alias, err := generateRandomAlias(10)
+func TestCreateCloudflareEmailAlias(t *testing.T) {
+	// Mock server to simulate Cloudflare API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []interface{}{}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"id": "test_rule_id"},
+		})
+	}))
+	defer server.Close()
+
+	// Temporarily override the Cloudflare API URL
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
+	knownAliases = nil
+	defer func() {
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		knownAliases = nil
+	}()
+
+	// Set up test config
+	config.CloudflareAPIToken = "test_token"
+	config.CloudflareZoneID = "test_zone_id"
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = "forward@example.com"
+
+	email, ruleID, err := createCloudflareEmailAlias(context.Background())
 	if err != nil {
-		t.Fatalf("generateRandomAlias returned an error: %v", err)
+		t.Fatalf("createCloudflareEmailAlias returned an error: %v", err)
 	}
-	if len(alias) != 10 {
-		t.Errorf("Expected alias length to be 10, got %d", len(alias))
+
+	if ruleID != "test_rule_id" {
+		t.Errorf("Expected rule ID 'test_rule_id', got '%s'", ruleID)
+	}
+
+	if email == "" {
+		t.Error("Expected non-empty email, got empty string")
+	}
+
+	if emailDomain := "@" + config.EmailDomain; !strings.HasSuffix(email, emailDomain) {
+		t.Errorf("Expected email to end with '%s', got '%s'", emailDomain, email)
 	}
 }
 
-func TestCheckCaptchaBalance(t *testing.T) {
-	// Mock server to simulate the captcha balance API
+func TestCaptchaFormField(t *testing.T) {
+	oldCaptchaType := config.CaptchaType
+	defer func() { config.CaptchaType = oldCaptchaType }()
+
+	tests := map[string]string{
+		"":                     "g-recaptcha-response",
+		captchaTypeRecaptchaV2: "g-recaptcha-response",
+		captchaTypeTurnstile:   "cf-turnstile-response",
+		captchaTypeHCaptcha:    "h-captcha-response",
+	}
+	for captchaType, want := range tests {
+		config.CaptchaType = captchaType
+		if got := captchaFormField(); got != want {
+			t.Errorf("captchaFormField() for %q = %s, want %s", captchaType, got, want)
+		}
+	}
+}
+
+func TestSubmissionStatsConcurrent(t *testing.T) {
+	var stats submissionStats
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stats.record(i%4 != 0)
+		}(i)
+	}
+	wg.Wait()
+
+	successCount, totalCount := stats.record(true)
+	if totalCount != 101 || successCount != 76 {
+		t.Errorf("Expected 76/101, got %d/%d", successCount, totalCount)
+	}
+}
+
+func TestDeleteCloudflareEmailAlias(t *testing.T) {
+	var gotMethod, gotPath string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotPath = r.URL.Path
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("10.5"))
 	}))
 	defer server.Close()
 
-	// Temporarily override the API URLs
-	oldEZCaptchaBaseURL := ezCaptchaBaseURL
-	oldTwoCaptchaBaseURL := twoCaptchaBaseURL
-	ezCaptchaBaseURL = server.URL
-	twoCaptchaBaseURL = server.URL
+	oldCloudflareAPIBaseURL := config.CloudflareAPIBaseURL
+	config.CloudflareAPIBaseURL = server.URL
 	defer func() {
-		ezCaptchaBaseURL = oldEZCaptchaBaseURL
-		twoCaptchaBaseURL = oldTwoCaptchaBaseURL
+		config.CloudflareAPIBaseURL = oldCloudflareAPIBaseURL
 	}()
 
-	// Test EZ Captcha
-	config.UseTwoCaptcha = false
-	balance, err := checkCaptchaBalance()
+	config.CloudflareZoneID = "test_zone_id"
+
+	if err := deleteCloudflareEmailAlias(context.Background(), "test_rule_id"); err != nil {
+		t.Fatalf("deleteCloudflareEmailAlias returned an error: %v", err)
+	}
+	if gotMethod != "DELETE" || gotPath != "/zones/test_zone_id/email/routing/rules/test_rule_id" {
+		t.Errorf("Unexpected request %s %s", gotMethod, gotPath)
+	}
+}
+
+func TestLogSubmissionResultJSON(t *testing.T) {
+	oldLogFileName := submissionLogFileName
+	oldLogFormat := config.LogFormat
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+	config.LogFormat = logFormatJSON
+	defer func() {
+		closeSubmissionLog()
+		submissionLogFileName = oldLogFileName
+		config.LogFormat = oldLogFormat
+	}()
+
+	logSubmissionResult(SubmissionResult{Email: "a@test.com", Proxy: "1.2.3.4:8080", CaptchaProvider: "ezcaptcha", Success: true})
+	logSubmissionResult(SubmissionResult{Email: "b@test.com", CaptchaProvider: "2captcha", Error: "boom"})
+
+	data, err := os.ReadFile(submissionLogFileName)
 	if err != nil {
-		t.Fatalf("checkCaptchaBalance returned an error: %v", err)
+		t.Fatal(err)
 	}
-	if balance != 10.5 {
-		t.Errorf("Expected balance to be 10.5, got %f", balance)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d", len(lines))
 	}
 
-	// Test 2Captcha
-	config.UseTwoCaptcha = true
-	balance, err = checkCaptchaBalance()
+	var entry SubmissionResult
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Log line is not valid JSON: %v", err)
+	}
+	if entry.Email != "b@test.com" || entry.Success || entry.Error != "boom" {
+		t.Errorf("Unexpected log entry: %+v", entry)
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	oldMaxSubmitRetries := config.MaxSubmitRetries
+	config.MaxSubmitRetries = 3
+	defer func() { config.MaxSubmitRetries = oldMaxSubmitRetries }()
+
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statuses[calls])
+		calls++
+	}))
+	defer server.Close()
+
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest("POST", server.URL, strings.NewReader("Email=a"))
+	}
+	resp, err := doWithRetry(context.Background(), server.Client(), newRequest)
 	if err != nil {
-		t.Fatalf("checkCaptchaBalance returned an error: %v", err)
+		t.Fatalf("doWithRetry returned an error: %v", err)
 	}
-	if balance != 10.5 {
-		t.Errorf("Expected balance to be 10.5, got %f", balance)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("Expected 200 after 3 calls, got %d after %d", resp.StatusCode, calls)
+	}
+
+	// Client errors other than 429 are returned without retrying
+	statuses = []int{http.StatusForbidden}
+	calls = 0
+	resp, err = doWithRetry(context.Background(), server.Client(), newRequest)
+	if err != nil {
+		t.Fatalf("doWithRetry returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || calls != 1 {
+		t.Errorf("Expected a single 403, got %d after %d calls", resp.StatusCode, calls)
 	}
 }
 
-func TestCreateCloudflareEmailAlias(t *testing.T) {
-	// Mock server to simulate Cloudflare API
+func TestRetryDelay(t *testing.T) {
+	if got := retryDelay("7", 0); got != 7*time.Second {
+		t.Errorf("Expected Retry-After seconds to be honored, got %v", got)
+	}
+	if got := retryDelay("", 2); got != 4*time.Second {
+		t.Errorf("Expected 4s backoff for attempt 2, got %v", got)
+	}
+	if got := retryDelay("", 10); got != 30*time.Second {
+		t.Errorf("Expected backoff to be capped at 30s, got %v", got)
+	}
+	if got := retryDelay("86400", 0); got != maxRetryDelay {
+		t.Errorf("Expected a day of Retry-After to be capped at %v, got %v", maxRetryDelay, got)
+	}
+	if got := retryDelay(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 0); got != maxRetryDelay {
+		t.Errorf("Expected a Retry-After date an hour away to be capped at %v, got %v", maxRetryDelay, got)
+	}
+}
+
+func TestRandomUserAgent(t *testing.T) {
+	oldUserAgents := config.UserAgents
+	defer func() { config.UserAgents = oldUserAgents }()
+
+	config.UserAgents = nil
+	ua := randomUserAgent()
+	found := false
+	for _, candidate := range defaultUserAgents {
+		if ua == candidate {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a built-in User-Agent, got %q", ua)
+	}
+
+	config.UserAgents = []string{"custom-agent/1.0"}
+	if ua := randomUserAgent(); ua != "custom-agent/1.0" {
+		t.Errorf("Expected the configured User-Agent, got %q", ua)
+	}
+}
+
+func TestSubmitPromoEntry(t *testing.T) {
+	var gotCookies []string
+	var gotForm url.Values
+	var gotReferer string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"result":  map[string]string{"id": "test_rule_id"},
-		})
+		gotCookies = append(gotCookies, r.Header.Get("Cookie"))
+		gotReferer = r.Referer()
+		r.ParseForm()
+		gotForm = r.PostForm
+		http.SetCookie(w, &http.Cookie{Name: "cf_clearance", Value: "clearance_value"})
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "abc"})
+		w.Write([]byte(`{"success":true}`))
 	}))
 	defer server.Close()
 
-	// Temporarily override the Cloudflare API URL
-	oldCloudflareAPIBaseURL := cloudflareAPIBaseURL
-	cloudflareAPIBaseURL = server.URL
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.ExtraFormFields = map[string]string{"Country": "US", "Email": "ignored@test.com"}
+	config.ExtraHeaders = map[string]string{"Referer": "https://example.com/promo"}
+
+	session := &promoSession{
+		target:    Target{SubmitURL: server.URL},
+		userAgent: "test-agent",
+		jar:       newSessionJar(newClearanceJar(time.Now)),
+	}
+
+	// Initial entry: no cookies yet, clearance and session cookies returned
+	submitted, err := submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if err != nil {
+		t.Fatalf("submitPromoEntry returned an error: %v", err)
+	}
+	if !submitted.Clearance || submitted.Status != http.StatusOK {
+		t.Errorf("Expected a clearance cookie and 200, got %v and %d", submitted.Clearance, submitted.Status)
+	}
+	if submitted.Body != `{"success":true}` || submitted.Latency <= 0 {
+		t.Errorf("Expected the response body and a latency, got %q after %s", submitted.Body, submitted.Latency)
+	}
+	if gotForm.Get("Email") != "a@test.com" || gotForm.Get("g-recaptcha-response") != "token" || gotForm.Get("Country") != "US" {
+		t.Errorf("Unexpected form values: %v", gotForm)
+	}
+	if gotReferer != "https://example.com/promo" {
+		t.Errorf("Expected the extra Referer header, got %q", gotReferer)
+	}
+
+	// Follow-up entry: every cookie comes back from the jar
+	_, err = submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if err != nil {
+		t.Fatalf("submitPromoEntry with cookies returned an error: %v", err)
+	}
+
+	if gotCookies[0] != "cookieconsent_status=dismiss" {
+		t.Errorf("Unexpected initial Cookie header: %q", gotCookies[0])
+	}
+	if gotCookies[1] != "cookieconsent_status=dismiss; session_id=abc; cf_clearance=clearance_value" {
+		t.Errorf("Unexpected follow-up Cookie header: %q", gotCookies[1])
+	}
+}
+
+func TestPromoRequestsSendBrowserHeaders(t *testing.T) {
+	referers := make(map[string]string)
+	languages := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		referers[r.Method] = r.Referer()
+		languages[r.Method] = r.Header.Get("Accept-Language")
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.AcceptLanguage = "en-GB,en;q=0.8"
+
+	session := &promoSession{target: Target{PromoURL: server.URL + "/promo", SubmitURL: server.URL + "/submit"}, userAgent: "test-agent"}
+	warmUpPromoSession(context.Background(), session)
+	submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if referers["GET"] != "" || referers["POST"] != server.URL+"/promo" {
+		t.Errorf("Expected no referer on the page load and the promo page on the POST, got %v", referers)
+	}
+	if languages["GET"] != "en-GB,en;q=0.8" || languages["POST"] != "en-GB,en;q=0.8" {
+		t.Errorf("Expected the configured Accept-Language on both requests, got %v", languages)
+	}
+
+	config.Referer = "https://www.google.com/"
+	warmUpPromoSession(context.Background(), session)
+	submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if referers["GET"] != config.Referer || referers["POST"] != config.Referer {
+		t.Errorf("Expected the configured referer on both requests, got %v", referers)
+	}
+}
+
+func TestSubmitPromoEntryDryRun(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.DryRun = true
+
+	submitted, err := submitPromoEntry(context.Background(), &promoSession{target: Target{SubmitURL: server.URL}, userAgent: "test-agent"}, "a@test.com", "token")
+	if err != nil {
+		t.Fatalf("submitPromoEntry returned an error: %v", err)
+	}
+	if requests != 0 || submitted.Status != 0 {
+		t.Errorf("Expected no request to be sent in dry-run mode, got %d (status %d)", requests, submitted.Status)
+	}
+}
+
+func TestCheckConfigCollectsErrors(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{
+		CloudflareAPIToken: "token",
+		EZCaptchaAPIKey:    "key",
+		RecaptchaSiteKey:   "site_key",
+		EmailDomain:        "test.com",
+		CloudflareZoneID:   "zone",
+		ForwardToEmail:     "not an email",
+		MonsterPromoURL:    "not a url",
+		MonsterSubmitURL:   "ftp://test.com/submit",
+		UseProxy:           true,
+		ProxyDNS:           "proxy.test.com",
+		ProxyPort:          "eighty",
+		CaptchaTimeout:     -1,
+	}
+
+	errs := checkConfig()
+	if len(errs) != 5 {
+		t.Fatalf("Expected 5 errors, got %d: %v", len(errs), errs)
+	}
+	for i, want := range []string{"Forward to email", "Monster promo URL", "Monster submit URL", "Proxy port", "Captcha timeout"} {
+		if !strings.HasPrefix(errs[i], want) {
+			t.Errorf("Expected error %d to start with %q, got %q", i, want, errs[i])
+		}
+	}
+
+	config.ForwardToEmail = "me@example.com"
+	config.MonsterPromoURL = "https://test.com/promo"
+	config.MonsterSubmitURL = "https://test.com/submit"
+	config.ProxyPort = "8080"
+	config.CaptchaTimeout = 0
+	if errs := checkConfig(); len(errs) != 0 {
+		t.Errorf("Expected a valid config, got %v", errs)
+	}
+	if config.CaptchaTimeout != 120 {
+		t.Errorf("Expected CaptchaTimeout to default to 120, got %v", config.CaptchaTimeout)
+	}
+
+	config.ForwardToEmail = "me@example.com,not an email"
+	config.ForwardToEmails = []string{"you@example.com"}
+	if errs := checkConfig(); len(errs) != 1 || !strings.Contains(errs[0], `"not an email"`) {
+		t.Errorf("Expected only the malformed forward address to be reported, got %v", errs)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("PROMOGEN_CLOUDFLARE_API_TOKEN", "env_token")
+	t.Setenv("PROMOGEN_EZCAPTCHA_API_KEY", "env_ez_key")
+
+	c := Config{CloudflareAPIToken: "file_token", EZCaptchaAPIKey: "file_ez_key", TwoCaptchaAPIKey: "file_2captcha_key"}
+	if err := applyEnvOverrides(&c); err != nil {
+		t.Fatalf("applyEnvOverrides returned an error: %v", err)
+	}
+
+	if c.CloudflareAPIToken != "env_token" || c.EZCaptchaAPIKey != "env_ez_key" {
+		t.Errorf("Expected environment values to win, got %q and %q", c.CloudflareAPIToken, c.EZCaptchaAPIKey)
+	}
+	if c.TwoCaptchaAPIKey != "file_2captcha_key" {
+		t.Errorf("Expected unset variables to leave the file value, got %q", c.TwoCaptchaAPIKey)
+	}
+}
+
+func TestCheckPromoResponse(t *testing.T) {
+	if err := checkPromoResponse([]byte(`{"success":true}`)); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	}
+	if err := checkPromoResponse([]byte(`<html>Thanks for entering</html>`)); err != nil {
+		t.Errorf("Expected unexpected bodies to be accepted, got %v", err)
+	}
+
+	err := checkPromoResponse([]byte(`{"success":false,"message":"Invalid captcha","field":"g-recaptcha-response"}`))
+	rejected, ok := err.(*promoRejectedError)
+	if !ok {
+		t.Fatalf("Expected a *promoRejectedError, got %v", err)
+	}
+	if rejected.Message != "Invalid captcha" || !strings.Contains(err.Error(), "Invalid captcha") {
+		t.Errorf("Expected the server message in the error, got %q", err)
+	}
+
+	if !errors.Is(err, errCaptchaRejected) {
+		t.Errorf("Expected a rejection of the captcha field to match errCaptchaRejected, got %v", err)
+	}
+
+	err = checkPromoResponse([]byte(`success=false&message=Already+entered`))
+	if rejected, ok := err.(*promoRejectedError); !ok || rejected.Message != "Already entered" {
+		t.Errorf("Expected a form-encoded rejection to be parsed, got %v", err)
+	}
+}
+
+func TestCheckPromoResponseCaptchaRejected(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaRejectCodes = defaultCaptchaRejectCodes
+
+	for _, tc := range []struct {
+		body     string
+		rejected bool
+	}{
+		{`{"success":false,"message":"Token expired","code":"INVALID_CAPTCHA"}`, true},
+		{`success=false&message=Try+again&code=captcha_failed`, true},
+		{`{"success":false,"message":"Bad token","field":"g-recaptcha-response"}`, true},
+		// The message alone is never trusted either way
+		{`{"success":false,"message":"Entries need a captcha and a valid email","field":"Email"}`, false},
+		{`{"success":false,"message":"Already entered","code":"duplicate_entry"}`, false},
+	} {
+		err := checkPromoResponse([]byte(tc.body))
+		if errors.Is(err, errCaptchaRejected) != tc.rejected {
+			t.Errorf("Expected captcha rejected %v for %s, got %v", tc.rejected, tc.body, err)
+		}
+	}
+}
+
+func TestSubmitPromoEntryJSONBody(t *testing.T) {
+	var contentType string
+	var fields map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&fields)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":false,"message":"Invalid captcha","field":"g-recaptcha-response"}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.SubmitContentType = submitContentTypeJSON
+	config.ExtraFormFields = map[string]string{"Country": "US"}
+
+	session := &promoSession{target: Target{SubmitURL: server.URL}, userAgent: "test-agent"}
+	_, err := submitPromoEntry(context.Background(), session, "a@test.com", "token")
+	if !errors.Is(err, errCaptchaRejected) {
+		t.Errorf("Expected the JSON rejection to be parsed, got %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Expected a JSON Content-Type, got %q", contentType)
+	}
+	want := map[string]string{"Email": "a@test.com", "g-recaptcha-response": "token", "Country": "US"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Expected %v, got %v", want, fields)
+	}
+}
+
+func TestCheckPromoResponseMarkers(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.SuccessMarker = "Thanks for entering"
+	config.EndedMarker = "promotion has ended"
+
+	if err := checkPromoResponse([]byte(`<html>Thanks for entering</html>`)); err != nil {
+		t.Errorf("Expected a body with the success marker to be accepted, got %v", err)
+	}
+	if _, ok := checkPromoResponse([]byte(`<html>Please try again</html>`)).(*promoRejectedError); !ok {
+		t.Error("Expected a body without the success marker to be rejected")
+	}
+	if err := checkPromoResponse([]byte(`<html>This promotion has ended. Thanks for entering</html>`)); err != errPromoEnded {
+		t.Errorf("Expected errPromoEnded, got %v", err)
+	}
+}
+
+func TestRunBatchStopsWhenPromoEnds(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>This promotion has ended</html>`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
 	defer func() {
-		cloudflareAPIBaseURL = oldCloudflareAPIBaseURL
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+		promoEnded.Store(false)
 	}()
+	config.UseCloudflareEmail = true
+	config.MonsterSubmitURL = promo.URL
+	config.EndedMarker = "promotion has ended"
+	config.Concurrency = 1
+	config.MaxCaptchaRetries = 3
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
 
-	// Set up test config
-	config.CloudflareAPIToken = "test_token"
-	config.CloudflareZoneID = "test_zone_id"
-	config.EmailDomain = "test.com"
-	config.ForwardToEmail = "forward@example.com"
+	var stats submissionStats
+	successCount, totalCount := runBatch(context.Background(), 5, &stats)
+	if successCount != 0 || totalCount != 1 {
+		t.Errorf("Expected the batch to stop after the first entry, got %d/%d", successCount, totalCount)
+	}
+	if !promoEnded.Load() || solves != 1 {
+		t.Errorf("Expected the promo to be marked as ended after 1 solve, got %v after %d", promoEnded.Load(), solves)
+	}
+}
+
+// stubCaptchaSolver reports a fixed balance and never solves anything.
+type stubCaptchaSolver struct {
+	balance float64
+	err     error
+}
 
-	email, err := createCloudflareEmailAlias()
+func (s stubCaptchaSolver) Name() string { return "stub" }
+
+func (s stubCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	return "", s.err
+}
+
+func (s stubCaptchaSolver) Balance() (float64, error) { return s.balance, s.err }
+
+func TestCheckMinBalance(t *testing.T) {
+	oldConfig, oldCaptchaSolver := config, captchaSolver
+	defer func() {
+		config, captchaSolver = oldConfig, oldCaptchaSolver
+	}()
+	config.MinBalance = 1
+
+	captchaSolver = stubCaptchaSolver{balance: 2}
+	if err := checkMinBalance(); err != nil {
+		t.Errorf("Expected no error above the minimum, got %v", err)
+	}
+
+	captchaSolver = stubCaptchaSolver{balance: 0.5}
+	if err := checkMinBalance(); err == nil || !strings.Contains(err.Error(), "$0.50") {
+		t.Errorf("Expected an error naming the balance, got %v", err)
+	}
+
+	captchaSolver = stubCaptchaSolver{err: io.ErrUnexpectedEOF}
+	if err := checkMinBalance(); err != nil {
+		t.Errorf("Expected a failed balance lookup not to stop the run, got %v", err)
+	}
+}
+
+// countingCaptchaSolver hands out numbered tokens.
+type countingCaptchaSolver struct {
+	solves *int
+}
+
+func (s countingCaptchaSolver) Name() string { return "counting" }
+
+func (s countingCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	*s.solves++
+	return fmt.Sprintf("token_%d", *s.solves), nil
+}
+
+func (s countingCaptchaSolver) Balance() (float64, error) { return 0, nil }
+
+func TestSubmitEntryResolvesRejectedCaptcha(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	var tokens []string
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		tokens = append(tokens, r.PostForm.Get("g-recaptcha-response"))
+		if len(tokens) < 3 {
+			w.Write([]byte(`{"success":false,"message":"Invalid captcha","field":"g-recaptcha-response"}`))
+			return
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterSubmitURL = promo.URL
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.MaxCaptchaRetries = 1
+	config.MaxCaptchaResolves = 2
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	// Two re-solves after the first solve, whatever the poll cap
+	result, err := submitEntry(context.Background(), nextTarget())
 	if err != nil {
-		t.Fatalf("createCloudflareEmailAlias returned an error: %v", err)
+		t.Fatalf("submitEntry returned an error: %v", err)
+	}
+	if !result.Success || solves != 3 {
+		t.Errorf("Expected success after 3 solves, got success=%v after %d", result.Success, solves)
+	}
+	if strings.Join(tokens, ",") != "token_1,token_2,token_3" {
+		t.Errorf("Expected a fresh token for every attempt, got %v", tokens)
 	}
 
-	if email == "" {
-		t.Error("Expected non-empty email, got empty string")
+	// One re-solve short, the entry fails after exactly 1+MaxCaptchaResolves solves
+	tokens, solves = nil, 0
+	config.MaxCaptchaResolves = 1
+	if _, err := submitEntry(context.Background(), nextTarget()); !errors.Is(err, errCaptchaRejected) || solves != 2 {
+		t.Errorf("Expected errCaptchaRejected after exactly 2 solves, got %v after %d", err, solves)
 	}
+}
 
-	if emailDomain := "@" + config.EmailDomain; !strings.HasSuffix(email, emailDomain) {
-		t.Errorf("Expected email to end with '%s', got '%s'", emailDomain, email)
+func TestSubmitEntryWarmsUpSession(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	var requests []string
+	var submitCookies string
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "GET" {
+			http.SetCookie(w, &http.Cookie{Name: "__cf_bm", Value: "bot_management"})
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		submitCookies = r.Header.Get("Cookie")
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterPromoURL = promo.URL + "/promo"
+	config.MonsterSubmitURL = promo.URL + "/submit"
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	if _, err := submitEntry(context.Background(), nextTarget()); err != nil {
+		t.Fatalf("submitEntry returned an error: %v", err)
+	}
+	if len(requests) != 2 || requests[0] != "GET /promo" || requests[1] != "POST /submit" {
+		t.Fatalf("Expected the promo page to be loaded before the POST, got %v", requests)
+	}
+	if !strings.Contains(submitCookies, "__cf_bm=bot_management") {
+		t.Errorf("Expected the warm-up cookie to be sent with the POST, got %q", submitCookies)
+	}
+}
+
+func TestSubmitEntryFollowUps(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	var tokens []string
+	rejectAfter := 0
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			tokens = append(tokens, r.FormValue("g-recaptcha-response"))
+			if rejectAfter > 0 && len(tokens) > rejectAfter {
+				w.Write([]byte(`{"success":false,"message":"Invalid captcha","field":"g-recaptcha-response"}`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "cf_clearance", Value: "clearance_value"})
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterPromoURL = promo.URL + "/promo"
+	config.MonsterSubmitURL = promo.URL + "/submit"
+	config.EntriesPerClearance = 2
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	if _, err := submitEntry(context.Background(), nextTarget()); err != nil {
+		t.Fatalf("submitEntry returned an error: %v", err)
+	}
+	if want := []string{"token_1", "token_2", "token_3"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Expected the entry and 2 follow-ups with fresh tokens %q, got %q", want, tokens)
+	}
+
+	// A refused token ends the follow-ups instead of wasting the rest
+	tokens, solves, rejectAfter = nil, 0, 2
+	config.EntriesPerClearance = 5
+	if _, err := submitEntry(context.Background(), nextTarget()); err != nil {
+		t.Fatalf("submitEntry returned an error: %v", err)
+	}
+	if len(tokens) != 3 || solves != 3 {
+		t.Errorf("Expected the follow-ups to stop at the refused token, got %d POSTs and %d solves", len(tokens), solves)
+	}
+
+	tokens, rejectAfter = nil, 0
+	config.SingleEntryMode = true
+	if _, err := submitEntry(context.Background(), nextTarget()); err != nil {
+		t.Fatalf("submitEntry returned an error: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Errorf("Expected no follow-ups in single entry mode, got %d POSTs", len(tokens))
+	}
+}
+
+func TestParseDelayRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		min, max time.Duration
+	}{
+		{"10", 10 * time.Second, 10 * time.Second},
+		{"5-15", 5 * time.Second, 15 * time.Second},
+		{" 0.5 - 2 ", 500 * time.Millisecond, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseDelayRange(tt.input)
+		if err != nil {
+			t.Fatalf("parseDelayRange(%q) returned an error: %v", tt.input, err)
+		}
+		if got.min != tt.min || got.max != tt.max {
+			t.Errorf("parseDelayRange(%q) = %s, want %s-%s", tt.input, got, tt.min, tt.max)
+		}
+	}
+
+	for _, input := range []string{"", "ten", "15-5", "-5", "5-"} {
+		if _, err := parseDelayRange(input); err == nil {
+			t.Errorf("Expected parseDelayRange(%q) to fail", input)
+		}
+	}
+}
+
+func TestDelayRangeNext(t *testing.T) {
+	delay := delayRange{min: 5 * time.Second, max: 15 * time.Second}
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		d := delay.next()
+		if d < delay.min || d > delay.max {
+			t.Fatalf("next() = %s, want within %s", d, delay)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 900 {
+		t.Errorf("Expected random delays, got only %d distinct values", len(seen))
+	}
+
+	fixed := delayRange{min: 10 * time.Second, max: 10 * time.Second}
+	if d := fixed.next(); d != 10*time.Second {
+		t.Errorf("Expected a fixed 10s delay, got %s", d)
+	}
+}
+
+func TestAutomaticModeWithFlagDelayDoesNotPrompt(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName, oldRunSummaryDir := config, captchaSolver, submissionLogFileName, runSummaryDir
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName, runSummaryDir = oldConfig, oldCaptchaSolver, oldLogFileName, oldRunSummaryDir
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterSubmitURL = promo.URL
+	config.Concurrency = 1
+	config.MaxSubmissions = 2
+	config.CooldownThreshold = 5
+	config.BalanceCheckEvery = 25
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+	runSummaryDir = t.TempDir()
+
+	// Stdin would block the test if automaticMode prompted for a delay
+	done := make(chan struct{})
+	go func() {
+		automaticMode(context.Background(), &delayRange{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("automaticMode did not finish, it may be waiting for input")
+	}
+	if solves != 2 {
+		t.Errorf("Expected 2 submissions, got %d", solves)
+	}
+}
+
+func TestAutomaticModeStopsAtMaxRuntime(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName, oldRunSummaryDir := config, captchaSolver, submissionLogFileName, runSummaryDir
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName, runSummaryDir = oldConfig, oldCaptchaSolver, oldLogFileName, oldRunSummaryDir
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterSubmitURL = promo.URL
+	config.Concurrency = 1
+	config.MaxSubmissions = 0
+	config.MaxRuntime = 0.2
+	config.CooldownThreshold = 5
+	config.BalanceCheckEvery = 25
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+	runSummaryDir = t.TempDir()
+
+	done := make(chan struct{})
+	go func() {
+		automaticMode(context.Background(), &delayRange{min: 50 * time.Millisecond, max: 50 * time.Millisecond})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("automaticMode did not stop at max_runtime")
+	}
+	if solves == 0 {
+		t.Error("Expected submissions before max_runtime passed")
+	}
+}
+
+func TestModeNames(t *testing.T) {
+	for name, want := range map[string]int{"automatic": modeAutomatic, "2": modeAutomatic, "schedule": modeSchedule, "interactive": modeInteractive} {
+		if got := modeNames[name]; got != want {
+			t.Errorf("modeNames[%q] = %d, want %d", name, got, want)
+		}
+	}
+	if _, ok := modeNames["auto"]; ok {
+		t.Error("Expected unknown mode names to be rejected")
+	}
+}
+
+// inFlightCaptchaSolver records the most solves it has seen running at once.
+type inFlightCaptchaSolver struct {
+	inFlight, peak *int32
+}
+
+func (s inFlightCaptchaSolver) Name() string { return "in-flight" }
+
+func (s inFlightCaptchaSolver) Solve(ctx context.Context, siteKey, pageURL string) (string, error) {
+	n := atomic.AddInt32(s.inFlight, 1)
+	defer atomic.AddInt32(s.inFlight, -1)
+	for {
+		old := atomic.LoadInt32(s.peak)
+		if n <= old || atomic.CompareAndSwapInt32(s.peak, old, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return "token", nil
+}
+
+func (s inFlightCaptchaSolver) Balance() (float64, error) { return 0, nil }
+
+func TestSolveCaptchaRespectsMaxConcurrentCaptchas(t *testing.T) {
+	var inFlight, peak int32
+	oldCaptchaSolver, oldCaptchaSlots := captchaSolver, captchaSlots
+	defer func() { captchaSolver, captchaSlots = oldCaptchaSolver, oldCaptchaSlots }()
+	captchaSolver = inFlightCaptchaSolver{inFlight: &inFlight, peak: &peak}
+	captchaSlots = make(chan struct{}, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := solveCaptcha(context.Background(), Target{}); err != nil {
+				t.Errorf("solveCaptcha returned an error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Errorf("Expected at most 2 solves at once, got %d", peak)
+	}
+
+	// A caller waiting for a slot gives up with its context
+	captchaSlots <- struct{}{}
+	captchaSlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := solveCaptcha(ctx, Target{}); err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait for a slot to time out, got %v", err)
+	}
+}
+
+func TestCheckBaseURLs(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{EZCaptchaBaseURL: "http://localhost:8080/ez/"}
+	if errs := checkBaseURLs(); len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	if config.CloudflareAPIBaseURL != defaultCloudflareAPIBaseURL || config.MailTMBaseURL != defaultMailTMBaseURL {
+		t.Errorf("Expected unset base URLs to default, got %q and %q", config.CloudflareAPIBaseURL, config.MailTMBaseURL)
+	}
+	if config.EZCaptchaBaseURL != "http://localhost:8080/ez" {
+		t.Errorf("Expected the override without its trailing slash, got %q", config.EZCaptchaBaseURL)
+	}
+
+	config.TwoCaptchaBaseURL = "api.2captcha.com"
+	if errs := checkBaseURLs(); len(errs) != 1 || !strings.HasPrefix(errs[0], "2captcha base URL") {
+		t.Errorf("Expected the invalid 2captcha base URL to be reported, got %v", errs)
 	}
 }
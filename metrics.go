@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	submissionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "submissions_total",
+		Help: "Promo entries attempted.",
+	})
+	submissionsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "submissions_failed",
+		Help: "Promo entries that failed at any step.",
+	})
+	captchaSolvesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "captcha_solves_total",
+		Help: "Captchas solved by the provider.",
+	})
+	captchaErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "captcha_errors_total",
+		Help: "Captcha solves that failed or timed out.",
+	})
+	captchaSolveSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "captcha_solve_seconds",
+		Help:    "Time from submitting a captcha task to receiving the token.",
+		Buckets: []float64{5, 10, 15, 20, 30, 45, 60, 90, 120},
+	})
+	captchaBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "captcha_breaker_state",
+		Help: "State of the captcha provider circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+)
+
+// metricsRegistry holds only the Promogen metrics, without the Go runtime
+// collectors of the default registry.
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(submissionsTotal, submissionsFailed, captchaSolvesTotal, captchaErrorsTotal, captchaSolveSeconds, captchaBreakerState)
+}
+
+// observeSubmission records the outcome of one submitEntry call.
+func observeSubmission(err error) {
+	submissionsTotal.Inc()
+	if err != nil {
+		submissionsFailed.Inc()
+	}
+}
+
+// observeCaptchaSolve records one call to the captcha provider.
+func observeCaptchaSolve(d time.Duration, err error) {
+	if err != nil {
+		captchaErrorsTotal.Inc()
+		return
+	}
+	captchaSolvesTotal.Inc()
+	captchaSolveSeconds.Observe(d.Seconds())
+}
+
+// observeBreakerState records a change of the captcha circuit breaker.
+func observeBreakerState(state breakerState) {
+	captchaBreakerState.Set(float64(state))
+}
+
+// startMetricsServer serves /metrics on addr until shutdownMetricsServer is
+// called. Binding errors are returned immediately.
+func startMetricsServer(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorf("Metrics server error: %v\n", err)
+		}
+	}()
+	return server, nil
+}
+
+// shutdownMetricsServer stops server, giving in-flight scrapes a few seconds
+// to finish.
+func shutdownMetricsServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		debugPrint(fmt.Sprintf("Error shutting down metrics server: %v", err))
+	}
+}
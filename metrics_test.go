@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsServer(t *testing.T) {
+	server, err := startMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startMetricsServer returned an error: %v", err)
+	}
+	defer shutdownMetricsServer(server)
+
+	observeSubmission(nil)
+	observeSubmission(errors.New("boom"))
+	observeCaptchaSolve(12*time.Second, nil)
+	observeCaptchaSolve(0, errors.New("timeout"))
+
+	resp, err := http.Get("http://" + server.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("Error fetching metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics: %v", err)
+	}
+
+	for _, name := range []string{"submissions_total", "submissions_failed", "captcha_solves_total", "captcha_errors_total", "captcha_solve_seconds_count"} {
+		if !strings.Contains(string(body), "\n"+name+" ") {
+			t.Errorf("Expected metrics output to include %s, got:\n%s", name, body)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// mockSiteKey is the site key on the mock promo page.
+const mockSiteKey = "mock-site-key"
+
+// Path prefixes of the fake services on the mock server. A config pointed at
+// it sets cloudflare_api_base_url to <addr>/cloudflare, ez_captcha_base_url
+// to <addr>/ezcaptcha and the promo and submit URLs to <addr>/promo and
+// <addr>/submit.
+const (
+	mockCloudflarePrefix = "/cloudflare"
+	mockEZCaptchaPrefix  = "/ezcaptcha"
+)
+
+// newMockHandler returns a fake Cloudflare email routing API, EZ Captcha API
+// and Monster promo site that accept everything, so a whole run can be
+// exercised offline.
+func newMockHandler() http.Handler {
+	var rules, tasks atomic.Int64
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(mockCloudflarePrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/email/routing/rules"):
+			writeJSON(w, map[string]interface{}{
+				"success":     true,
+				"result":      []interface{}{},
+				"result_info": map[string]int{"total_count": 0},
+			})
+		case r.Method == "POST":
+			writeJSON(w, map[string]interface{}{
+				"success": true,
+				"result":  map[string]string{"id": fmt.Sprintf("mock_rule_%d", rules.Add(1))},
+			})
+		default:
+			writeJSON(w, map[string]interface{}{"success": true, "result": nil})
+		}
+	})
+	mux.HandleFunc(mockEZCaptchaPrefix+"/createTask", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"errorId": 0, "taskId": fmt.Sprintf("mock_task_%d", tasks.Add(1))})
+	})
+	mux.HandleFunc(mockEZCaptchaPrefix+"/getTaskResult", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"errorId":  0,
+			"status":   "ready",
+			"solution": map[string]string{"gRecaptchaResponse": "mock-captcha-token", "token": "mock-captcha-token"},
+		})
+	})
+	mux.HandleFunc(mockEZCaptchaPrefix+"/getBalance", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"errorId": 0, "balance": 100})
+	})
+	mux.HandleFunc("/promo", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "__cf_bm", Value: "mock-bot-management"})
+		fmt.Fprintf(w, `<html><body><form><input type="hidden" name="%s" value="mock-csrf-token"><div class="g-recaptcha" data-sitekey="%s"></div></form></body></html>`, defaultCSRFFieldName, mockSiteKey)
+	})
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "cf_clearance", Value: "mock-clearance"})
+		writeJSON(w, map[string]interface{}{"success": true})
+	})
+	return mux
+}
+
+// serveMock serves newMockHandler on addr until interrupted and prints the
+// config settings that point a run at it.
+func serveMock(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %v", addr, err)
+	}
+	base := "http://" + listener.Addr().String()
+	outputf("Serving mock Cloudflare, EZ Captcha and promo endpoints on %s. Use these settings to run against it:\n", base)
+	outputf("  \"cloudflare_api_base_url\": %q,\n", base+mockCloudflarePrefix)
+	outputf("  \"ez_captcha_base_url\": %q,\n", base+mockEZCaptchaPrefix)
+	outputf("  \"monster_promo_url\": %q,\n", base+"/promo")
+	outputf("  \"monster_submit_url\": %q,\n", base+"/submit")
+	outputf("  \"recaptcha_site_key\": %q\n", mockSiteKey)
+
+	server := &http.Server{Handler: newMockHandler()}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
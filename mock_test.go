@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMockServerEndToEnd(t *testing.T) {
+	server := httptest.NewServer(newMockHandler())
+	defer server.Close()
+
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+		knownAliases = nil
+	}()
+	knownAliases = nil
+	config.UseCloudflareEmail = true
+	config.EmailDomain = "test.com"
+	config.ForwardToEmail = "me@example.com"
+	config.CloudflareAPIBaseURL = server.URL + mockCloudflarePrefix
+	config.EZCaptchaBaseURL = server.URL + mockEZCaptchaPrefix
+	config.MonsterPromoURL = server.URL + "/promo"
+	config.MonsterSubmitURL = server.URL + "/submit"
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaSiteKey = mockSiteKey
+	config.CaptchaTimeout = 10
+	config.CaptchaInitialDelay = 0.01
+	config.CaptchaPollInterval = 0.01
+	config.MaxCaptchaRetries = 1
+	captchaSolver = ezCaptchaSolver{}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	if err := checkSiteKey(context.Background(), false); err != nil {
+		t.Errorf("Expected the mock promo page to carry the mock site key, got %v", err)
+	}
+	if balance, err := captchaSolver.Balance(); err != nil || balance != 100 {
+		t.Errorf("Expected a mock balance of 100, got %v: %v", balance, err)
+	}
+	result, err := submitEntry(context.Background(), nextTarget())
+	if err != nil {
+		t.Fatalf("submitEntry against the mock server returned an error: %v", err)
+	}
+	if !result.Success || result.RuleID != "mock_rule_1" {
+		t.Errorf("Expected a successful entry with the mock rule, got %+v", result)
+	}
+}
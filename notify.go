@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// discordMinInterval is the shortest gap between two success notifications.
+// Successes that arrive sooner are not announced.
+const discordMinInterval = 10 * time.Second
+
+// failureAlertThreshold is how many entries in a row must fail before an
+// alert is sent, e.g. because the site key is no longer valid.
+const failureAlertThreshold = 5
+
+var (
+	discordLimiter = newNotifyLimiter(discordMinInterval, time.Now)
+	failures       failureStreak
+)
+
+// notifyLimiter allows at most one message per interval.
+type notifyLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time
+}
+
+func newNotifyLimiter(interval time.Duration, now func() time.Time) *notifyLimiter {
+	return &notifyLimiter{interval: interval, now: now}
+}
+
+// Allow reports whether a message may be sent now and, if so, starts a new
+// interval.
+func (l *notifyLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval {
+		return false
+	}
+	l.last = now
+	return true
+}
+
+// failureStreak counts consecutive failed entries across workers.
+type failureStreak struct {
+	mu sync.Mutex
+	n  int
+}
+
+// record adds one outcome and returns the current number of failures in a
+// row.
+func (s *failureStreak) record(success bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if success {
+		s.n = 0
+	} else {
+		s.n++
+	}
+	return s.n
+}
+
+// notifySubmissionOutcome announces successful entries and alerts once per
+// streak when failureAlertThreshold entries in a row have failed.
+func notifySubmissionOutcome(result SubmissionResult) {
+	if config.DiscordWebhookURL == "" {
+		return
+	}
+
+	streak := failures.record(result.Success)
+	if result.Success {
+		notifyDiscord(fmt.Sprintf("Entry submitted for %s", result.Email))
+		return
+	}
+	if streak == failureAlertThreshold {
+		// Alerts skip the rate limit; they are sent at most once per streak
+		msg := fmt.Sprintf("%d entries in a row have failed, last error: %s", streak, result.Error)
+		if err := postDiscordWebhook(msg); err != nil {
+			errorf("Error sending Discord notification: %v\n", err)
+		}
+	}
+}
+
+// notifyDiscord posts msg to the configured webhook unless another message
+// was sent within discordMinInterval. Failures are reported but not returned.
+func notifyDiscord(msg string) {
+	if config.DiscordWebhookURL == "" {
+		return
+	}
+	if !discordLimiter.Allow() {
+		debugPrint(fmt.Sprintf("Skipping Discord notification, rate limited: %s", msg))
+		return
+	}
+	if err := postDiscordWebhook(msg); err != nil {
+		errorf("Error sending Discord notification: %v\n", err)
+	}
+}
+
+func postDiscordWebhook(msg string) error {
+	jsonData, err := json.Marshal(map[string]string{"content": msg})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	resp, err := httpClient().Post(config.DiscordWebhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		// The webhook URL is itself the secret, so keep it out of the error
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// telegramEnabled reports whether Telegram notifications are configured.
+func telegramEnabled() bool {
+	return config.TelegramBotToken != "" && config.TelegramChatID != ""
+}
+
+// notifyTelegram sends msg to the configured chat through the Bot API.
+// Failures are reported but not returned.
+func notifyTelegram(msg string) {
+	if !telegramEnabled() {
+		return
+	}
+	if err := postTelegramMessage(msg); err != nil {
+		errorf("Error sending Telegram notification: %v\n", err)
+	}
+}
+
+func postTelegramMessage(msg string) error {
+	jsonData, err := json.Marshal(map[string]string{
+		"chat_id": config.TelegramChatID,
+		"text":    msg,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", config.TelegramAPIBaseURL, config.TelegramBotToken)
+	resp, err := httpClient().Post(apiURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		// The request URL contains the bot token, so keep it out of the error
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+var (
+	lowBalanceMu      sync.Mutex
+	lowBalanceAlerted bool
+)
+
+// checkLowBalance alerts once when balance falls below LowBalanceAlert and
+// again only after it has been topped back up.
+func checkLowBalance(balance float64) {
+	if config.LowBalanceAlert <= 0 {
+		return
+	}
+
+	lowBalanceMu.Lock()
+	alert := balance < config.LowBalanceAlert && !lowBalanceAlerted
+	lowBalanceAlerted = balance < config.LowBalanceAlert
+	lowBalanceMu.Unlock()
+
+	if alert {
+		notifyTelegram(fmt.Sprintf("Captcha balance is low: $%.2f (alert threshold $%.2f)", balance, config.LowBalanceAlert))
+	}
+}
+
+// reportProgress sends the success rate and captcha balance to Telegram every
+// TelegramInterval seconds until ctx is cancelled.
+func reportProgress(ctx context.Context, stats *submissionStats) {
+	interval := time.Duration(config.TelegramInterval * float64(time.Second))
+	for sleepContext(ctx, interval) == nil {
+		successCount, totalCount := stats.summary()
+		msg := fmt.Sprintf("Progress: %d/%d entries submitted successfully", successCount, totalCount)
+
+		balance, err := checkCaptchaBalance()
+		if err != nil {
+			debugPrint(fmt.Sprintf("Error checking CAPTCHA balance: %v", err))
+		} else {
+			msg += fmt.Sprintf(", captcha balance: $%.2f", balance)
+		}
+		notifyTelegram(msg)
+		if err == nil {
+			checkLowBalance(balance)
+		}
+	}
+}
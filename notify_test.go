@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyLimiter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := newNotifyLimiter(10*time.Second, func() time.Time { return now })
+
+	if !l.Allow() {
+		t.Fatal("Expected the first message to be allowed")
+	}
+	now = now.Add(5 * time.Second)
+	if l.Allow() {
+		t.Error("Expected a message within the interval to be dropped")
+	}
+	now = now.Add(5 * time.Second)
+	if !l.Allow() {
+		t.Error("Expected a message after the interval to be allowed")
+	}
+}
+
+func TestNotifySubmissionOutcome(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Error decoding webhook payload: %v", err)
+		}
+		messages = append(messages, payload.Content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	oldConfig, oldLimiter := config, discordLimiter
+	config.DiscordWebhookURL = server.URL
+	discordLimiter = newNotifyLimiter(time.Hour, time.Now)
+	failures = failureStreak{}
+	defer func() {
+		config, discordLimiter = oldConfig, oldLimiter
+		failures = failureStreak{}
+	}()
+
+	notifySubmissionOutcome(SubmissionResult{Email: "a@test.com", Success: true})
+	notifySubmissionOutcome(SubmissionResult{Email: "b@test.com", Success: true})
+	for i := 0; i < failureAlertThreshold*2; i++ {
+		notifySubmissionOutcome(SubmissionResult{Email: "c@test.com", Error: "bad site key"})
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected one success and one alert, got %q", messages)
+	}
+	if !strings.Contains(messages[0], "a@test.com") {
+		t.Errorf("Expected the success message to include the email, got %q", messages[0])
+	}
+	if !strings.Contains(messages[1], "bad site key") {
+		t.Errorf("Expected the alert to include the last error, got %q", messages[1])
+	}
+}
+
+func TestNotifyTelegramLowBalance(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest_token/sendMessage" {
+			t.Errorf("Expected request to /bottest_token/sendMessage, got %s", r.URL.Path)
+		}
+		var payload struct {
+			ChatID string `json:"chat_id"`
+			Text   string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Error decoding sendMessage payload: %v", err)
+		}
+		if payload.ChatID != "42" {
+			t.Errorf("Expected chat_id 42, got %q", payload.ChatID)
+		}
+		messages = append(messages, payload.Text)
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	config.TelegramAPIBaseURL = server.URL
+	config.TelegramBotToken = "test_token"
+	config.TelegramChatID = "42"
+	config.LowBalanceAlert = 1
+	lowBalanceAlerted = false
+	defer func() {
+		config = oldConfig
+		lowBalanceAlerted = false
+	}()
+
+	for _, balance := range []float64{5, 0.5, 0.4, 3, 0.2} {
+		checkLowBalance(balance)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected two low balance alerts, got %q", messages)
+	}
+	if !strings.Contains(messages[0], "$0.50") {
+		t.Errorf("Expected the alert to include the balance, got %q", messages[0])
+	}
+}
+
+func TestPostDiscordWebhookHidesURL(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	// Nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	config.DiscordWebhookURL = "http://" + addr + "/api/webhooks/123/secret_webhook_token"
+
+	err = postDiscordWebhook("test")
+	if err == nil {
+		t.Fatal("Expected an error for an unreachable webhook")
+	}
+	if strings.Contains(err.Error(), "secret_webhook_token") || strings.Contains(err.Error(), "/api/webhooks") {
+		t.Errorf("Expected the webhook URL to be left out of the error, got %v", err)
+	}
+}
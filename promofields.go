@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Form fields of the age gate and region selector some promos require.
+const (
+	regionFormField       = "Region"
+	ageConfirmedFormField = "AgeConfirmed"
+)
+
+// promoRegions are the values the region selector accepts.
+var promoRegions = map[string]bool{
+	"US": true, "CA": true, "MX": true, "BR": true,
+	"GB": true, "IE": true, "DE": true, "FR": true, "ES": true, "IT": true, "NL": true, "PL": true,
+	"AU": true, "NZ": true,
+}
+
+// setPromoFields adds the region and age confirmation to an entry's form
+// when they are configured.
+func setPromoFields(data url.Values) {
+	if config.Region != "" {
+		data.Set(regionFormField, config.Region)
+	}
+	if config.AgeConfirmed {
+		data.Set(ageConfirmedFormField, "true")
+	}
+}
+
+// checkPromoFields normalizes Region and returns a description of a problem
+// with it, if any.
+func checkPromoFields() []string {
+	if config.Region == "" {
+		return nil
+	}
+	config.Region = strings.ToUpper(strings.TrimSpace(config.Region))
+	if promoRegions[config.Region] {
+		return nil
+	}
+	regions := make([]string, 0, len(promoRegions))
+	for region := range promoRegions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return []string{fmt.Sprintf("Unsupported region %q (expected one of %s)", config.Region, strings.Join(regions, ", "))}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckPromoFields(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config.Region = " gb "
+	if errs := checkPromoFields(); len(errs) != 0 || config.Region != "GB" {
+		t.Errorf("Expected region GB to be accepted, got %q / %q", config.Region, errs)
+	}
+	config.Region = "Atlantis"
+	if errs := checkPromoFields(); len(errs) != 1 {
+		t.Errorf("Expected an error for an unknown region, got %q", errs)
+	}
+	config.Region = ""
+	if errs := checkPromoFields(); len(errs) != 0 {
+		t.Errorf("Expected no region to be accepted, got %q", errs)
+	}
+}
+
+func TestSubmitPromoEntrySendsPromoFields(t *testing.T) {
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		forms = append(forms, r.PostForm)
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ExtraFormFields = map[string]string{regionFormField: "XX"}
+	config.Region = "US"
+	config.AgeConfirmed = true
+
+	session := &promoSession{target: Target{SubmitURL: server.URL}, userAgent: "test-agent"}
+	for i := 0; i < 2; i++ {
+		if _, err := submitPromoEntry(context.Background(), session, "a@test.com", "token"); err != nil {
+			t.Fatalf("submitPromoEntry returned an error: %v", err)
+		}
+	}
+	for i, form := range forms {
+		if form.Get(regionFormField) != "US" || form.Get(ageConfirmedFormField) != "true" {
+			t.Errorf("POST %d: expected the region and age confirmation, got %v", i+1, form)
+		}
+	}
+}
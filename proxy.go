@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxies is the pool loaded from ProxyList, or nil when the single proxy
+// from the config file should be used.
+var proxies *proxyPool
+
+// proxyPool hands out proxies round-robin and skips the ones that recently
+// failed to connect. Proxies handed out by Lease are held by one entry at a
+// time.
+type proxyPool struct {
+	mu      sync.Mutex
+	addrs   []string
+	next    int
+	calls   int
+	deadFor int
+	dead    map[string]int
+	leased  map[string]bool
+
+	// deadAt holds when each proxy in dead was marked, for the state file
+	deadAt map[string]time.Time
+	// deadUntil holds when the proxies reloaded from the state file are
+	// re-admitted, in place of their call count in dead
+	deadUntil map[string]time.Time
+	// stateFile is where the dead-list is saved, or "" to keep it in memory
+	stateFile string
+
+	// released is closed and replaced whenever a lease ends, waking every
+	// Lease call waiting for a free proxy
+	released chan struct{}
+}
+
+func newProxyPool(addrs []string, deadFor int) *proxyPool {
+	return &proxyPool{
+		addrs:     addrs,
+		deadFor:   deadFor,
+		dead:      make(map[string]int),
+		deadAt:    make(map[string]time.Time),
+		deadUntil: make(map[string]time.Time),
+		leased:    make(map[string]bool),
+		released:  make(chan struct{}),
+	}
+}
+
+// loadProxyPool reads one user:pass@host:port entry per line from path.
+// Blank lines and lines starting with # are ignored.
+func loadProxyPool(path string, deadFor int) (*proxyPool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addrs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading proxy list: %v", err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("proxy list %s is empty", path)
+	}
+
+	return newProxyPool(addrs, deadFor), nil
+}
+
+// Len returns the number of proxies in the pool, dead or alive.
+func (p *proxyPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.addrs)
+}
+
+// Addrs returns every proxy in the pool, dead or alive.
+func (p *proxyPool) Addrs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.addrs...)
+}
+
+// Next returns the next proxy that is not currently marked dead.
+func (p *proxyPool) Next() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	for i := 0; i < len(p.addrs); i++ {
+		addr := p.addrs[p.next]
+		p.next = (p.next + 1) % len(p.addrs)
+
+		if p.stillDead(addr) {
+			continue
+		}
+		return addr, nil
+	}
+
+	return "", fmt.Errorf("all %d proxies are marked dead", len(p.addrs))
+}
+
+// Lease returns the next live proxy that no other entry holds and holds it
+// until Release. When every live proxy is leased it waits for one to be
+// released or for ctx to be cancelled.
+func (p *proxyPool) Lease(ctx context.Context) (string, error) {
+	for {
+		p.mu.Lock()
+		p.calls++
+		busy := false
+		for i := 0; i < len(p.addrs); i++ {
+			addr := p.addrs[p.next]
+			p.next = (p.next + 1) % len(p.addrs)
+
+			if p.stillDead(addr) {
+				continue
+			}
+			if p.leased[addr] {
+				busy = true
+				continue
+			}
+			p.leased[addr] = true
+			p.mu.Unlock()
+			return addr, nil
+		}
+		released := p.released
+		p.mu.Unlock()
+
+		if !busy {
+			return "", fmt.Errorf("all %d proxies are marked dead", len(p.addrs))
+		}
+		debugPrint("Every live proxy is leased, waiting for one to be released")
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Release ends the lease on addr taken by Lease.
+func (p *proxyPool) Release(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.leased[addr] {
+		return
+	}
+	delete(p.leased, addr)
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// MarkDead skips addr for the next deadFor calls to Next.
+func (p *proxyPool) MarkDead(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dead[addr] = p.calls + p.deadFor
+	p.deadAt[addr] = time.Now()
+	delete(p.deadUntil, addr)
+	if err := p.saveState(); err != nil {
+		errorf("Error saving proxy state: %v\n", err)
+	}
+}
+
+// stillDead reports whether addr is still marked dead, re-admitting it once
+// its time as dead is up. The caller must hold p.mu.
+func (p *proxyPool) stillDead(addr string) bool {
+	until, ok := p.dead[addr]
+	if !ok {
+		return false
+	}
+	if expires, ok := p.deadUntil[addr]; ok {
+		if time.Now().Before(expires) {
+			return true
+		}
+	} else if p.calls <= until {
+		return true
+	}
+	p.revive(addr)
+	return false
+}
+
+// revive re-admits addr. The caller must hold p.mu.
+func (p *proxyPool) revive(addr string) {
+	delete(p.dead, addr)
+	delete(p.deadAt, addr)
+	delete(p.deadUntil, addr)
+	if err := p.saveState(); err != nil {
+		errorf("Error saving proxy state: %v\n", err)
+	}
+}
+
+// nextProxyAddr returns the proxy to use for the next request, either from
+// the pool or built from the single proxy fields in the config file.
+func nextProxyAddr() (string, error) {
+	if proxies != nil {
+		return proxies.Next()
+	}
+	if config.ProxyUsername == "" {
+		return fmt.Sprintf("%s:%s", config.ProxyDNS, config.ProxyPort), nil
+	}
+	return fmt.Sprintf("%s:%s@%s:%s", config.ProxyUsername, config.ProxyPassword, config.ProxyDNS, config.ProxyPort), nil
+}
+
+// leaseProxyAddr returns the proxy for one entry along with the function
+// that gives it back. Pool proxies are leased so no two entries share an exit
+// IP at the same time; the single proxy from the config file is shared.
+func leaseProxyAddr(ctx context.Context) (string, func(), error) {
+	if proxies == nil {
+		addr, err := nextProxyAddr()
+		return addr, func() {}, err
+	}
+	addr, err := proxies.Lease(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	var once sync.Once
+	return addr, func() { once.Do(func() { proxies.Release(addr) }) }, nil
+}
+
+// proxyHost strips the credentials from a user:pass@host:port proxy address
+// so it can be logged.
+func proxyHost(proxyAddr string) string {
+	if i := strings.LastIndex(proxyAddr, "@"); i >= 0 {
+		return proxyAddr[i+1:]
+	}
+	return proxyAddr
+}
+
+// httpTimeout returns the configured per-request timeout.
+func httpTimeout() time.Duration {
+	return time.Duration(config.HTTPTimeout * float64(time.Second))
+}
+
+// Connection pool limits for every transport. Workers hit the same few hosts,
+// so each host may keep enough idle connections for all of them.
+const (
+	maxIdleConns        = 100
+	maxIdleConnsPerHost = 16
+	idleConnTimeout     = 90 * time.Second
+)
+
+// sharedHTTPClient is the direct client shared by every request that does not
+// go through a proxy. main sets it once the config is loaded; tests may
+// replace it, e.g. with an httptest.Server's client.
+var sharedHTTPClient *http.Client
+
+// httpClient returns sharedHTTPClient, or a new direct client when it is not
+// set.
+func httpClient() *http.Client {
+	if sharedHTTPClient != nil {
+		return sharedHTTPClient
+	}
+	return newHTTPClient()
+}
+
+var (
+	directTransportOnce sync.Once
+	directTransport     *http.Transport
+)
+
+// newHTTPClient returns a direct client for the Cloudflare and captcha APIs.
+// All direct clients share one transport, which negotiates HTTP/2 and keeps
+// connections alive between requests.
+func newHTTPClient() *http.Client {
+	directTransportOnce.Do(func() {
+		directTransport = tuneTransport(http.DefaultTransport.(*http.Transport).Clone())
+		directTransport.ForceAttemptHTTP2 = true
+	})
+	return &http.Client{Transport: dumpingTransport(directTransport), Timeout: httpTimeout()}
+}
+
+func tuneTransport(t *http.Transport) *http.Transport {
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	t.IdleConnTimeout = idleConnTimeout
+	return t
+}
+
+var (
+	proxyTransportsMu sync.Mutex
+	// proxyTransports keeps one transport per proxy so connections through
+	// it are reused by later submissions
+	proxyTransports = make(map[string]*http.Transport)
+)
+
+// newPromoHTTPClient returns the client used for promo submissions, routed
+// through proxyAddr (user:pass@host:port) when it is not empty. With SpoofTLS
+// the handshake mimics Chrome. Clients for the same proxy share a transport.
+func newPromoHTTPClient(proxyAddr string) (*http.Client, error) {
+	if proxyAddr == "" && !config.SpoofTLS {
+		return httpClient(), nil
+	}
+
+	key := fmt.Sprintf("%s|%t|%t|%s", config.ProxyScheme, config.SpoofTLS, config.ProxyAuthHeader, proxyAddr)
+	proxyTransportsMu.Lock()
+	defer proxyTransportsMu.Unlock()
+
+	transport, ok := proxyTransports[key]
+	if !ok {
+		var err error
+		transport, err = newProxyTransport(proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		proxyTransports[key] = tuneTransport(transport)
+	}
+	return &http.Client{Transport: dumpingTransport(transport), Timeout: httpTimeout()}, nil
+}
+
+// newProxyTransport returns a transport that sends requests through
+// proxyAddr, or directly with a spoofed handshake when it is empty.
+func newProxyTransport(proxyAddr string) (*http.Transport, error) {
+	var proxyURL *url.URL
+	if proxyAddr != "" {
+		var err error
+		proxyURL, err = url.Parse(fmt.Sprintf("%s://%s", config.ProxyScheme, proxyAddr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy URL: %v", err)
+		}
+		// Otherwise the transport sends Proxy-Authorization: Basic Og==
+		if !hasProxyAuth(proxyURL) {
+			proxyURL.User = nil
+		}
+	}
+
+	if config.SpoofTLS {
+		return newSpoofedTLSTransport(proxyURL)
+	}
+
+	if config.ProxyScheme == "socks5" {
+		var auth *proxy.Auth
+		if hasProxyAuth(proxyURL) {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+		}
+
+		return &http.Transport{DialContext: contextDialer.DialContext}, nil
+	}
+
+	transport := &http.Transport{}
+	if config.ProxyAuthHeader && hasProxyAuth(proxyURL) {
+		// Sent with every CONNECT instead, so the proxy URL the transport
+		// holds has no credentials to leak
+		transport.ProxyConnectHeader = http.Header{"Proxy-Authorization": {basicProxyAuth(proxyURL.User)}}
+		proxyURL.User = nil
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport, nil
+}
+
+// hasProxyAuth reports whether proxyURL carries credentials to send. An
+// empty username, as in :@host:port, means the proxy needs none.
+func hasProxyAuth(proxyURL *url.URL) bool {
+	return proxyURL != nil && proxyURL.User != nil && proxyURL.User.Username() != ""
+}
+
+// basicProxyAuth returns the Proxy-Authorization value for user.
+func basicProxyAuth(user *url.Userinfo) string {
+	password, _ := user.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password))
+}
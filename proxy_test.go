@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolRoundRobin(t *testing.T) {
+	pool := newProxyPool([]string{"a:1", "b:2", "c:3"}, 2)
+
+	for _, want := range []string{"a:1", "b:2", "c:3", "a:1"} {
+		got, err := pool.Next()
+		if err != nil {
+			t.Fatalf("Next returned an error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestProxyPoolMarkDead(t *testing.T) {
+	pool := newProxyPool([]string{"a:1", "b:2"}, 2)
+	pool.MarkDead("a:1")
+
+	// a:1 is skipped for the next two calls, then re-admitted
+	for _, want := range []string{"b:2", "b:2", "a:1"} {
+		got, err := pool.Next()
+		if err != nil {
+			t.Fatalf("Next returned an error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+
+	pool.MarkDead("a:1")
+	pool.MarkDead("b:2")
+	if _, err := pool.Next(); err == nil {
+		t.Error("Expected an error when every proxy is dead")
+	}
+}
+
+func TestProxyPoolLease(t *testing.T) {
+	pool := newProxyPool([]string{"a:1", "b:2"}, 2)
+	ctx := context.Background()
+
+	first, err := pool.Lease(ctx)
+	if err != nil {
+		t.Fatalf("Lease returned an error: %v", err)
+	}
+	second, err := pool.Lease(ctx)
+	if err != nil {
+		t.Fatalf("Lease returned an error: %v", err)
+	}
+	if first == second {
+		t.Fatalf("Expected two different proxies, got %s twice", first)
+	}
+
+	// Both are leased, so the next Lease waits for a release
+	leased := make(chan string)
+	go func() {
+		addr, _ := pool.Lease(ctx)
+		leased <- addr
+	}()
+	select {
+	case addr := <-leased:
+		t.Fatalf("Expected Lease to wait, got %s", addr)
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.Release(second)
+	select {
+	case addr := <-leased:
+		if addr != second {
+			t.Errorf("Expected the released proxy %s, got %s", second, addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Lease to return once a proxy was released")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := pool.Lease(cancelled); err != context.Canceled {
+		t.Errorf("Expected a cancelled wait to return context.Canceled, got %v", err)
+	}
+
+	pool.Release(first)
+	pool.Release(second)
+	pool.MarkDead("a:1")
+	pool.MarkDead("b:2")
+	if _, err := pool.Lease(ctx); err == nil {
+		t.Error("Expected an error when every proxy is dead")
+	}
+}
+
+func TestLoadProxyPool(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "proxies.*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.WriteString("# residential\nuser:pass@1.2.3.4:8080\n\nuser:pass@5.6.7.8:8080\n"); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	pool, err := loadProxyPool(tmpfile.Name(), 5)
+	if err != nil {
+		t.Fatalf("loadProxyPool returned an error: %v", err)
+	}
+	if pool.Len() != 2 {
+		t.Errorf("Expected 2 proxies, got %d", pool.Len())
+	}
+}
+
+func TestNewPromoHTTPClientProxySchemes(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	for _, scheme := range []string{"http", "https"} {
+		config.ProxyScheme = scheme
+		client, err := newPromoHTTPClient("user:pass@127.0.0.1:1080")
+		if err != nil {
+			t.Fatalf("newPromoHTTPClient(%s) returned an error: %v", scheme, err)
+		}
+		transport := client.Transport.(*http.Transport)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		proxyURL, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy func returned an error: %v", err)
+		}
+		if proxyURL.Scheme != scheme || proxyURL.Host != "127.0.0.1:1080" {
+			t.Errorf("Expected %s://127.0.0.1:1080, got %s", scheme, proxyURL)
+		}
+	}
+
+	config.ProxyScheme = "socks5"
+	client, err := newPromoHTTPClient("user:pass@127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("newPromoHTTPClient(socks5) returned an error: %v", err)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.Proxy != nil || transport.DialContext == nil {
+		t.Error("Expected SOCKS5 transport to use a custom dialer and no HTTP proxy")
+	}
+}
+
+func TestProxyAuthHeader(t *testing.T) {
+	var connectAuth string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			connectAuth = r.Header.Get("Proxy-Authorization")
+		}
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer proxyServer.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ProxyScheme = "http"
+	config.ProxyAuthHeader = true
+
+	proxyAddr := "user:pass@" + strings.TrimPrefix(proxyServer.URL, "http://")
+	client, err := newPromoHTTPClient(proxyAddr)
+	if err != nil {
+		t.Fatalf("newPromoHTTPClient returned an error: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxyURL.User != nil {
+		t.Errorf("Expected a proxy URL without credentials, got %v / %v", proxyURL, err)
+	}
+
+	client.Get("https://example.com")
+	if connectAuth != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected the credentials in the CONNECT header, got %q", connectAuth)
+	}
+}
+
+func TestProxyHost(t *testing.T) {
+	if got := proxyHost("user:p@ss@1.2.3.4:8080"); got != "1.2.3.4:8080" {
+		t.Errorf("Expected credentials to be stripped, got %s", got)
+	}
+	if got := proxyHost("1.2.3.4:8080"); got != "1.2.3.4:8080" {
+		t.Errorf("Expected address to be unchanged, got %s", got)
+	}
+}
+
+func TestSharedHTTPClientIsInjectable(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/getBalance" {
+			w.Write([]byte(`{"errorId":0,"balance":4.2}`))
+			return
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	oldConfig, oldClient := config, sharedHTTPClient
+	defer func() { config, sharedHTTPClient = oldConfig, oldClient }()
+	// The test server's certificate is only trusted by its own client
+	sharedHTTPClient = server.Client()
+	config.EZCaptchaBaseURL = server.URL
+
+	if _, err := submitPromoEntry(context.Background(), &promoSession{target: Target{SubmitURL: server.URL + "/submit"}, userAgent: "test-agent"}, "a@test.com", "token"); err != nil {
+		t.Fatalf("submitPromoEntry returned an error: %v", err)
+	}
+	balance, err := ezCaptchaSolver{}.Balance()
+	if err != nil || balance != 4.2 {
+		t.Fatalf("Expected a balance of 4.2, got %v: %v", balance, err)
+	}
+	if len(paths) != 2 || paths[0] != "/submit" || paths[1] != "/getBalance" {
+		t.Errorf("Expected both requests to reach the test server, got %v", paths)
+	}
+}
+
+func BenchmarkSubmitPromoEntryThroughProxy(b *testing.B) {
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+	// A plain HTTP target is fetched through the proxy with an absolute URL,
+	// so the test server doubles as the proxy
+	proxyAddr := "user:pass@" + promo.Listener.Addr().String()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ProxyScheme = "http"
+	config.HTTPTimeout = 30
+
+	session := &promoSession{target: Target{SubmitURL: "http://promo.test/submit"}, proxyAddr: proxyAddr, userAgent: "bench"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := submitPromoEntry(context.Background(), session, "a@test.com", "token"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestProxyWithoutCredentials(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ProxyDNS = "10.0.0.1"
+	config.ProxyPort = "8080"
+	if addr, _ := nextProxyAddr(); addr != "10.0.0.1:8080" {
+		t.Errorf("Expected no userinfo without a proxy username, got %q", addr)
+	}
+
+	// An empty username sends no credentials, whatever the scheme or option
+	var connectAuth []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connectAuth = append(connectAuth, r.Header.Get("Proxy-Authorization"))
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer proxyServer.Close()
+	proxyAddr := ":@" + strings.TrimPrefix(proxyServer.URL, "http://")
+	config.ProxyScheme = "http"
+	for _, authHeader := range []bool{false, true} {
+		config.ProxyAuthHeader = authHeader
+		client, err := newPromoHTTPClient(proxyAddr)
+		if err != nil {
+			t.Fatalf("newPromoHTTPClient returned an error: %v", err)
+		}
+		client.Get("https://example.com")
+	}
+	if len(connectAuth) != 2 || connectAuth[0] != "" || connectAuth[1] != "" {
+		t.Errorf("Expected no Proxy-Authorization for an empty username, got %q", connectAuth)
+	}
+
+	// A SOCKS5 greeting offers only the no-auth method
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	greetings := make(chan []byte, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			greeting := make([]byte, 3)
+			n, _ := io.ReadAtLeast(conn, greeting, 2)
+			greetings <- greeting[:n]
+			conn.Close()
+		}
+	}()
+	config.ProxyScheme = "socks5"
+	for _, spoofTLS := range []bool{false, true} {
+		config.SpoofTLS = spoofTLS
+		client, err := newPromoHTTPClient(":@" + listener.Addr().String())
+		if err != nil {
+			t.Fatalf("newPromoHTTPClient returned an error: %v", err)
+		}
+		client.Get("https://example.com")
+		if greeting := <-greetings; !bytes.Equal(greeting, []byte{5, 1, 0}) {
+			t.Errorf("Expected a no-auth SOCKS5 greeting with spoof_tls %v, got %v", spoofTLS, greeting)
+		}
+	}
+}
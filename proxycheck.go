@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyCheckTimeout bounds each startup proxy check, so a dead proxy is
+// reported quickly instead of after the full HTTP timeout.
+const proxyCheckTimeout = 10 * time.Second
+
+// proxyCheckWorkers is how many proxies from a pool are checked at once.
+const proxyCheckWorkers = 10
+
+// checkProxy fetches ProxyCheckURL through proxyAddr and returns the exit IP
+// that the IP-echo service reports.
+func checkProxy(ctx context.Context, proxyAddr string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, proxyCheckTimeout)
+	defer cancel()
+
+	client, err := newPromoHTTPClient(proxyAddr)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", config.ProxyCheckURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("proxy %s is unreachable: %v", proxyHost(proxyAddr), err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", fmt.Errorf("error reading response from %s: %v", config.ProxyCheckURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned status code %d through proxy %s", config.ProxyCheckURL, resp.StatusCode, proxyHost(proxyAddr))
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s returned %q instead of an IP address", config.ProxyCheckURL, ip)
+	}
+	return ip, nil
+}
+
+// checkProxies checks the configured proxy, or every proxy in the pool, and
+// prints the exit IPs. Pool proxies that fail are marked dead; an error is
+// only returned when no proxy works.
+func checkProxies(ctx context.Context) error {
+	if proxies == nil {
+		proxyAddr, err := nextProxyAddr()
+		if err != nil {
+			return err
+		}
+		ip, err := checkProxy(ctx, proxyAddr)
+		if err != nil {
+			return err
+		}
+		outputf("Proxy %s exit IP: %s\n", proxyHost(proxyAddr), ip)
+		return nil
+	}
+
+	addrs := proxies.Addrs()
+	ips := make([]string, len(addrs))
+	errs := make([]error, len(addrs))
+	slots := make(chan struct{}, proxyCheckWorkers)
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, addr string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			ips[i], errs[i] = checkProxy(ctx, addr)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	alive := 0
+	distinct := make(map[string]bool)
+	for i, addr := range addrs {
+		if errs[i] != nil {
+			errorf("Proxy check failed: %v\n", errs[i])
+			proxies.MarkDead(addr)
+			continue
+		}
+		debugPrint(fmt.Sprintf("Proxy %s exit IP: %s", proxyHost(addr), ips[i]))
+		alive++
+		distinct[ips[i]] = true
+	}
+	if alive == 0 {
+		return fmt.Errorf("none of the %d proxies could reach %s", len(addrs), config.ProxyCheckURL)
+	}
+	outputf("%d/%d proxies are working, with %d distinct exit IPs\n", alive, len(addrs), len(distinct))
+	return nil
+}
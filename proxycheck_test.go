@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newEchoProxy returns an HTTP proxy that answers every plain HTTP request
+// itself with ip, like an IP-echo service seen through the proxy.
+func newEchoProxy(t *testing.T, ip string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			t.Errorf("Expected a proxied request with an absolute URL, got %s", r.URL)
+		}
+		w.Write([]byte(ip + "\n"))
+	}))
+	t.Cleanup(server.Close)
+	return "user:pass@" + server.Listener.Addr().String()
+}
+
+func TestCheckProxy(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.ProxyScheme = "http"
+	config.ProxyCheckURL = "http://ip.test/"
+
+	ip, err := checkProxy(context.Background(), newEchoProxy(t, "203.0.113.7"))
+	if err != nil || ip != "203.0.113.7" {
+		t.Errorf("Expected exit IP 203.0.113.7, got %q: %v", ip, err)
+	}
+
+	if _, err := checkProxy(context.Background(), newEchoProxy(t, "<html>blocked</html>")); err == nil {
+		t.Error("Expected an error for a response that is not an IP")
+	}
+
+	_, err = checkProxy(context.Background(), "user:secret@127.0.0.1:1")
+	if err == nil || !strings.Contains(err.Error(), "unreachable") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an unreachable error without the password, got %v", err)
+	}
+}
+
+func TestCheckProxiesPool(t *testing.T) {
+	oldConfig, oldProxies := config, proxies
+	defer func() { config, proxies = oldConfig, oldProxies }()
+	config.ProxyScheme = "http"
+	config.ProxyCheckURL = "http://ip.test/"
+
+	dead := "user:pass@127.0.0.1:1"
+	proxies = newProxyPool([]string{newEchoProxy(t, "203.0.113.7"), dead, newEchoProxy(t, "203.0.113.8")}, 10)
+	if err := checkProxies(context.Background()); err != nil {
+		t.Fatalf("checkProxies returned an error: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		addr, _ := proxies.Next()
+		if addr == dead {
+			t.Fatal("Expected the dead proxy to be skipped")
+		}
+	}
+
+	proxies = newProxyPool([]string{dead}, 10)
+	if err := checkProxies(context.Background()); err == nil {
+		t.Error("Expected an error when no proxy works")
+	}
+}
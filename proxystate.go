@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// proxyState is the ProxyStateFile layout: when each dead proxy was marked
+// dead, keyed by host:port so no credentials are written to disk.
+type proxyState struct {
+	Dead map[string]time.Time `json:"dead"`
+}
+
+// loadState marks the proxies listed dead in the state file at path dead
+// again until ttl after they were marked, and saves every later change of
+// the dead-list there. A missing file is an empty dead-list. The file itself
+// is left alone, so commands that exit right away do not rewrite it.
+func (p *proxyPool) loadState(path string, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stateFile = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state proxyState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("error parsing proxy state file: %v", err)
+	}
+
+	for _, addr := range p.addrs {
+		markedAt, ok := state.Dead[proxyHost(addr)]
+		if !ok || time.Since(markedAt) >= ttl {
+			continue
+		}
+		p.dead[addr] = p.calls
+		p.deadAt[addr] = markedAt
+		p.deadUntil[addr] = markedAt.Add(ttl)
+	}
+	return nil
+}
+
+// DeadCount returns the number of proxies currently marked dead.
+func (p *proxyPool) DeadCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.dead)
+}
+
+// saveState writes the dead-list to the state file, if there is one. The
+// caller must hold p.mu.
+func (p *proxyPool) saveState() error {
+	if p.stateFile == "" {
+		return nil
+	}
+	state := proxyState{Dead: make(map[string]time.Time, len(p.deadAt))}
+	for addr, markedAt := range p.deadAt {
+		state.Dead[proxyHost(addr)] = markedAt
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written aside and renamed so a crash never leaves half a file
+	tmp := p.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.stateFile)
+}
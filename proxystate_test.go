@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy_state.json")
+	addrs := []string{"u:p@1.1.1.1:80", "u:p@2.2.2.2:80", "u:p@3.3.3.3:80"}
+
+	pool := newProxyPool(addrs, 10)
+	if err := pool.loadState(path, time.Hour); err != nil {
+		t.Fatalf("loadState with no file returned an error: %v", err)
+	}
+	pool.MarkDead("u:p@2.2.2.2:80")
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "u:p@") {
+		t.Errorf("Expected no proxy credentials in the state file, got %s", data)
+	}
+
+	// A new pool skips the proxy marked dead by the last one
+	restarted := newProxyPool(addrs, 10)
+	if err := restarted.loadState(path, time.Hour); err != nil {
+		t.Fatalf("loadState returned an error: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if addr, _ := restarted.Next(); addr == "u:p@2.2.2.2:80" {
+			t.Fatalf("Expected the dead proxy to be skipped after a restart")
+		}
+	}
+}
+
+func TestProxyPoolStateExpires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy_state.json")
+	data, _ := json.Marshal(proxyState{Dead: map[string]time.Time{
+		"1.1.1.1:80": time.Now().Add(-2 * time.Hour),
+		"2.2.2.2:80": time.Now().Add(-time.Minute),
+	}})
+	os.WriteFile(path, data, 0644)
+
+	pool := newProxyPool([]string{"u:p@1.1.1.1:80", "u:p@2.2.2.2:80"}, 10)
+	if err := pool.loadState(path, time.Hour); err != nil {
+		t.Fatalf("loadState returned an error: %v", err)
+	}
+	if pool.DeadCount() != 1 {
+		t.Errorf("Expected only the recently dead proxy to stay dead, got %d", pool.DeadCount())
+	}
+
+	// Loading leaves the file alone, the next change drops the expired entry
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Errorf("Expected loadState not to rewrite the state file, got %s", after)
+	}
+	pool.MarkDead("u:p@2.2.2.2:80")
+	var state proxyState
+	data, _ = os.ReadFile(path)
+	json.Unmarshal(data, &state)
+	if _, ok := state.Dead["1.1.1.1:80"]; ok || len(state.Dead) != 1 {
+		t.Errorf("Expected the state file to only list 2.2.2.2:80, got %v", state.Dead)
+	}
+}
+
+func TestProxyPoolStateNearlyExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy_state.json")
+	data, _ := json.Marshal(proxyState{Dead: map[string]time.Time{
+		"1.1.1.1:80": time.Now().Add(-time.Hour + 50*time.Millisecond),
+	}})
+	os.WriteFile(path, data, 0644)
+
+	// Re-admitted when the rest of its TTL runs out, not after proxy_dead_skip calls
+	pool := newProxyPool([]string{"u:p@1.1.1.1:80", "u:p@2.2.2.2:80"}, 1000)
+	if err := pool.loadState(path, time.Hour); err != nil {
+		t.Fatalf("loadState returned an error: %v", err)
+	}
+	if addr, _ := pool.Next(); addr != "u:p@2.2.2.2:80" {
+		t.Fatalf("Expected the nearly expired proxy to still be skipped, got %s", addr)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if addr, _ := pool.Next(); addr != "u:p@1.1.1.1:80" || pool.DeadCount() != 0 {
+		t.Errorf("Expected the proxy to be re-admitted once its TTL is up, got %s with %d dead", addr, pool.DeadCount())
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"sync"
+)
+
+// randomSource is the randomness behind alias generation and the selection
+// helpers: User-Agents, submission delays and captcha poll jitter. Aliases
+// read their bytes through Read, the helpers use Intn and Int63n.
+type randomSource interface {
+	io.Reader
+	Intn(n int) int
+	Int63n(n int64) int64
+}
+
+// random is the source every helper draws from. It is replaced by a seeded
+// one when RandSeed is set, and by tests that assert exact outputs.
+var random randomSource = defaultRandom{}
+
+// newRandomSource returns a reproducible source for a non-zero seed, and the
+// default source otherwise.
+func newRandomSource(seed int64) randomSource {
+	if seed == 0 {
+		return defaultRandom{}
+	}
+	return &seededRandom{r: mathrand.New(mathrand.NewSource(seed))}
+}
+
+// defaultRandom keeps aliases on crypto/rand, so they cannot be guessed, and
+// the selection helpers on the global math/rand source.
+type defaultRandom struct{}
+
+func (defaultRandom) Read(p []byte) (int, error) { return cryptorand.Read(p) }
+
+func (defaultRandom) Intn(n int) int { return mathrand.Intn(n) }
+
+func (defaultRandom) Int63n(n int64) int64 { return mathrand.Int63n(n) }
+
+// seededRandom draws everything from one seeded math/rand source. A run with
+// concurrency 1 then makes the same choices in the same order every time;
+// with more workers the order they draw in still varies.
+type seededRandom struct {
+	mu sync.Mutex
+	r  *mathrand.Rand
+}
+
+func (s *seededRandom) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
+func (s *seededRandom) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Intn(n)
+}
+
+func (s *seededRandom) Int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63n(n)
+}
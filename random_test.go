@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeededRandomIsReproducible(t *testing.T) {
+	oldConfig, oldRandom := config, random
+	defer func() { config, random = oldConfig, oldRandom }()
+	config.AliasPattern = aliasPatternWordDigits
+	config.UserAgents = []string{"a", "b", "c", "d"}
+	delay := delayRange{min: time.Second, max: 10 * time.Second}
+
+	draw := func(seed int64) []string {
+		random = newRandomSource(seed)
+		var out []string
+		for i := 0; i < 5; i++ {
+			alias, err := generateAlias()
+			if err != nil {
+				t.Fatalf("generateAlias returned an error: %v", err)
+			}
+			out = append(out, alias, randomUserAgent(), delay.next().String())
+		}
+		return out
+	}
+
+	first, second, other := draw(42), draw(42), draw(43)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same seed to repeat its draws, got %q and %q", first, second)
+		}
+	}
+	same := true
+	for i := range first {
+		same = same && first[i] == other[i]
+	}
+	if same {
+		t.Errorf("Expected another seed to draw differently, got %q twice", first)
+	}
+}
+
+func TestNewRandomSourceDefault(t *testing.T) {
+	if _, ok := newRandomSource(0).(defaultRandom); !ok {
+		t.Error("Expected seed 0 to keep the default crypto/rand source")
+	}
+}
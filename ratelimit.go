@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// submissionLimiter caps submissions across every worker to
+// SubmissionsPerMinute. Nil means no limit.
+var submissionLimiter *rate.Limiter
+
+// newSubmissionLimiter returns a limiter that allows perMinute submissions a
+// minute, spaced out evenly, or nil when perMinute is 0.
+func newSubmissionLimiter(perMinute float64) *rate.Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	// A burst of 1 spreads the submissions evenly instead of letting idle
+	// workers save up tokens and start together
+	return rate.NewLimiter(rate.Every(time.Duration(float64(time.Minute)/perMinute)), 1)
+}
+
+// waitSubmissionLimit blocks until submissionLimiter allows another
+// submission. It returns early with an error once ctx is cancelled.
+func waitSubmissionLimit(ctx context.Context) error {
+	if submissionLimiter == nil {
+		return nil
+	}
+	return submissionLimiter.Wait(ctx)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitSubmissionLimit(t *testing.T) {
+	oldLimiter := submissionLimiter
+	defer func() { submissionLimiter = oldLimiter }()
+
+	submissionLimiter = nil
+	if err := waitSubmissionLimit(context.Background()); err != nil {
+		t.Fatalf("Expected no limit without a limiter, got %v", err)
+	}
+	if newSubmissionLimiter(0) != nil {
+		t.Error("Expected no limiter for 0 submissions per minute")
+	}
+
+	// 1200 a minute is one every 50ms
+	submissionLimiter = newSubmissionLimiter(1200)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := waitSubmissionLimit(context.Background()); err != nil {
+			t.Fatalf("waitSubmissionLimit returned an error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected 3 submissions to take at least 100ms, took %v", elapsed)
+	}
+
+	// A blocked wait ends as soon as ctx is cancelled
+	submissionLimiter = newSubmissionLimiter(1)
+	submissionLimiter.Allow()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start = time.Now()
+	if err := waitSubmissionLimit(ctx); err == nil {
+		t.Error("Expected an error once ctx is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to end with ctx, took %v", elapsed)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// loadReplayEmails returns the addresses whose latest row in the CSV results
+// file at path is a failure, in the order they first appear. Rows without an
+// email failed before an alias existed and have nothing to reuse.
+func loadReplayEmails(path string) (*emailList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Rows of older versions have fewer columns than the header
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading results file: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("results file is empty")
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	emailColumn, ok := columns["email"]
+	successColumn, ok2 := columns["success"]
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("results file has no email and success columns")
+	}
+
+	var order []string
+	failed := make(map[string]bool)
+	for n, row := range rows[1:] {
+		if len(row) <= emailColumn || len(row) <= successColumn {
+			return nil, fmt.Errorf("line %d: expected at least %d fields, got %d", n+2, max(emailColumn, successColumn)+1, len(row))
+		}
+		email := row[emailColumn]
+		if email == "" {
+			continue
+		}
+		success, err := strconv.ParseBool(row[successColumn])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid success value %q", n+2, row[successColumn])
+		}
+		if _, seen := failed[email]; !seen {
+			order = append(order, email)
+		}
+		// A later retry that succeeded means the address is done
+		failed[email] = !success
+	}
+
+	var emails []string
+	for _, email := range order {
+		if failed[email] {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("results file has no failed entries to replay")
+	}
+	return &emailList{emails: emails}, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadReplayEmails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	os.WriteFile(path, []byte(`timestamp,email,success,captcha_provider,solve_seconds,http_status,error,submit_seconds
+2024-01-01T00:00:00Z,a@test.com,false,ezcaptcha,1.00,,proxy is dead,
+2024-01-01T00:00:01Z,b@test.com,true,ezcaptcha,1.00,200,,0.100
+2024-01-01T00:00:02Z,,false,ezcaptcha,0.00,,error creating email alias,
+2024-01-01T00:00:03Z,c@test.com,false,ezcaptcha,1.00,500,server error,0.100
+2024-01-01T00:00:04Z,a@test.com,false,ezcaptcha,1.00,,proxy is dead,
+2024-01-01T00:00:05Z,c@test.com,true,ezcaptcha,1.00,200,,0.100
+2024-01-01T00:00:06Z,d@test.com,false,ezcaptcha,1.00,,proxy is dead,
+`), 0644)
+
+	list, err := loadReplayEmails(path)
+	if err != nil {
+		t.Fatalf("loadReplayEmails returned an error: %v", err)
+	}
+	if want := []string{"a@test.com", "d@test.com"}; !reflect.DeepEqual(list.emails, want) {
+		t.Errorf("Expected %v, got %v", want, list.emails)
+	}
+
+	// Rows appended by a later version under an older, shorter header
+	os.WriteFile(path, []byte(`timestamp,email,success,captcha_provider,solve_seconds,http_status,error
+2024-01-01T00:00:00Z,a@test.com,false,ezcaptcha,1.00,,proxy is dead
+2024-01-01T00:00:01Z,b@test.com,false,ezcaptcha,1.00,500,server error,0.100
+`), 0644)
+	list, err = loadReplayEmails(path)
+	if err != nil {
+		t.Fatalf("Expected rows of different lengths to be read, got %v", err)
+	}
+	if want := []string{"a@test.com", "b@test.com"}; !reflect.DeepEqual(list.emails, want) {
+		t.Errorf("Expected %v, got %v", want, list.emails)
+	}
+	os.WriteFile(path, []byte("timestamp,email,success\n2024-01-01T00:00:00Z,a@test.com\n"), 0644)
+	if _, err := loadReplayEmails(path); err == nil {
+		t.Errorf("Expected an error for a row without a success field")
+	}
+
+	os.WriteFile(path, []byte("timestamp,email,success\n2024-01-01T00:00:00Z,a@test.com,true\n"), 0644)
+	if _, err := loadReplayEmails(path); err == nil {
+		t.Errorf("Expected an error when nothing failed")
+	}
+	os.WriteFile(path, []byte("timestamp,address\n2024-01-01T00:00:00Z,a@test.com\n"), 0644)
+	if _, err := loadReplayEmails(path); err == nil {
+		t.Errorf("Expected an error without the email and success columns")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// newRunID returns a random version 4 UUID.
+func newRunID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// checkRunID returns a description of a problem with RunID, if any. Unless
+// the config sets one, every process start gets a new ID.
+func checkRunID() []string {
+	if config.RunID == "" {
+		id, err := newRunID()
+		if err != nil {
+			return []string{fmt.Sprintf("Error generating run ID: %v", err)}
+		}
+		config.RunID = id // Set a default value if not specified
+	}
+	// The ID is matched as a space-delimited part of the rule name
+	if strings.ContainsAny(config.RunID, " \t\r\n") {
+		return []string{fmt.Sprintf("Run ID %q must not contain whitespace", config.RunID)}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCheckRunID(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{}
+	if errs := checkRunID(); len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(config.RunID) {
+		t.Errorf("Expected a generated UUID, got %q", config.RunID)
+	}
+	first := config.RunID
+	config.RunID = ""
+	checkRunID()
+	if config.RunID == first {
+		t.Error("Expected a new ID for every run")
+	}
+
+	config.RunID = "nightly batch"
+	if errs := checkRunID(); len(errs) != 1 {
+		t.Errorf("Expected an error for a run ID with a space, got %v", errs)
+	}
+}
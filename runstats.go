@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// runSummaryDir is where writeRunSummary puts its files. Empty means the
+// current directory.
+var runSummaryDir = ""
+
+// RunStats is the summary of one automatic mode run, written as JSON when
+// the run ends.
+type RunStats struct {
+	mu sync.Mutex
+
+	RunID                      string         `json:"run_id"`
+	StartTime                  time.Time      `json:"start_time"`
+	EndTime                    time.Time      `json:"end_time"`
+	Total                      int            `json:"total"`
+	Success                    int            `json:"success"`
+	Failed                     int            `json:"failed"`
+	Errors                     map[string]int `json:"errors"`
+	CaptchaSolves              int            `json:"captcha_solves"`
+	AverageCaptchaSolveSeconds float64        `json:"average_captcha_solve_seconds"`
+	AverageSubmitSeconds       float64        `json:"average_submit_seconds"`
+	StatusCodes                map[int]int    `json:"status_codes"`
+	EstimatedCost              float64        `json:"estimated_cost"`
+	SucceededEmails            []string       `json:"succeeded_emails"`
+
+	// submitSeconds and submits add up the latency of every answered POST
+	submitSeconds float64
+	submits       int
+}
+
+func newRunStats(start time.Time) *RunStats {
+	return &RunStats{
+		RunID:           config.RunID,
+		StartTime:       start,
+		Errors:          make(map[string]int),
+		StatusCodes:     make(map[int]int),
+		SucceededEmails: []string{},
+	}
+}
+
+// record adds the outcome of one submitEntry call.
+func (s *RunStats) record(result SubmissionResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Total++
+	if result.HTTPStatus != 0 {
+		s.StatusCodes[result.HTTPStatus]++
+		s.submitSeconds += result.SubmitSeconds
+		s.submits++
+	}
+	if err != nil {
+		s.Failed++
+		s.Errors[errorType(err)]++
+		return
+	}
+	s.Success++
+	s.SucceededEmails = append(s.SucceededEmails, result.Email)
+}
+
+// counts returns the number of submissions so far, and how many of them
+// succeeded and failed.
+func (s *RunStats) counts() (total, success, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Total, s.Success, s.Failed
+}
+
+// errorType returns the fixed category a failed entry is tallied under,
+// going by its sentinel or typed error rather than the message, which may
+// start with a provider name or URL.
+func errorType(err error) string {
+	var rejected *promoRejectedError
+	var apiErr *captchaAPIError
+	switch {
+	case errors.Is(err, errCaptchaTimeout):
+		return "captcha_timeout"
+	case errors.Is(err, errCaptchaRejected):
+		return "captcha_rejected"
+	case errors.Is(err, errCaptchaCircuitOpen):
+		return "captcha_circuit_open"
+	case errors.As(err, &apiErr):
+		return "captcha_api_error"
+	case errors.Is(err, errProxyDead):
+		return "proxy_dead"
+	case errors.Is(err, errPromoEnded):
+		return "promo_ended"
+	case errors.As(err, &rejected):
+		return "promo_rejected"
+	default:
+		return "other"
+	}
+}
+
+// finish fills in the end time and the captcha totals.
+func (s *RunStats) finish(end time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.EndTime = end
+	solves, avgSolveTime := captchaStats.summary()
+	s.CaptchaSolves = solves
+	s.AverageCaptchaSolveSeconds = avgSolveTime.Seconds()
+	if s.submits > 0 {
+		s.AverageSubmitSeconds = s.submitSeconds / float64(s.submits)
+	}
+	s.EstimatedCost = float64(solves) * config.CostPerThousand / 1000
+}
+
+// writeRunSummary writes s to run_summary_<start time>.json and returns the
+// file name.
+func writeRunSummary(s *RunStats) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling run summary: %v", err)
+	}
+
+	name := filepath.Join(runSummaryDir, fmt.Sprintf("run_summary_%s.json", s.StartTime.UTC().Format("20060102T150405Z")))
+	if err := os.WriteFile(name, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("error writing run summary: %v", err)
+	}
+	return name, nil
+}
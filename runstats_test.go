@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteRunSummary(t *testing.T) {
+	oldConfig, oldRunSummaryDir := config, runSummaryDir
+	defer func() { config, runSummaryDir = oldConfig, oldRunSummaryDir }()
+	runSummaryDir = t.TempDir()
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	stats := newRunStats(start)
+	stats.record(SubmissionResult{Email: "a@test.com", HTTPStatus: 200, SubmitSeconds: 0.5}, nil)
+	stats.record(SubmissionResult{Email: "b@test.com"}, fmt.Errorf("error solving captcha: first: %w", errCaptchaTimeout))
+	stats.record(SubmissionResult{Email: "c@test.com"}, fmt.Errorf("error solving captcha: https://api.ez-captcha.com: %w", &captchaAPIError{ID: 1, Code: "ERROR_ZERO_BALANCE"}))
+	stats.record(SubmissionResult{Email: "d@test.com", HTTPStatus: 403, SubmitSeconds: 1.5}, fmt.Errorf("error submitting promo entry: status 403"))
+	stats.record(SubmissionResult{Email: "e@test.com"}, fmt.Errorf("error submitting promo entry: %w", &promoRejectedError{Message: "Already entered"}))
+	stats.finish(start.Add(time.Minute))
+
+	name, err := writeRunSummary(stats)
+	if err != nil {
+		t.Fatalf("writeRunSummary returned an error: %v", err)
+	}
+	if filepath.Base(name) != "run_summary_20240601T000000Z.json" {
+		t.Errorf("Unexpected file name %s", name)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		Total           int            `json:"total"`
+		Success         int            `json:"success"`
+		Failed          int            `json:"failed"`
+		Errors          map[string]int `json:"errors"`
+		EndTime         time.Time      `json:"end_time"`
+		SucceededEmails []string       `json:"succeeded_emails"`
+		AverageSubmit   float64        `json:"average_submit_seconds"`
+		StatusCodes     map[int]int    `json:"status_codes"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("Error decoding run summary: %v", err)
+	}
+	if summary.Total != 5 || summary.Success != 1 || summary.Failed != 4 {
+		t.Errorf("Expected 1/5 with 4 failures, got %+v", summary)
+	}
+	if want := map[string]int{"captcha_timeout": 1, "captcha_api_error": 1, "promo_rejected": 1, "other": 1}; !reflect.DeepEqual(summary.Errors, want) {
+		t.Errorf("Unexpected error tallies %v", summary.Errors)
+	}
+	if len(summary.SucceededEmails) != 1 || summary.SucceededEmails[0] != "a@test.com" {
+		t.Errorf("Unexpected succeeded emails %v", summary.SucceededEmails)
+	}
+	if summary.AverageSubmit != 1 || summary.StatusCodes[200] != 1 || summary.StatusCodes[403] != 1 {
+		t.Errorf("Expected a 1s average over the answered POSTs, got %v and %v", summary.AverageSubmit, summary.StatusCodes)
+	}
+	if !summary.EndTime.Equal(start.Add(time.Minute)) {
+		t.Errorf("Unexpected end time %v", summary.EndTime)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	rejected := &promoRejectedError{Message: "Bad token", CaptchaRejected: true}
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("error solving captcha: %w", errCaptchaCircuitOpen), "captcha_circuit_open"},
+		{fmt.Errorf("error submitting promo entry: %w", errProxyDead), "proxy_dead"},
+		{errPromoEnded, "promo_ended"},
+		{fmt.Errorf("error submitting promo entry: %w", rejected), "captcha_rejected"},
+		{fmt.Errorf("error creating email alias: https://api.cloudflare.com: status 500"), "other"},
+	} {
+		if got := errorType(tc.err); got != tc.want {
+			t.Errorf("Expected %q for %v, got %q", tc.want, tc.err, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser accepts standard five-field cron expressions as well as
+// descriptors like @daily and a CRON_TZ= prefix.
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// checkSchedule returns a description of every problem with the schedule
+// settings. Schedules without a CRON_TZ= prefix run in UTC.
+func checkSchedule() []string {
+	var errs []string
+
+	if config.BatchSize == 0 {
+		config.BatchSize = 1 // Set a default value if not specified
+	}
+	if config.BatchSize < 0 {
+		errs = append(errs, "Batch size must be greater than 0")
+	}
+	if config.Schedule == "" {
+		return errs
+	}
+	if _, err := scheduleParser.Parse(config.Schedule); err != nil {
+		errs = append(errs, fmt.Sprintf("Invalid schedule %q: %v", config.Schedule, err))
+	}
+	if !generatesAliases() {
+		errs = append(errs, "Scheduled mode requires use_cloudflare_email or email_provider mailtm, it cannot prompt for an email address")
+	}
+	return errs
+}
+
+// runBatch submits n entries across Concurrency workers, records them in
+// stats and returns how many of this batch succeeded along with how many were
+// submitted. No new entries are started once ctx is cancelled or the
+// promotion has ended; those already in flight run to completion.
+func runBatch(ctx context.Context, n int, stats *submissionStats) (int, int) {
+	submitCtx := context.WithoutCancel(ctx)
+	jobs := make(chan int)
+	var batch submissionStats
+	var wg sync.WaitGroup
+
+	for w := 0; w < config.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				// A job handed out before the promotion ended is dropped
+				if promoEnded.Load() {
+					continue
+				}
+				if err := waitSubmissionLimit(ctx); err != nil {
+					return
+				}
+				_, err := submitEntry(submitCtx, nextTarget())
+				if err != nil {
+					errorf("Error submitting entry: %v\n", err)
+				}
+				stats.record(err == nil)
+				batch.record(err == nil)
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil && !promoEnded.Load(); i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return batch.summary()
+}
+
+// scheduleMode runs a batch of BatchSize submissions on every tick of
+// Schedule until ctx is cancelled or the promotion has ended. A tick that
+// arrives while the previous batch is still running is skipped.
+func scheduleMode(ctx context.Context) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var stats submissionStats
+	c := cron.New(
+		cron.WithParser(scheduleParser),
+		cron.WithLocation(time.UTC),
+		cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)),
+	)
+
+	var id cron.EntryID
+	id, err := c.AddFunc(config.Schedule, func() {
+		infof("\n--- Starting scheduled batch of %d submissions ---\n", config.BatchSize)
+		successCount, totalCount := runBatch(ctx, config.BatchSize, &stats)
+		infof("Batch finished: %d/%d submitted successfully\n", successCount, totalCount)
+		notifyTelegram(fmt.Sprintf("Scheduled batch finished: %d/%d entries submitted successfully", successCount, totalCount))
+		if promoEnded.Load() {
+			infof("Stopping scheduled mode: the promotion has ended\n")
+			notifyTelegram("Stopping scheduled mode: the promotion has ended")
+			stop()
+		}
+		if ctx.Err() == nil {
+			infof("Next batch at %s\n", c.Entry(id).Next.Format(time.RFC3339))
+		}
+	})
+	if err != nil {
+		errorf("Error scheduling batches: %v\n", err)
+		return
+	}
+
+	c.Start()
+	infof("Running %d submissions on schedule %q, next batch at %s. Press Ctrl-C to stop.\n",
+		config.BatchSize, config.Schedule, c.Entry(id).Next.Format(time.RFC3339))
+
+	<-ctx.Done()
+	// Stop returns a context that is done once the running batch has finished
+	<-c.Stop().Done()
+
+	infof("\nExiting scheduled mode.\n")
+	printRunSummary(&stats)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckSchedule(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{UseCloudflareEmail: true}
+	if errs := checkSchedule(); len(errs) != 0 || config.BatchSize != 1 {
+		t.Errorf("Expected no errors and a default batch size of 1, got %v and %d", errs, config.BatchSize)
+	}
+
+	for _, schedule := range []string{"0 0 * * *", "@daily", "CRON_TZ=America/New_York 30 9 * * 1-5"} {
+		config.Schedule = schedule
+		if errs := checkSchedule(); len(errs) != 0 {
+			t.Errorf("Expected schedule %q to be valid, got %v", schedule, errs)
+		}
+	}
+
+	config.Schedule = "every day at midnight"
+	config.UseCloudflareEmail = false
+	config.BatchSize = -1
+	errs := checkSchedule()
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %d: %v", len(errs), errs)
+	}
+	for i, want := range []string{"Batch size", "Invalid schedule", "Scheduled mode requires"} {
+		if !strings.HasPrefix(errs[i], want) {
+			t.Errorf("Expected error %d to start with %q, got %q", i, want, errs[i])
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	var created int32
+	newCloudflareRuleServer(t, &created)
+
+	promo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer promo.Close()
+
+	solves := 0
+	oldConfig, oldCaptchaSolver, oldLogFileName := config, captchaSolver, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, captchaSolver, submissionLogFileName = oldConfig, oldCaptchaSolver, oldLogFileName
+	}()
+	config.UseCloudflareEmail = true
+	config.MonsterSubmitURL = promo.URL
+	config.Concurrency = 1
+	captchaSolver = countingCaptchaSolver{solves: &solves}
+	submissionLogFileName = t.TempDir() + "/submissions.log"
+
+	var stats submissionStats
+	stats.record(false)
+	successCount, totalCount := runBatch(context.Background(), 3, &stats)
+	if successCount != 3 || totalCount != 3 {
+		t.Errorf("Expected 3/3 in the batch, got %d/%d", successCount, totalCount)
+	}
+	if successCount, totalCount := stats.summary(); successCount != 3 || totalCount != 4 {
+		t.Errorf("Expected the run totals to include the batch, got %d/%d", successCount, totalCount)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, totalCount := runBatch(ctx, 3, &stats); totalCount != 0 {
+		t.Errorf("Expected no submissions once ctx is cancelled, got %d", totalCount)
+	}
+}
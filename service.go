@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kardianos/service"
+)
+
+// serviceName is the name Promogen is installed under with the system
+// service manager: a systemd or launchd unit, or a Windows service.
+const serviceName = "promogen"
+
+// promoService runs automatic mode as the service's Run. Stop cancels the
+// run like SIGINT does and waits for the current submission to finish.
+type promoService struct {
+	run    func()
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPromoService(run func(), cancel context.CancelFunc) *promoService {
+	return &promoService{run: run, cancel: cancel, done: make(chan struct{})}
+}
+
+// Start must not block, the loop runs until Stop or until it ends on its own.
+func (p *promoService) Start(service.Service) error {
+	go func() {
+		defer close(p.done)
+		p.run()
+	}()
+	return nil
+}
+
+func (p *promoService) Stop(service.Service) error {
+	infof("Service stopping, shutting down after the current submission\n")
+	p.cancel()
+	<-p.done
+	return nil
+}
+
+// newService returns the service definition started with args. The working
+// directory is the current one, so relative output paths such as
+// submissions.log end up where they would without the service.
+func newService(program service.Interface, args []string) (service.Service, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return service.New(program, &service.Config{
+		Name:             serviceName,
+		DisplayName:      "Promogen",
+		Description:      "Submits Call of Duty Monster Energy promo entries in automatic mode.",
+		Arguments:        args,
+		WorkingDirectory: dir,
+		// A run that ends on its own, e.g. when the promo has ended, must
+		// not start again; only failures are restarted
+		Option: service.KeyValue{"Restart": "on-failure"},
+	})
+}
+
+// serviceArguments returns the flags the installed service is started with.
+// The config and email list paths are made absolute, the service manager
+// does not start it from the current directory.
+func serviceArguments(configPath, delay, emails string) ([]string, error) {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-run-service", "-config", configPath}
+	if delay != "" {
+		args = append(args, "-delay", delay)
+	}
+	if emails != "" {
+		if emails, err = filepath.Abs(emails); err != nil {
+			return nil, err
+		}
+		args = append(args, "-emails", emails)
+	}
+	return args, nil
+}
+
+// installService registers Promogen with the service manager, started with
+// args.
+func installService(args []string) error {
+	s, err := newService(newPromoService(nil, nil), args)
+	if err != nil {
+		return err
+	}
+	return s.Install()
+}
+
+// uninstallService stops the service if it is running and removes it.
+func uninstallService() error {
+	s, err := newService(newPromoService(nil, nil), nil)
+	if err != nil {
+		return err
+	}
+	if status, err := s.Status(); err == nil && status == service.StatusRunning {
+		if err := s.Stop(); err != nil {
+			errorf("Error stopping service %s: %v\n", serviceName, err)
+		}
+	}
+	return s.Uninstall()
+}
+
+// runService runs run under the service manager until it is stopped or run
+// returns on its own. Stopping cancels the run through cancel, like SIGINT,
+// so the caller's cleanup runs either way once this returns.
+func runService(run func(), cancel context.CancelFunc) error {
+	program := newPromoService(run, cancel)
+	s, err := newService(program, nil)
+	if err != nil {
+		return err
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Run() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			return fmt.Errorf("error running service: %w", err)
+		}
+		return nil
+	case <-program.done:
+		return nil
+	}
+}
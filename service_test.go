@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceArguments(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := serviceArguments("config.json", "5-15", "emails.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-run-service", "-config", filepath.Join(dir, "config.json"), "-delay", "5-15", "-emails", filepath.Join(dir, "emails.txt")}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected %q, got %q", want, args)
+	}
+
+	if args, _ := serviceArguments("/etc/promogen.json", "", ""); !reflect.DeepEqual(args, []string{"-run-service", "-config", "/etc/promogen.json"}) {
+		t.Errorf("Expected only the config path, got %q", args)
+	}
+}
+
+func TestPromoServiceStopWaitsForRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	finished := false
+	program := newPromoService(func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+	}, cancel)
+
+	if err := program.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := program.Stop(nil); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil || !finished {
+		t.Error("Expected Stop to cancel the run and wait for it to return")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// siteKeyRegexes find captcha site keys in the promo page: the data-sitekey
+// attribute of the widget, a sitekey option passed to grecaptcha.render or
+// a similar call, and the render parameter of the reCAPTCHA v3 script.
+var siteKeyRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`data-sitekey\s*=\s*["']([\w-]+)["']`),
+	regexp.MustCompile(`["']?sitekey["']?\s*:\s*["']([\w-]+)["']`),
+	regexp.MustCompile(`recaptcha/(?:api|enterprise)\.js\?(?:[^"'\s]*&)?render=([\w-]+)`),
+}
+
+// scrapeSiteKeys returns the distinct site keys found in page, in the order
+// they first appear.
+func scrapeSiteKeys(page []byte) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, re := range siteKeyRegexes {
+		for _, match := range re.FindAllSubmatch(page, -1) {
+			key := string(match[1])
+			// render=explicit loads the script without a key
+			if key == "explicit" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// fetchPromoSiteKeys loads promoURL, through a proxy when UseProxy is set,
+// and returns the site keys on it.
+func fetchPromoSiteKeys(ctx context.Context, promoURL string) ([]string, error) {
+	var proxyAddr string
+	if config.UseProxy {
+		var err error
+		proxyAddr, err = nextProxyAddr()
+		if err != nil {
+			return nil, fmt.Errorf("error selecting proxy: %v", err)
+		}
+	}
+	client, err := newPromoHTTPClient(proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", promoURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", randomUserAgent())
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading promo page: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("promo page returned status code: %d", resp.StatusCode)
+	}
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading promo page: %v", err)
+	}
+	return scrapeSiteKeys(page), nil
+}
+
+// checkSiteKey compares the site key of every target with the keys on its
+// promo page. On a mismatch it returns an error, unless update is set, in
+// which case the key is replaced for this run when the page has exactly one
+// key.
+func checkSiteKey(ctx context.Context, update bool) error {
+	for i, target := range promoTargets() {
+		keys, err := fetchPromoSiteKeys(ctx, target.PromoURL)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("no site key found on %s", target.PromoURL)
+		}
+
+		configured := target.siteKey()
+		if slices.Contains(keys, configured) {
+			debugPrint(fmt.Sprintf("Site key %s matches %s", configured, target))
+			continue
+		}
+
+		if !update || len(keys) > 1 {
+			return fmt.Errorf("configured site key %q is not on %s, which has %q", configured, target.PromoURL, keys)
+		}
+		if target.SiteKey != "" {
+			config.Targets[i].SiteKey = keys[0]
+		} else {
+			setCaptchaSiteKey(keys[0])
+		}
+		errorf("WARNING: site key %q was not on %s, using %q for this run. Update %s to keep it.\n", configured, target.PromoURL, keys[0], configFileName)
+	}
+	return nil
+}
+
+// setCaptchaSiteKey replaces the site key used for CaptchaType.
+func setCaptchaSiteKey(key string) {
+	switch config.CaptchaType {
+	case captchaTypeTurnstile:
+		config.TurnstileSiteKey = key
+	case captchaTypeHCaptcha:
+		config.HCaptchaSiteKey = key
+	default:
+		config.RecaptchaSiteKey = key
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScrapeSiteKeys(t *testing.T) {
+	page := []byte(`<html>
+<script src="https://www.google.com/recaptcha/api.js?render=explicit"></script>
+<div class="g-recaptcha" data-sitekey="6LdWidgetKey_abc-123"></div>
+<script>grecaptcha.render('captcha', {'sitekey': '6LdRenderKey', 'theme': 'dark'});</script>
+<script src="https://www.google.com/recaptcha/api.js?onload=cb&render=6LdV3Key"></script>
+<div data-sitekey='6LdWidgetKey_abc-123'></div>
+</html>`)
+
+	want := []string{"6LdWidgetKey_abc-123", "6LdRenderKey", "6LdV3Key"}
+	if got := scrapeSiteKeys(page); !reflect.DeepEqual(got, want) {
+		t.Errorf("scrapeSiteKeys() = %v, want %v", got, want)
+	}
+	if got := scrapeSiteKeys([]byte("<html>no captcha here</html>")); len(got) != 0 {
+		t.Errorf("Expected no keys, got %v", got)
+	}
+}
+
+func TestCheckSiteKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<div class="g-recaptcha" data-sitekey="new_key"></div>`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.MonsterPromoURL = server.URL
+	config.CaptchaType = captchaTypeRecaptchaV2
+
+	config.RecaptchaSiteKey = "new_key"
+	if err := checkSiteKey(context.Background(), false); err != nil {
+		t.Errorf("Expected a matching key to pass, got %v", err)
+	}
+
+	config.RecaptchaSiteKey = "old_key"
+	if err := checkSiteKey(context.Background(), false); err == nil {
+		t.Error("Expected an error for a stale site key")
+	}
+	if config.RecaptchaSiteKey != "old_key" {
+		t.Errorf("Expected the key to be left alone without update, got %q", config.RecaptchaSiteKey)
+	}
+
+	if err := checkSiteKey(context.Background(), true); err != nil {
+		t.Fatalf("Expected update to replace the stale key, got %v", err)
+	}
+	if config.RecaptchaSiteKey != "new_key" {
+		t.Errorf("Expected the key to be updated to new_key, got %q", config.RecaptchaSiteKey)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var (
+	submissionLogMu sync.Mutex
+	// submissionLog stays open from the first entry until closeSubmissionLog,
+	// so concurrent entries are appended whole and in order
+	submissionLog *lumberjack.Logger
+)
+
+// writeSubmissionLog appends entry to submissionLogFileName, rotating the
+// file once it grows past LogMaxSizeMB and keeping LogMaxBackups old ones.
+func writeSubmissionLog(entry string) error {
+	submissionLogMu.Lock()
+	defer submissionLogMu.Unlock()
+
+	if submissionLog == nil {
+		submissionLog = &lumberjack.Logger{
+			Filename:   submissionLogFileName,
+			MaxSize:    config.LogMaxSizeMB,
+			MaxBackups: config.LogMaxBackups,
+		}
+	}
+	_, err := submissionLog.Write([]byte(entry))
+	return err
+}
+
+// closeSubmissionLog closes the submissions log if an entry opened it.
+func closeSubmissionLog() error {
+	submissionLogMu.Lock()
+	defer submissionLogMu.Unlock()
+	if submissionLog == nil {
+		return nil
+	}
+	err := submissionLog.Close()
+	submissionLog = nil
+	return err
+}
+
+// checkSubmissionLog returns a description of every problem with the
+// rotation settings of the submissions log.
+func checkSubmissionLog() []string {
+	if config.LogMaxSizeMB < 0 || config.LogMaxBackups < 0 {
+		return []string{fmt.Sprintf("Log max size %d MB and max backups %d must not be negative", config.LogMaxSizeMB, config.LogMaxBackups)}
+	}
+	return nil
+}
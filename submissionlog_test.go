@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteSubmissionLogConcurrent(t *testing.T) {
+	oldLogFileName := submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		submissionLogFileName = oldLogFileName
+	}()
+	submissionLogFileName = filepath.Join(t.TempDir(), "submissions.log")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writeSubmissionLog(fmt.Sprintf("entry %d %s\n", i, strings.Repeat("x", 1000)))
+		}(i)
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(submissionLogFileName)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("Expected 50 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "entry ") || !strings.HasSuffix(line, strings.Repeat("x", 1000)) {
+			t.Fatalf("Expected whole entries, got an interleaved line: %.40q", line)
+		}
+	}
+}
+
+func TestWriteSubmissionLogRotates(t *testing.T) {
+	oldConfig, oldLogFileName := config, submissionLogFileName
+	defer func() {
+		closeSubmissionLog()
+		config, submissionLogFileName = oldConfig, oldLogFileName
+	}()
+	dir := t.TempDir()
+	submissionLogFileName = filepath.Join(dir, "submissions.log")
+	config.LogMaxSizeMB = 1
+	config.LogMaxBackups = 2
+
+	entry := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < 1500; i++ {
+		if err := writeSubmissionLog(entry); err != nil {
+			t.Fatalf("writeSubmissionLog returned an error: %v", err)
+		}
+	}
+	closeSubmissionLog()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Expected the log and one rotated backup, got %d files", len(files))
+	}
+	if info, err := os.Stat(submissionLogFileName); err != nil || info.Size() >= 1024*1024 {
+		t.Errorf("Expected the current log to be under 1 MB after rotating, got %v / %v", info, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// successRateMonitor keeps the outcomes of the last window submissions and
+// reports when their success rate falls below min, and when it recovers.
+// Unlike the run total, a sliding window forgets old outcomes, so a proxy
+// that slowly gets throttled shows up and so does its recovery.
+type successRateMonitor struct {
+	mu       sync.Mutex
+	min      float64
+	outcomes []bool
+	next     int
+	filled   bool
+	// low is set from the alert until the rate is back at min
+	low bool
+}
+
+func newSuccessRateMonitor(window int, min float64) *successRateMonitor {
+	return &successRateMonitor{min: min, outcomes: make([]bool, window)}
+}
+
+// record adds one outcome and returns the success rate over the window in
+// percent. dropped is true when the rate has just fallen below min and
+// recovered when it has just climbed back; neither is reported before the
+// window is full.
+func (m *successRateMonitor) record(success bool) (rate float64, dropped, recovered bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outcomes[m.next] = success
+	m.next = (m.next + 1) % len(m.outcomes)
+	if m.next == 0 {
+		m.filled = true
+	}
+	if !m.filled {
+		return 0, false, false
+	}
+
+	succeeded := 0
+	for _, ok := range m.outcomes {
+		if ok {
+			succeeded++
+		}
+	}
+	rate = float64(succeeded) / float64(len(m.outcomes)) * 100
+	switch {
+	case !m.low && rate < m.min:
+		m.low = true
+		return rate, true, false
+	case m.low && rate >= m.min:
+		m.low = false
+		return rate, false, true
+	}
+	return rate, false, false
+}
+
+// alertSuccessRate reports a change of the windowed success rate to the log,
+// Discord and Telegram.
+func alertSuccessRate(rate float64, dropped bool) {
+	var msg string
+	if dropped {
+		msg = fmt.Sprintf("Success rate of the last %d submissions dropped to %.2f%%, below min_success_rate %.2f%%", config.SuccessRateWindow, rate, config.MinSuccessRate)
+		if config.SuccessRatePause > 0 {
+			msg += fmt.Sprintf(", pausing for %s", time.Duration(config.SuccessRatePause*float64(time.Second)))
+		}
+		errorf("WARNING: %s\n", msg)
+	} else {
+		msg = fmt.Sprintf("Success rate of the last %d submissions recovered to %.2f%%", config.SuccessRateWindow, rate)
+		infof("%s\n", msg)
+	}
+	notifyDiscord(msg)
+	notifyTelegram(msg)
+}
+
+// checkSuccessRate fills in the success rate alert defaults and returns a
+// description of every problem with its settings.
+func checkSuccessRate() []string {
+	if config.SuccessRateWindow == 0 {
+		config.SuccessRateWindow = 50 // Set a default value if not specified
+	}
+
+	var errs []string
+	if config.MinSuccessRate < 0 || config.MinSuccessRate > 100 {
+		errs = append(errs, fmt.Sprintf("Min success rate %v must be a percentage between 0 and 100", config.MinSuccessRate))
+	}
+	if config.SuccessRateWindow < 0 {
+		errs = append(errs, fmt.Sprintf("Success rate window %d must be greater than 0", config.SuccessRateWindow))
+	}
+	if config.SuccessRatePause < 0 {
+		errs = append(errs, "Success rate pause must not be negative")
+	}
+	return errs
+}
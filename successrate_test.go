@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuccessRateMonitor(t *testing.T) {
+	m := newSuccessRateMonitor(4, 60)
+
+	// Nothing is reported until the window is full
+	for i := 0; i < 3; i++ {
+		if _, dropped, _ := m.record(false); dropped {
+			t.Fatalf("Expected no alert before the window is full")
+		}
+	}
+	rate, dropped, recovered := m.record(true)
+	if rate != 25 || !dropped || recovered {
+		t.Errorf("Expected a drop alert at 25%%, got %v / %v / %v", rate, dropped, recovered)
+	}
+	if _, dropped, _ := m.record(false); dropped {
+		t.Errorf("Expected the alert to fire once while the rate stays low")
+	}
+
+	// The window slides, so the old failures drop out of it
+	m.record(true)
+	rate, dropped, recovered = m.record(true)
+	if rate != 75 || dropped || !recovered {
+		t.Errorf("Expected a recovery at 75%%, got %v / %v / %v", rate, dropped, recovered)
+	}
+	if _, _, recovered := m.record(true); recovered {
+		t.Errorf("Expected the recovery to be reported once")
+	}
+}
+
+func TestFailureCooldownPause(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newFailureCooldown(5, time.Second, time.Minute, func() time.Time { return now })
+	c.Pause(time.Minute)
+	c.Pause(time.Second)
+	if remaining := c.until.Sub(now); remaining != time.Minute {
+		t.Errorf("Expected a shorter pause to keep the longer one, got %s", remaining)
+	}
+}
+
+func TestCheckSuccessRate(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config.MinSuccessRate = 80
+	if errs := checkSuccessRate(); len(errs) != 0 || config.SuccessRateWindow != 50 {
+		t.Errorf("Expected a default window of 50, got %d / %q", config.SuccessRateWindow, errs)
+	}
+	config.MinSuccessRate = 120
+	config.SuccessRatePause = -1
+	if errs := checkSuccessRate(); len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %q", errs)
+	}
+}
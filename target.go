@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Target is one promo page entries are submitted to. Without any targets in
+// the config, MonsterPromoURL, MonsterSubmitURL and the site key for
+// CaptchaType make up the only target.
+type Target struct {
+	Name      string `json:"name"`
+	PromoURL  string `json:"promo_url"`
+	SubmitURL string `json:"submit_url"`
+	// SiteKey overrides the configured site key for CaptchaType
+	SiteKey string `json:"site_key"`
+}
+
+// targetCount is how many entries have been given a target.
+var targetCount atomic.Uint64
+
+// promoTargets returns the configured targets, or the single target made up
+// of the global promo settings when there are none.
+func promoTargets() []Target {
+	if len(config.Targets) > 0 {
+		return config.Targets
+	}
+	return []Target{{
+		PromoURL:  config.MonsterPromoURL,
+		SubmitURL: config.MonsterSubmitURL,
+	}}
+}
+
+// nextTarget returns the targets in turn, so entries are spread evenly across
+// them.
+func nextTarget() Target {
+	targets := promoTargets()
+	n := targetCount.Add(1) - 1
+	return targets[n%uint64(len(targets))]
+}
+
+// siteKey returns the site key to solve captchas for on t.
+func (t Target) siteKey() string {
+	if t.SiteKey != "" {
+		return t.SiteKey
+	}
+	return captchaSiteKey()
+}
+
+// String returns the name of t, or its promo URL when it has none.
+func (t Target) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.PromoURL
+}
+
+// targetsNeedSiteKey reports whether any target falls back to the configured
+// site key for CaptchaType.
+func targetsNeedSiteKey() bool {
+	for _, target := range promoTargets() {
+		if target.SiteKey == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTargets returns a description of every problem with the promo and
+// submit URLs of the targets.
+func checkTargets() []string {
+	var errs []string
+
+	if len(config.Targets) == 0 {
+		if config.MonsterPromoURL == "" || config.MonsterSubmitURL == "" {
+			errs = append(errs, "Monster promo URL or submit URL is missing")
+		}
+		if err := checkHTTPURL(config.MonsterPromoURL); config.MonsterPromoURL != "" && err != nil {
+			errs = append(errs, fmt.Sprintf("Monster promo URL %v", err))
+		}
+		if err := checkHTTPURL(config.MonsterSubmitURL); config.MonsterSubmitURL != "" && err != nil {
+			errs = append(errs, fmt.Sprintf("Monster submit URL %v", err))
+		}
+		return errs
+	}
+
+	for i, target := range config.Targets {
+		if err := checkHTTPURL(target.PromoURL); err != nil {
+			errs = append(errs, fmt.Sprintf("Target %d promo URL %v", i+1, err))
+		}
+		if err := checkHTTPURL(target.SubmitURL); err != nil {
+			errs = append(errs, fmt.Sprintf("Target %d submit URL %v", i+1, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNextTargetCyclesTargets(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config.MonsterPromoURL = "https://promo.test/us"
+	config.MonsterSubmitURL = "https://promo.test/us/submit"
+	if target := nextTarget(); target.PromoURL != config.MonsterPromoURL || target.SubmitURL != config.MonsterSubmitURL {
+		t.Errorf("Expected the global promo settings without targets, got %+v", target)
+	}
+
+	config.Targets = []Target{{Name: "us"}, {Name: "uk"}}
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, nextTarget().Name)
+	}
+	if names[0] == names[1] || names[0] != names[2] || names[1] != names[3] {
+		t.Errorf("Expected the targets to alternate, got %v", names)
+	}
+}
+
+func TestTargetSiteKey(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaSiteKey = "global_key"
+
+	if got := (Target{}).siteKey(); got != "global_key" {
+		t.Errorf("Expected the global site key, got %q", got)
+	}
+	if got := (Target{SiteKey: "uk_key"}).siteKey(); got != "uk_key" {
+		t.Errorf("Expected the target's own site key, got %q", got)
+	}
+}
+
+func TestCheckTargets(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config = Config{}
+	if errs := checkTargets(); len(errs) != 1 || !strings.Contains(errs[0], "missing") {
+		t.Errorf("Expected the global URLs to be required without targets, got %v", errs)
+	}
+
+	config.Targets = []Target{
+		{PromoURL: "https://promo.test/us", SubmitURL: "https://promo.test/us/submit"},
+		{PromoURL: "promo.test/uk", SubmitURL: "https://promo.test/uk/submit"},
+	}
+	errs := checkTargets()
+	if len(errs) != 1 || !strings.HasPrefix(errs[0], "Target 2 promo URL") {
+		t.Errorf("Expected only the bad promo URL of target 2 to be reported, got %v", errs)
+	}
+}
+
+func TestCheckSiteKeyPerTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<div class="g-recaptcha" data-sitekey="` + strings.TrimPrefix(r.URL.Path, "/") + `_key"></div>`))
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CaptchaType = captchaTypeRecaptchaV2
+	config.RecaptchaSiteKey = "us_key"
+	config.Targets = []Target{
+		{PromoURL: server.URL + "/us"},
+		{PromoURL: server.URL + "/uk", SiteKey: "old_key"},
+	}
+
+	if err := checkSiteKey(context.Background(), false); err == nil || !strings.Contains(err.Error(), "/uk") {
+		t.Errorf("Expected the stale key of the second target to be reported, got %v", err)
+	}
+	if err := checkSiteKey(context.Background(), true); err != nil {
+		t.Fatalf("Expected update to replace the stale key, got %v", err)
+	}
+	if config.Targets[1].SiteKey != "uk_key" || config.RecaptchaSiteKey != "us_key" {
+		t.Errorf("Expected only the second target's key to change, got %q and %q", config.Targets[1].SiteKey, config.RecaptchaSiteKey)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/proxy"
+)
+
+// spoofRootCAs verifies the servers reached with SpoofTLS. Nil uses the
+// system roots.
+var spoofRootCAs *x509.CertPool
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newSpoofedTLSTransport returns a transport whose TLS handshakes send
+// Chrome's ClientHello instead of Go's. net/http skips DialTLSContext for
+// proxied requests, so the proxy tunnel is set up by the dialer itself.
+func newSpoofedTLSTransport(proxyURL *url.URL) (*http.Transport, error) {
+	dial, err := tunnelDialer(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		DialContext: dial,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn, err := chromeHandshake(ctx, conn, addr)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+		TLSHandshakeTimeout: httpTimeout(),
+	}, nil
+}
+
+// chromeHandshake runs a TLS handshake over conn that looks like Chrome to
+// JA3 fingerprinting. Only http/1.1 is offered in ALPN because the transport
+// cannot speak HTTP/2 over a custom TLS connection; JA3 does not cover the
+// ALPN values, so the fingerprint is unchanged.
+func chromeHandshake(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := utls.UTLSIdToSpec(utls.HelloChrome_Auto)
+	if err != nil {
+		return nil, fmt.Errorf("error building Chrome ClientHello: %v", err)
+	}
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = []string{"http/1.1"}
+		}
+	}
+
+	uconn := utls.UClient(conn, &utls.Config{ServerName: host, RootCAs: spoofRootCAs}, utls.HelloCustom)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, fmt.Errorf("error applying Chrome ClientHello: %v", err)
+	}
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS handshake with %s failed: %v", host, err)
+	}
+	return uconn, nil
+}
+
+// tunnelDialer returns a dialer that connects directly when proxyURL is nil,
+// through SOCKS5 for socks5 proxies and with an HTTP CONNECT tunnel otherwise.
+func tunnelDialer(proxyURL *url.URL) (dialFunc, error) {
+	direct := &net.Dialer{Timeout: httpTimeout()}
+	if proxyURL == nil {
+		return direct.DialContext, nil
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		var auth *proxy.Auth
+		if hasProxyAuth(proxyURL) {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, direct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+		}
+		return contextDialer.DialContext, nil
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialConnectTunnel(ctx, direct, proxyURL, addr)
+	}, nil
+}
+
+// dialConnectTunnel opens a CONNECT tunnel to addr through an http or https
+// proxy.
+func dialConnectTunnel(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy failed: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if timeout := httpTimeout(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if hasProxyAuth(proxyURL) {
+		req.Header.Set("Proxy-Authorization", basicProxyAuth(proxyURL.User))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT to proxy: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading CONNECT response from proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newConnectProxy returns a minimal HTTP proxy that only supports CONNECT and
+// records the Proxy-Authorization header of each tunnel.
+func newConnectProxy(t *testing.T, auths *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		*auths = append(*auths, r.Header.Get("Proxy-Authorization"))
+		mu.Unlock()
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Error hijacking proxy connection: %v", err)
+			target.Close()
+			return
+		}
+		client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(target, client)
+			target.Close()
+		}()
+		io.Copy(client, target)
+		client.Close()
+	}))
+}
+
+func TestSpoofedTLSThroughConnectProxy(t *testing.T) {
+	var greased bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			// Chrome sends GREASE cipher suites (0x?a?a), Go never does
+			for _, suite := range hello.CipherSuites {
+				if suite&0x0f0f == 0x0a0a {
+					greased = true
+				}
+			}
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	var auths []string
+	proxyServer := newConnectProxy(t, &auths)
+	defer proxyServer.Close()
+
+	oldConfig, oldRootCAs := config, spoofRootCAs
+	defer func() {
+		config, spoofRootCAs = oldConfig, oldRootCAs
+	}()
+	config.SpoofTLS = true
+	config.ProxyScheme = "http"
+	spoofRootCAs = x509.NewCertPool()
+	spoofRootCAs.AddCert(server.Certificate())
+
+	client, err := newPromoHTTPClient("user:pass@" + strings.TrimPrefix(proxyServer.URL, "http://"))
+	if err != nil {
+		t.Fatalf("newPromoHTTPClient returned an error: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request through the spoofed transport failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("Expected body ok, got %q", body)
+	}
+	if !greased {
+		t.Error("Expected a Chrome ClientHello with GREASE cipher suites")
+	}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if len(auths) != 1 || auths[0] != wantAuth {
+		t.Errorf("Expected one CONNECT with %q, got %q", wantAuth, auths)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// resultsUploader copies the output files to S3Bucket when S3Endpoint is
+// set. Nil means nothing is uploaded.
+var resultsUploader *s3Uploader
+
+// s3Uploader puts the submissions log, CSV output and codes file into an
+// S3-compatible bucket under <S3Prefix>/<run ID>/.
+type s3Uploader struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newS3Uploader returns an uploader for the S3 settings. It does not contact
+// the endpoint.
+func newS3Uploader() (*s3Uploader, error) {
+	endpoint, err := url.Parse(config.S3Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.S3AccessKey, config.S3SecretKey, ""),
+		Secure: endpoint.Scheme == "https",
+		Region: config.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Uploader{
+		client: client,
+		bucket: config.S3Bucket,
+		prefix: path.Join(config.S3Prefix, config.RunID),
+	}, nil
+}
+
+// uploadFiles returns the local files worth keeping after the run.
+func uploadFiles() []string {
+	files := []string{submissionLogFileName, config.CodesFile}
+	if config.CSVOutput != "" {
+		files = append(files, config.CSVOutput)
+	}
+	return files
+}
+
+// Upload puts every output file that exists into the bucket with secrets
+// redacted, overwriting the copies of earlier uploads. Failures are only
+// reported, losing the upload must not end the run.
+func (u *s3Uploader) Upload(ctx context.Context) {
+	for _, name := range uploadFiles() {
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errorf("Error reading %s for upload: %v\n", name, err)
+			continue
+		}
+
+		data = []byte(redactSecrets(string(data)))
+		key := path.Join(u.prefix, filepath.Base(name))
+		_, err = u.client.PutObject(ctx, u.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "text/plain"})
+		if err != nil {
+			errorf("Error uploading %s to s3://%s/%s: %v\n", name, u.bucket, key, err)
+			continue
+		}
+		debugPrint(fmt.Sprintf("Uploaded %s to s3://%s/%s", name, u.bucket, key))
+	}
+}
+
+// flushUploads uploads the output files one last time on shutdown, when
+// resultsUploader is set.
+func flushUploads() {
+	if resultsUploader == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	resultsUploader.Upload(ctx)
+	infof("Uploaded the output files to s3://%s/%s/\n", resultsUploader.bucket, resultsUploader.prefix)
+}
+
+// uploadPeriodically uploads every S3UploadInterval seconds until ctx is
+// cancelled.
+func (u *s3Uploader) uploadPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(config.S3UploadInterval * float64(time.Second)))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.Upload(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkS3Upload returns a description of every problem with the S3 upload
+// settings, which only apply when s3_endpoint is set.
+func checkS3Upload() []string {
+	if config.S3Endpoint == "" {
+		return nil
+	}
+
+	var errs []string
+	if err := checkHTTPURL(config.S3Endpoint); err != nil {
+		errs = append(errs, fmt.Sprintf("S3 endpoint %v", err))
+	}
+	if config.S3Bucket == "" {
+		errs = append(errs, "S3 bucket is missing while s3_endpoint is set")
+	}
+	if config.S3AccessKey == "" || config.S3SecretKey == "" {
+		errs = append(errs, "S3 access key or secret key is missing")
+	}
+	if config.S3UploadInterval < 0 {
+		errs = append(errs, "S3 upload interval must not be negative")
+	}
+	config.S3Prefix = strings.Trim(config.S3Prefix, "/")
+	return errs
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckS3Upload(t *testing.T) {
+	oldConfig := config
+	defer func() { config = oldConfig }()
+
+	config.S3Endpoint = ""
+	if errs := checkS3Upload(); len(errs) != 0 {
+		t.Errorf("Expected no errors without an endpoint, got %q", errs)
+	}
+
+	config.S3Endpoint = "https://s3.example.com"
+	config.S3Bucket = "results"
+	config.S3AccessKey = "access"
+	config.S3SecretKey = "secret"
+	config.S3Prefix = "/promogen/"
+	if errs := checkS3Upload(); len(errs) != 0 || config.S3Prefix != "promogen" {
+		t.Errorf("Expected a valid config with prefix promogen, got %q / %q", config.S3Prefix, errs)
+	}
+
+	config.S3Endpoint = "s3.example.com"
+	config.S3Bucket = ""
+	config.S3SecretKey = ""
+	config.S3UploadInterval = -1
+	if errs := checkS3Upload(); len(errs) != 4 {
+		t.Errorf("Expected 4 errors, got %q", errs)
+	}
+}
+
+func TestS3UploaderUploadsRedactedFiles(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.Path] = string(body)
+		mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+
+	oldConfig, oldLogFileName := config, submissionLogFileName
+	defer func() { config, submissionLogFileName = oldConfig, oldLogFileName }()
+	dir := t.TempDir()
+	submissionLogFileName = filepath.Join(dir, "submissions.log")
+	config.CodesFile = filepath.Join(dir, "codes.txt")
+	config.CSVOutput = filepath.Join(dir, "missing.csv")
+	config.S3Endpoint = server.URL
+	config.S3Region = "us-east-1"
+	config.S3Bucket = "results"
+	config.S3Prefix = "promogen"
+	config.S3AccessKey = "access-key"
+	config.S3SecretKey = "secret-key"
+	config.EZCaptchaAPIKey = "captcha-key"
+	config.RunID = "run1"
+
+	os.WriteFile(submissionLogFileName, []byte("Email: a@test.com, key captcha-key\n"), 0644)
+	os.WriteFile(config.CodesFile, []byte("CODE-1\n"), 0644)
+
+	uploader, err := newS3Uploader()
+	if err != nil {
+		t.Fatalf("newS3Uploader returned an error: %v", err)
+	}
+	uploader.Upload(context.Background())
+
+	if len(objects) != 2 {
+		t.Fatalf("Expected the 2 existing files to be uploaded, got %v", objects)
+	}
+	log := objects["/results/promogen/run1/submissions.log"]
+	if !strings.Contains(log, "a@test.com") || strings.Contains(log, "captcha-key") {
+		t.Errorf("Expected the submissions log with the API key redacted, got %q", log)
+	}
+	// Plain HTTP uploads are chunk-signed, so the body is framed
+	if !strings.Contains(objects["/results/promogen/run1/codes.txt"], "CODE-1\n") {
+		t.Errorf("Expected the codes file, got %q", objects["/results/promogen/run1/codes.txt"])
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+// Build metadata, set with -ldflags at build time:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionString describes the build, e.g. "v1.2.0 (commit 1afd0bf, built
+// 2024-06-01T12:00:00Z)".
+func versionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", version, commit, buildDate)
+}
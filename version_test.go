@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestVersionString(t *testing.T) {
+	oldVersion, oldCommit, oldBuildDate := version, commit, buildDate
+	defer func() { version, commit, buildDate = oldVersion, oldCommit, oldBuildDate }()
+	version, commit, buildDate = "v1.2.0", "1afd0bf", "2024-06-01T12:00:00Z"
+
+	if got, want := versionString(), "v1.2.0 (commit 1afd0bf, built 2024-06-01T12:00:00Z)"; got != want {
+		t.Errorf("versionString() = %q, want %q", got, want)
+	}
+}
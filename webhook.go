@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// codeWebhookAttempts is how many times a code is posted to CodeWebhookURL
+// before giving up.
+const codeWebhookAttempts = 3
+
+// codeWebhookPayload is the body posted to CodeWebhookURL for every code.
+type codeWebhookPayload struct {
+	Email      string    `json:"email"`
+	Code       string    `json:"code"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// sendCodeWebhook posts a received code to CodeWebhookURL, retrying failed
+// attempts. The code is saved before this is called, so a failure is only
+// reported. Delivery is not cut short when ctx is cancelled on shutdown.
+func sendCodeWebhook(ctx context.Context, email, code string, receivedAt time.Time) {
+	if config.CodeWebhookURL == "" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	payload := codeWebhookPayload{Email: email, Code: code, ReceivedAt: receivedAt}
+
+	var err error
+	for attempt := 0; attempt < codeWebhookAttempts; attempt++ {
+		var retryAfter string
+		retryAfter, err = postCodeWebhook(ctx, payload)
+		if err == nil {
+			debugPrint(fmt.Sprintf("Posted promo code for %s to the code webhook", email))
+			return
+		}
+		if attempt == codeWebhookAttempts-1 {
+			break
+		}
+		wait := retryDelay(retryAfter, attempt)
+		debugPrint(fmt.Sprintf("Code webhook failed: %v, retrying in %.1fs (%d/%d)", err, wait.Seconds(), attempt+1, codeWebhookAttempts-1))
+		sleepContext(ctx, wait)
+	}
+	errorf("Error posting promo code for %s to the code webhook after %d attempts: %v\n", email, codeWebhookAttempts, err)
+}
+
+// postCodeWebhook sends one attempt and returns the Retry-After header of a
+// failed response.
+func postCodeWebhook(ctx context.Context, payload codeWebhookPayload) (string, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", config.CodeWebhookURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("Retry-After"), fmt.Errorf("status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+	return "", nil
+}
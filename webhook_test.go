@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendCodeWebhookRetries(t *testing.T) {
+	var attempts int
+	var got codeWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < codeWebhookAttempts {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	oldConfig := config
+	defer func() { config = oldConfig }()
+	config.CodeWebhookURL = server.URL
+
+	receivedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	sendCodeWebhook(context.Background(), "a@test.com", "ABCD-EFGH-IJKL", receivedAt)
+	if attempts != codeWebhookAttempts {
+		t.Errorf("Expected %d attempts, got %d", codeWebhookAttempts, attempts)
+	}
+	if got.Email != "a@test.com" || got.Code != "ABCD-EFGH-IJKL" || !got.ReceivedAt.Equal(receivedAt) {
+		t.Errorf("Unexpected payload %+v", got)
+	}
+}
+
+func TestSendCodeWebhookReportsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	oldConfig, oldOutput := config, logOutput
+	defer func() { config, logOutput = oldConfig, oldOutput }()
+	config.CodeWebhookURL = server.URL
+	var buf bytes.Buffer
+	logOutput = &buf
+
+	sendCodeWebhook(context.Background(), "a@test.com", "ABCD-EFGH-IJKL", time.Now())
+	if !strings.Contains(buf.String(), "Error posting promo code for a@test.com") {
+		t.Errorf("Expected the failure to be reported, got %q", buf.String())
+	}
+}